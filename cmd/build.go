@@ -31,8 +31,11 @@ Options:
 		DisableFlagParsing: true,
 		PreRunE:            configSavePreRun(cfg),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			delegator := cmdDelegator(cmd)
-			err := delegator.FilterStderr(newDCErrorFilter(cfg))
+			delegator, err := cmdDelegator(cmd)
+			if err != nil {
+				return err
+			}
+			err = delegator.FilterStderr(newDCErrorFilter(cfg))
 			if err != nil {
 				return err
 			}
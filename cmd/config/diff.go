@@ -0,0 +1,144 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	rootcmd "github.com/get-bridge/muss/cmd"
+	"github.com/get-bridge/muss/config"
+)
+
+func newDiffCommand(cfg *config.ProjectConfig) *cobra.Command {
+	var uses []string
+	var selection config.Selection
+	var format string
+
+	var cmd = &cobra.Command{
+		Use:   "diff",
+		Short: "Show how the compose config would change",
+		Long: `
+Show the changes to the docker compose config that an alternative selection
+of module configs would make compared to the current selection.
+
+Without any alternatives the current selection is compared to the compose
+file on disk (to show what the next command will change).
+
+Examples:
+
+  # What changes if app uses the "repo" config?
+  muss config diff --use app=repo
+
+  # Compare the current selection to the "ci" profile.
+  muss config diff --profile ci
+
+  # Compare the current selection to another user file.
+  muss config diff --user-file other.user.yaml
+`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return rootcmd.QuietErrorOrNil(runDiff(cmd, cfg, uses, selection, format))
+		},
+	}
+
+	cmd.Flags().StringArrayVar(&uses, "use", nil, "Use the config for the module (module=config; can be repeated)")
+	// This shadows the global --profile flag
+	// so that the current selection is compared to the profile.
+	cmd.Flags().StringVar(&selection.Profile, "profile", "", "Use the named profile")
+	cmd.Flags().StringVar(&selection.UserFile, "user-file", "", "Use the user file")
+	cmd.Flags().StringVar(&format, "format", "text", "Output format (text or json)")
+
+	return cmd
+}
+
+func runDiff(cmd *cobra.Command, cfg *config.ProjectConfig, uses []string, selection config.Selection, format string) error {
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unknown format '%s' (expected text or json)", format)
+	}
+
+	selection.Configs = make(map[string]string, len(uses))
+	for _, use := range uses {
+		parts := strings.SplitN(use, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("invalid --use '%s' (expected module=config)", use)
+		}
+		selection.Configs[parts[0]] = parts[1]
+	}
+
+	fromLabel, toLabel := "current selection", "current selection"
+	var from, to map[string]interface{}
+	var err error
+	if selection.IsEmpty() {
+		fromLabel = cfg.ComposeFilePath()
+		if from, err = cfg.ComposeFileConfig(); err != nil {
+			return err
+		}
+		if to, err = cfg.ComposeConfig(); err != nil {
+			return err
+		}
+	} else {
+		toLabel = describeSelection(uses, selection)
+		if from, err = cfg.ComposeConfig(); err != nil {
+			return err
+		}
+		alt, err := cfg.WithSelection(selection)
+		if err != nil {
+			return err
+		}
+		if to, err = alt.ComposeConfig(); err != nil {
+			return err
+		}
+		rootcmd.PrintConfigMessages(cmd, alt)
+	}
+
+	changes := config.DiffConfigs(from, to)
+	if format == "json" {
+		return printChangesJSON(cmd.OutOrStdout(), changes)
+	}
+	printChanges(cmd.OutOrStdout(), fromLabel, toLabel, changes)
+	return nil
+}
+
+func describeSelection(uses []string, selection config.Selection) string {
+	desc := make([]string, 0)
+	for _, use := range uses {
+		desc = append(desc, "--use "+use)
+	}
+	if selection.Profile != "" {
+		desc = append(desc, "--profile "+selection.Profile)
+	}
+	if selection.UserFile != "" {
+		desc = append(desc, "--user-file "+selection.UserFile)
+	}
+	return strings.Join(desc, " ")
+}
+
+func printChanges(w io.Writer, fromLabel, toLabel string, changes []config.ConfigChange) {
+	if len(changes) == 0 {
+		fmt.Fprintln(w, "No differences.")
+		return
+	}
+
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", fromLabel, toLabel)
+	for _, c := range changes {
+		if c.Action != config.ChangeAdded {
+			fmt.Fprintf(w, "- %s:%s\n", c.Path, formatValue(c.Old, "    "))
+		}
+		if c.Action != config.ChangeRemoved {
+			fmt.Fprintf(w, "+ %s:%s\n", c.Path, formatValue(c.New, "    "))
+		}
+	}
+}
+
+func printChangesJSON(w io.Writer, changes []config.ConfigChange) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(changes)
+}
+
+func init() {
+	AddCommandBuilder(newDiffCommand)
+}
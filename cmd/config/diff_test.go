@@ -0,0 +1,138 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	rootcmd "github.com/get-bridge/muss/cmd"
+	"github.com/get-bridge/muss/config"
+	"github.com/get-bridge/muss/testutil"
+)
+
+func testDiffCommand(t *testing.T, cfg *config.ProjectConfig, args []string) (string, string, int) {
+	t.Helper()
+
+	var stdout, stderr strings.Builder
+
+	cmd := rootcmd.NewRootCommand(cfg)
+	cmd.SetOut(&stdout)
+	cmd.SetErr(&stderr)
+
+	exitCode := rootcmd.ExecuteRoot(cmd, append([]string{"config", "diff"}, args...))
+
+	return stdout.String(), stderr.String(), exitCode
+}
+
+func TestConfigDiff(t *testing.T) {
+	testutil.WithTempDir(t, func(tmpdir string) {
+		cfg, err := config.NewConfigFromMap(map[string]interface{}{
+			"default_module_order": []interface{}{"registry"},
+			"module_definitions": []map[string]interface{}{
+				map[string]interface{}{
+					"name": "app",
+					"configs": map[string]interface{}{
+						"repo": map[string]interface{}{
+							"services": map[string]interface{}{
+								"app": map[string]interface{}{
+									"build":       "../app",
+									"environment": map[string]interface{}{"DEBUG": "true"},
+								},
+							},
+						},
+						"registry": map[string]interface{}{
+							"services": map[string]interface{}{
+								"app": map[string]interface{}{"image": "app"},
+							},
+						},
+					},
+				},
+			},
+			"profiles": map[string]interface{}{
+				"dev": map[string]interface{}{
+					"module_order": []interface{}{"repo"},
+				},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Run("use", func(t *testing.T) {
+			stdout, stderr, ec := testDiffCommand(t, cfg, []string{"--use", "app=repo"})
+
+			assert.Equal(t, 0, ec)
+			assert.Equal(t, "", stderr)
+			assert.Equal(t, `--- current selection
++++ --use app=repo
++ services.app.build: ../app
++ services.app.environment:
+    DEBUG: "true"
+- services.app.image: app
+`, stdout)
+		})
+
+		t.Run("profile json", func(t *testing.T) {
+			stdout, _, ec := testDiffCommand(t, cfg, []string{"--profile", "dev", "--format", "json"})
+
+			assert.Equal(t, 0, ec)
+			assert.Equal(t, `[
+  {
+    "path": "services.app.build",
+    "action": "added",
+    "new": "../app"
+  },
+  {
+    "path": "services.app.environment",
+    "action": "added",
+    "new": {
+      "DEBUG": "true"
+    }
+  },
+  {
+    "path": "services.app.image",
+    "action": "removed",
+    "old": "app"
+  }
+]
+`, stdout)
+			assert.Equal(t, "", cfg.ActiveProfile, "global profile not applied")
+		})
+
+		t.Run("compose file", func(t *testing.T) {
+			_, stderr, ec := testDiffCommand(t, cfg, nil)
+
+			assert.Equal(t, 1, ec)
+			assert.Equal(t, "Error:  compose file 'docker-compose.yml' does not exist (run `muss config save` to generate it)\n", stderr)
+
+			if err := cfg.Save(); err != nil {
+				t.Fatal(err)
+			}
+
+			stdout, _, ec := testDiffCommand(t, cfg, nil)
+			assert.Equal(t, 0, ec)
+			assert.Equal(t, "No differences.\n", stdout)
+
+			testutil.WriteFile(t, "docker-compose.yml", "version: '3.7'\nservices: {app: {image: old}}\n")
+
+			stdout, _, ec = testDiffCommand(t, cfg, nil)
+			assert.Equal(t, 0, ec)
+			assert.Equal(t, `--- docker-compose.yml
++++ current selection
+- services.app.image: old
++ services.app.image: app
+`, stdout)
+		})
+
+		t.Run("errors", func(t *testing.T) {
+			_, stderr, ec := testDiffCommand(t, cfg, []string{"--use", "app"})
+			assert.Equal(t, 1, ec)
+			assert.Equal(t, "Error:  invalid --use 'app' (expected module=config)\n", stderr)
+
+			_, stderr, ec = testDiffCommand(t, cfg, []string{"--use", "app=repo", "--format", "xml"})
+			assert.Equal(t, 1, ec)
+			assert.Equal(t, "Error:  unknown format 'xml' (expected text or json)\n", stderr)
+		})
+	})
+}
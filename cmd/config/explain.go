@@ -0,0 +1,78 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	rootcmd "github.com/get-bridge/muss/cmd"
+	"github.com/get-bridge/muss/config"
+)
+
+func newExplainCommand(cfg *config.ProjectConfig) *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "explain path",
+		Short: "Show where a compose config value came from",
+		Long: `
+Show the value at the path (keys separated by dots) in the generated
+docker compose config followed by the value each module config, include,
+and the user override had for it (in the order they were merged).
+
+Examples:
+
+  muss config explain services.web.environment.FOO
+  muss config explain services.web.volumes
+`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			exp, err := cfg.Explain(args[0])
+			if err != nil {
+				return rootcmd.QuietErrorOrNil(err)
+			}
+			printExplanation(cmd.OutOrStdout(), exp)
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func printExplanation(w io.Writer, exp *config.Explanation) {
+	if exp.Found {
+		fmt.Fprintf(w, "%s:%s\n", exp.Path, formatValue(exp.Value, "  "))
+	} else {
+		fmt.Fprintf(w, "%s: (not set)\n", exp.Path)
+	}
+
+	if len(exp.Origins) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\nMerged in order:")
+	for _, o := range exp.Origins {
+		switch o.Directive {
+		case "remove":
+			fmt.Fprintf(w, "  %s: (removed)\n", o.Source)
+		case "replace":
+			fmt.Fprintf(w, "  %s (replaced):%s\n", o.Source, formatValue(o.Value, "    "))
+		default:
+			fmt.Fprintf(w, "  %s:%s\n", o.Source, formatValue(o.Value, "    "))
+		}
+	}
+}
+
+// formatValue returns scalars on the same line and anything else as
+// indented yaml on the following lines.
+func formatValue(value interface{}, indent string) string {
+	formatted := strings.TrimRight(yamlToString(value), "\n")
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		return "\n" + indent + strings.ReplaceAll(formatted, "\n", "\n"+indent)
+	}
+	return " " + formatted
+}
+
+func init() {
+	AddCommandBuilder(newExplainCommand)
+}
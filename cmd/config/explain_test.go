@@ -0,0 +1,105 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	rootcmd "github.com/get-bridge/muss/cmd"
+	"github.com/get-bridge/muss/config"
+)
+
+func testExplainCommand(t *testing.T, cfg *config.ProjectConfig, args []string) (string, string, int) {
+	t.Helper()
+
+	var stdout, stderr strings.Builder
+
+	cmd := rootcmd.NewRootCommand(cfg)
+	cmd.SetOut(&stdout)
+	cmd.SetErr(&stderr)
+
+	exitCode := rootcmd.ExecuteRoot(cmd, append([]string{"config", "explain"}, args...))
+
+	return stdout.String(), stderr.String(), exitCode
+}
+
+func TestConfigExplain(t *testing.T) {
+	cfg, err := config.NewConfigFromMap(map[string]interface{}{
+		"module_definitions": []map[string]interface{}{
+			map[string]interface{}{
+				"name": "app",
+				"configs": map[string]interface{}{
+					"_base": map[string]interface{}{
+						"services": map[string]interface{}{
+							"web": map[string]interface{}{
+								"image":       "alpine",
+								"environment": []interface{}{"FOO=base"},
+								"volumes":     []interface{}{"./here:/there"},
+							},
+						},
+					},
+					"sole": map[string]interface{}{
+						"include": []interface{}{"_base"},
+						"services": map[string]interface{}{
+							"web": map[string]interface{}{
+								"environment": map[string]interface{}{"FOO": "sole"},
+								"volumes":     []interface{}{"data:/var/data"},
+							},
+						},
+					},
+				},
+			},
+		},
+		"user": map[string]interface{}{
+			"override": map[string]interface{}{
+				"services": map[string]interface{}{
+					"web": map[string]interface{}{
+						"environment": map[string]interface{}{"FOO": "mine"},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("scalar", func(t *testing.T) {
+		stdout, stderr, ec := testExplainCommand(t, cfg, []string{"services.web.environment.FOO"})
+
+		assert.Equal(t, 0, ec)
+		assert.Equal(t, "", stderr)
+		assert.Equal(t, `services.web.environment.FOO: mine
+
+Merged in order:
+  module 'app' config 'sole' include '_base': base
+  module 'app' config 'sole': sole
+  user override: mine
+`, stdout)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		stdout, _, ec := testExplainCommand(t, cfg, []string{"services.web.volumes"})
+
+		assert.Equal(t, 0, ec)
+		assert.Equal(t, `services.web.volumes:
+  - ./here:/there
+  - data:/var/data
+
+Merged in order:
+  module 'app' config 'sole' include '_base':
+    - ./here:/there
+  module 'app' config 'sole':
+    - data:/var/data
+`, stdout)
+	})
+
+	t.Run("unknown path", func(t *testing.T) {
+		stdout, stderr, ec := testExplainCommand(t, cfg, []string{"services.db"})
+
+		assert.Equal(t, 1, ec)
+		assert.Equal(t, "", stdout)
+		assert.Equal(t, "Error:  'services.db' is not in the compose config or any module config\n", stderr)
+	})
+}
@@ -27,10 +27,11 @@ func NewCommand(cfg *config.ProjectConfig) *cobra.Command {
 		Use:   "config",
 		Short: "muss configuration commands",
 		Long:  `Work with muss configuration.`,
-		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 			if err := cfg.LoadError; err != nil {
 				fmt.Fprintf(cmd.ErrOrStderr(), "error loading config: %s\n", err)
 			}
+			return rootcmd.ApplyProfile(cfg)
 		},
 	}
 
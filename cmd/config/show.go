@@ -24,6 +24,8 @@ The project configuration is the template context.
 
 Additional functions available to template:
   compose: the docker compose config
+  user: the project user file config
+  global_user: the global user file config (beneath the project user file)
   yaml: format arg as yaml
 
 Template examples:
@@ -68,14 +70,10 @@ func processTemplate(format string, cfg *config.ProjectConfig, writer io.Writer)
 			return cfgMap
 		},
 		"user": func() map[string]interface{} {
-			if cfg.User != nil {
-				cfgMap, err := cfg.User.ToMap()
-				if err != nil {
-					panic(err)
-				}
-				return cfgMap
-			}
-			return map[string]interface{}{}
+			return userConfigMap(cfg.User)
+		},
+		"global_user": func() map[string]interface{} {
+			return userConfigMap(cfg.GlobalUser)
 		},
 	}
 
@@ -86,6 +84,17 @@ func processTemplate(format string, cfg *config.ProjectConfig, writer io.Writer)
 	return t.Execute(writer, cfgMap)
 }
 
+func userConfigMap(user *config.UserConfig) map[string]interface{} {
+	if user == nil {
+		return map[string]interface{}{}
+	}
+	cfgMap, err := user.ToMap()
+	if err != nil {
+		panic(err)
+	}
+	return cfgMap
+}
+
 func yamlToString(object interface{}) string {
 	bs, err := yaml.Marshal(object)
 	if err != nil {
@@ -175,6 +175,30 @@ func TestConfigShow(t *testing.T) {
 			"empty user")
 	})
 
+	t.Run("global user file", func(t *testing.T) {
+		testutil.WithTempDir(t, func(tmpdir string) {
+			testutil.WriteFile(t, "test-config/muss/user.yaml", "module_order: [registry]\n")
+			cfg, err := config.NewConfigFromMap(map[string]interface{}{
+				"user": map[string]interface{}{
+					"module_order": []string{"repo"},
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t,
+				"registry",
+				showOut(t, cfg, `{{ range global_user.module_order }}{{ . }}{{ end }}`),
+				"global_user func")
+
+			assert.Equal(t,
+				"registry repo",
+				showOut(t, cfg, `{{ range .global_user.module_order }}{{ . }}{{ end }} {{ range .user.module_order }}{{ . }}{{ end }}`),
+				"both layers in the project config")
+		})
+	})
+
 	t.Run("config show errors", func(t *testing.T) {
 		cfg, err := config.NewConfigFromMap(map[string]interface{}{
 			"user": map[string]interface{}{
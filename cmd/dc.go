@@ -26,7 +26,8 @@ Usage:
 		DisableFlagParsing: true,
 		PreRunE:            configSavePreRun(cfg),
 		RunE: func(cmd *cobra.Command, args []string) error {
-
+			// Any errors were returned by the pre-run.
+			args, _ = parseMussFlags(cmd, args)
 			return proc.Exec(append([]string{"docker-compose"}, args...))
 		},
 	}
@@ -40,10 +40,15 @@ Options:
 		DisableFlagParsing: true,
 		PreRunE:            configSavePreRun(cfg),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return DelegateCmd(
+			err := DelegateCmd(
 				cmd,
 				dockerComposeCmd(cmd, args),
 			)
+			if err != nil {
+				return err
+			}
+			// The containers that used the secret files are gone.
+			return cfg.RemoveSecretFiles(false)
 		},
 	}
 
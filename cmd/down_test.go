@@ -1,9 +1,13 @@
 package cmd
 
 import (
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/get-bridge/muss/config"
+	"github.com/get-bridge/muss/testutil"
 )
 
 func TestDownCommand(t *testing.T) {
@@ -30,5 +34,73 @@ down
 			assert.Equal(t, "std err\n", stderr)
 			assert.Equal(t, expOut, stdout)
 		})
+
+		t.Run("muss flags", func(t *testing.T) {
+			cfg := newTestConfig(t, map[string]interface{}{
+				"profiles": map[string]interface{}{
+					"min": map[string]interface{}{},
+				},
+			})
+
+			stdout, _, err := runTestCommand(cfg, []string{
+				"--profile", "min",
+				"down",
+				"-v",
+				"--verbose",
+				"--no-redact",
+				"--remove-orphans",
+			})
+
+			assert.Nil(t, err)
+			assert.Equal(t, "docker-compose\ndown\n-v\n--remove-orphans\n", stdout, "muss flags not passed")
+			assert.Equal(t, "min", cfg.ActiveProfile, "profile applied")
+			assert.True(t, verbose, "verbose set")
+			assert.True(t, cfg.Verbose, "verbose passed to the config")
+			assert.True(t, noRedact, "no-redact set")
+
+			_, _, err = runTestCommand(cfg, []string{"down", "--profile"})
+			assert.EqualError(t, err, "flag needs an argument: --profile")
+		})
+
+		t.Run("removes secret files", func(t *testing.T) {
+			testutil.WithTempDir(t, func(tmpdir string) {
+				os.Setenv("MUSS_TEST_DB_PASS", "open sesame")
+				defer os.Unsetenv("MUSS_TEST_DB_PASS")
+
+				// Load the project file so that the cache is specific to the tempdir.
+				testutil.WriteFile(t, "muss.yaml", `
+module_definitions:
+  - name: app
+    configs:
+      sole:
+        services:
+          app: {image: app, secrets: [DB_PASS]}
+        secrets:
+          DB_PASS: {env: [MUSS_TEST_DB_PASS], as: file}
+`)
+				cfg, err := config.NewConfigFromDefaultFile()
+				if err != nil {
+					t.Fatal(err)
+				}
+				testutil.CaptureStderr(t, func() {
+					if _, err := cfg.Env(true); err != nil {
+						t.Fatal(err)
+					}
+				})
+
+				dc, err := cfg.ComposeConfig()
+				if err != nil {
+					t.Fatal(err)
+				}
+				file := subMap(dc, "secrets", "DB_PASS")["file"].(string)
+				assert.Equal(t, "open sesame", testutil.ReadFile(t, file))
+
+				_, _, err = runTestCommand(cfg, []string{"down"})
+				assert.Nil(t, err)
+
+				_, err = os.Stat(file)
+				assert.True(t, os.IsNotExist(err), "secret file removed")
+			})
+		})
 	})
 }
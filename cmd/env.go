@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/get-bridge/muss/config"
+)
+
+func newEnvCommand(cfg *config.ProjectConfig) *cobra.Command {
+	format := "shell"
+	noSecrets := false
+	diff := false
+
+	var cmd = &cobra.Command{
+		Use:   "env",
+		Short: "Print the environment muss sets for the project",
+		Long: `Print the env vars that muss sets for the project
+(like COMPOSE_PROJECT_NAME, COMPOSE_FILE, env_files, and secrets)
+so that other tools can use them.
+
+Formats:
+  shell   export statements (for eval "$(muss env)")
+  dotenv  NAME="VALUE" lines (for .env files and IDE run configurations)
+  json    an object of names and values`,
+		Example: `  eval "$(muss env)"
+  muss env --format dotenv --no-secrets > .env.muss`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := runEnv(cmd, cfg, format, !noSecrets, diff)
+			PrintConfigMessages(cmd, cfg)
+			return QuietErrorOrNil(err)
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", format,
+		"Output format (shell, dotenv, or json).")
+	cmd.Flags().BoolVar(&noSecrets, "no-secrets", noSecrets,
+		"Don't run the secret commands (or print their values).")
+	cmd.Flags().BoolVar(&diff, "diff", diff,
+		"Only print the vars that are not already set to the same value.")
+
+	return cmd
+}
+
+func runEnv(cmd *cobra.Command, cfg *config.ProjectConfig, format string, secrets, diff bool) error {
+	var write func(io.Writer, []config.EnvVar) error
+	switch format {
+	case "shell":
+		write = writeShellEnv
+	case "dotenv":
+		write = writeDotenv
+	case "json":
+		write = writeJSONEnv
+	default:
+		return fmt.Errorf("unknown format '%s' (expected shell, dotenv, or json)", format)
+	}
+
+	if cfg.LoadError != nil {
+		return cfg.LoadError
+	}
+
+	vars, err := cfg.Env(secrets)
+	if err != nil {
+		return err
+	}
+
+	if diff {
+		changed := make([]config.EnvVar, 0, len(vars))
+		for _, v := range vars {
+			if v.Changed {
+				changed = append(changed, v)
+			}
+		}
+		vars = changed
+	}
+
+	return write(cmd.OutOrStdout(), vars)
+}
+
+func writeShellEnv(w io.Writer, vars []config.EnvVar) error {
+	for _, v := range vars {
+		// Nothing is special inside single quotes (except the quote itself).
+		value := strings.ReplaceAll(v.Value, "'", `'\''`)
+		if _, err := fmt.Fprintf(w, "export %s='%s'\n", v.Name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeDotenv(w io.Writer, vars []config.EnvVar) error {
+	for _, v := range vars {
+		if _, err := fmt.Fprint(w, config.FormatDotenv(v.Name, v.Value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeJSONEnv(w io.Writer, vars []config.EnvVar) error {
+	env := make(map[string]string, len(vars))
+	for _, v := range vars {
+		env[v.Name] = v.Value
+	}
+	content, err := json.MarshalIndent(env, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(content))
+	return err
+}
+
+func init() {
+	AddCommandBuilder(newEnvCommand)
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/get-bridge/muss/config"
+	"github.com/get-bridge/muss/testutil"
+)
+
+func TestEnvCommand(t *testing.T) {
+	testutil.WithTempDir(t, func(tmpdir string) {
+		for _, name := range []string{"COMPOSE_PROJECT_NAME", "COMPOSE_FILE", "MUSS_TEST_QUOTED", "MUSS_TEST_SET", "MUSS_TEST_SECRET"} {
+			os.Unsetenv(name)
+			defer os.Unsetenv(name)
+		}
+		os.Setenv("MUSS_TEST_SET", "same")
+
+		testutil.WriteFile(t, ".env", `
+MUSS_TEST_QUOTED="it's \"$5\"
+next line"
+MUSS_TEST_SET=same
+`)
+
+		newCfg := func() *config.ProjectConfig {
+			cfg := newTestConfig(t, map[string]interface{}{
+				"project_name": "musstest",
+				"env_files":    []string{".env"},
+			})
+			cfg.Secrets = append(cfg.Secrets, &config.EnvCommand{
+				Varname: "MUSS_TEST_SECRET",
+				Exec:    []string{"echo", "shh"},
+			})
+			return cfg
+		}
+		reset := func() {
+			os.Unsetenv("COMPOSE_PROJECT_NAME")
+			os.Unsetenv("MUSS_TEST_QUOTED")
+			os.Unsetenv("MUSS_TEST_SECRET")
+		}
+
+		t.Run("shell", func(t *testing.T) {
+			defer reset()
+			stdout, stderr, err := runTestCommand(newCfg(), []string{"env"})
+			assert.Nil(t, err)
+			assert.Equal(t, "", stderr)
+			assert.Equal(t, `export COMPOSE_PROJECT_NAME='musstest'
+export MUSS_TEST_QUOTED='it'\''s "$5"
+next line'
+export MUSS_TEST_SET='same'
+export MUSS_TEST_SECRET='shh'
+`, stdout)
+		})
+
+		t.Run("dotenv", func(t *testing.T) {
+			defer reset()
+			stdout, _, err := runTestCommand(newCfg(), []string{"env", "--format", "dotenv", "--no-secrets"})
+			assert.Nil(t, err)
+			assert.Equal(t, `COMPOSE_PROJECT_NAME="musstest"
+MUSS_TEST_QUOTED="it's \"\$5\"\nnext line"
+MUSS_TEST_SET="same"
+`, stdout)
+		})
+
+		t.Run("json diff", func(t *testing.T) {
+			defer reset()
+			stdout, _, err := runTestCommand(newCfg(), []string{"env", "--format", "json", "--diff"})
+			assert.Nil(t, err)
+			assert.Equal(t, `{
+  "COMPOSE_PROJECT_NAME": "musstest",
+  "MUSS_TEST_QUOTED": "it's \"$5\"\nnext line",
+  "MUSS_TEST_SECRET": "shh"
+}
+`, stdout)
+		})
+
+		t.Run("compose file", func(t *testing.T) {
+			defer reset()
+			defer os.Unsetenv("COMPOSE_FILE")
+			cfg := newCfg()
+			cfg.ComposeFile = "dc.muss.yml"
+			stdout, _, err := runTestCommand(cfg, []string{"env", "--no-secrets"})
+			assert.Nil(t, err)
+			composeFile, _ := filepath.Abs("dc.muss.yml")
+			assert.Contains(t, stdout, "export COMPOSE_FILE='"+composeFile+"'\n",
+				"absolute so that it works from other dirs")
+		})
+
+		t.Run("errors", func(t *testing.T) {
+			_, _, err := runTestCommand(newCfg(), []string{"env", "--format", "yaml"})
+			assert.EqualError(t, err, "unknown format 'yaml' (expected shell, dotenv, or json)")
+
+			cfg := newCfg()
+			cfg.EnvFiles = []string{"missing.env"}
+			_, _, err = runTestCommand(cfg, []string{"env"})
+			if assert.NotNil(t, err) {
+				assert.Contains(t, err.Error(), "Failed to read env file 'missing.env'")
+			}
+		})
+	})
+}
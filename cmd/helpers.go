@@ -20,24 +20,59 @@ var dc = "docker-compose"
 func configSavePreRun(cfg *config.ProjectConfig) func(*cobra.Command, []string) error {
 	return func(cmd *cobra.Command, argv []string) error {
 		err := cfg.Save()
-		for _, w := range cfg.Warnings {
-			fmt.Fprintln(cmd.ErrOrStderr(), w)
-		}
+		PrintConfigMessages(cmd, cfg)
 		return QuietErrorOrNil(err)
 	}
 }
 
-func cmdDelegator(cmd *cobra.Command) *proc.Delegator {
-	return (&proc.Delegator{
+// PrintConfigMessages prints any config warnings
+// (and any notes in verbose mode) to stderr.
+func PrintConfigMessages(cmd *cobra.Command, cfg *config.ProjectConfig) {
+	if cfg == nil {
+		return
+	}
+	if verbose {
+		for _, n := range cfg.Notes {
+			fmt.Fprintln(cmd.ErrOrStderr(), n)
+		}
+	}
+	for _, w := range cfg.Warnings {
+		fmt.Fprintln(cmd.ErrOrStderr(), w)
+	}
+}
+
+// cmdDelegator returns a delegator for the streams of the cobra command
+// that redacts secret values from the output (unless disabled).
+// Other filters can be chained after it.
+func cmdDelegator(cmd *cobra.Command) (*proc.Delegator, error) {
+	d := &proc.Delegator{
 		Stdin:  cmd.InOrStdin(),
 		Stdout: cmd.OutOrStdout(),
 		Stderr: cmd.ErrOrStderr(),
-	})
+	}
+	if noRedact {
+		return d, nil
+	}
+	values := config.SecretValues()
+	if len(values) == 0 {
+		return d, nil
+	}
+	if err := d.FilterStdout(proc.NewRedactFilter(values)); err != nil {
+		return nil, err
+	}
+	if err := d.FilterStderr(proc.NewRedactFilter(values)); err != nil {
+		return nil, err
+	}
+	return d, nil
 }
 
 // DelegateCmd runs with a delegator made from a `cobra.Cmd`.
 func DelegateCmd(cmd *cobra.Command, commands ...*exec.Cmd) (err error) {
-	return cmdDelegator(cmd).Delegate(commands...)
+	delegator, err := cmdDelegator(cmd)
+	if err != nil {
+		return err
+	}
+	return delegator.Delegate(commands...)
 }
 
 type flagDumper struct {
@@ -53,10 +88,8 @@ func (f flagDumper) fromCmd(cmd *cobra.Command) []string {
 		if flag.Name == "help" {
 			return
 		}
-		if flag.Annotations != nil {
-			if mussOnly := flag.Annotations["muss-only"]; len(mussOnly) == 1 && mussOnly[0] == "true" {
-				return
-			}
+		if isMussOnly(flag) {
+			return
 		}
 
 		var arg string
@@ -96,12 +129,22 @@ func (f flagDumper) fromCmd(cmd *cobra.Command) []string {
 	return args
 }
 
+// isMussOnly returns true if the flag is not passed to docker-compose.
+func isMussOnly(flag *pflag.Flag) bool {
+	mussOnly := flag.Annotations["muss-only"]
+	return len(mussOnly) == 1 && mussOnly[0] == "true"
+}
+
 func dockerCmd(args ...string) *exec.Cmd {
 	return exec.Command("docker", args...)
 }
 
 func dockerComposeArgs(action string, cmd *cobra.Command, args []string) []string {
 	flags := (flagDumper{}).fromCmd(cmd)
+	if cmd.DisableFlagParsing {
+		// Any errors were returned by the pre-run.
+		args, _ = parseMussFlags(cmd, args)
+	}
 
 	cmdargs := make([]string, 1, 1+len(flags)+len(args))
 	cmdargs[0] = action
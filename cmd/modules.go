@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/get-bridge/muss/config"
+)
+
+func newModulesCommand(cfg *config.ProjectConfig) *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "modules",
+		Short: "Manage module definitions",
+		Args:  cobra.NoArgs,
+	}
+
+	cmd.AddCommand(newModulesUpdateCommand(cfg))
+
+	return cmd
+}
+
+func newModulesUpdateCommand(cfg *config.ProjectConfig) *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "update [repository...]",
+		Short: "Update module files from git repositories",
+		Long: `Fetch the git repositories used in module_files
+and pin the current commit of each ref in the lock file.
+
+If any repository urls are given only those will be updated.`,
+		Args: cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			updates, err := cfg.UpdateModuleRepos(args...)
+			if err != nil {
+				return QuietErrorOrNil(err)
+			}
+
+			if len(updates) == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "No module_files use git repositories.")
+			}
+			for _, u := range updates {
+				switch u.From {
+				case u.To:
+					fmt.Fprintf(cmd.OutOrStdout(), "%s (%s) is up to date at %s\n", u.URL, u.Ref, shortCommit(u.To))
+				case "":
+					fmt.Fprintf(cmd.OutOrStdout(), "%s (%s) pinned at %s\n", u.URL, u.Ref, shortCommit(u.To))
+				default:
+					fmt.Fprintf(cmd.OutOrStdout(), "%s (%s) updated from %s to %s\n", u.URL, u.Ref, shortCommit(u.From), shortCommit(u.To))
+				}
+			}
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 12 {
+		return commit[:12]
+	}
+	return commit
+}
+
+func init() {
+	AddCommandBuilder(newModulesCommand)
+}
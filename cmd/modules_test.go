@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/get-bridge/muss/testutil"
+)
+
+func TestModulesUpdateCommand(t *testing.T) {
+	testutil.WithTempDir(t, func(tmpdir string) {
+		testutil.WriteFile(t, "local.yml", "name: local\nconfigs: {sole: {}}\n")
+		cfg := newTestConfig(t, map[string]interface{}{
+			"module_files": []string{"local.yml"},
+		})
+
+		t.Run("no repositories", func(t *testing.T) {
+			stdout, stderr, err := runTestCommand(cfg, []string{"modules", "update"})
+
+			assert.Nil(t, err)
+			assert.Equal(t, "", stderr)
+			assert.Equal(t, "No module_files use git repositories.\n", stdout)
+		})
+
+		t.Run("unknown repository", func(t *testing.T) {
+			_, _, err := runTestCommand(cfg, []string{"modules", "update", "https://example.com/modules.git"})
+
+			assert.EqualError(t, err, "no module_files entry uses repository 'https://example.com/modules.git'")
+		})
+	})
+}
@@ -19,8 +19,11 @@ func newPullCommand(cfg *config.ProjectConfig) *cobra.Command {
 
 			// TODO: pull repos
 
-			delegator := cmdDelegator(cmd)
-			err := delegator.FilterStderr(newDCErrorFilter(cfg))
+			delegator, err := cmdDelegator(cmd)
+			if err != nil {
+				return err
+			}
+			err = delegator.FilterStderr(newDCErrorFilter(cfg))
 			if err != nil {
 				return err
 			}
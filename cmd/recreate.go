@@ -21,7 +21,7 @@ This is useful for truncating container logs and refreshing environment settings
 		RunE: func(cmd *cobra.Command, args []string) error {
 			args = append([]string{"--detach", "--force-recreate", "--renew-anon-volumes"}, args...)
 
-			return cmdDelegator(cmd).Delegate(
+			return DelegateCmd(cmd,
 				dockerComposeNamedCmd("up", cmd, args),
 			)
 		},
@@ -2,7 +2,9 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 	"os/exec"
+	"strings"
 
 	"github.com/spf13/cobra"
 
@@ -15,6 +17,16 @@ type CommandBuilder func(*config.ProjectConfig) *cobra.Command
 
 var cmdBuilders = make([]CommandBuilder, 0)
 
+// verbose is set by the global --verbose flag (or MUSS_VERBOSE).
+var verbose bool
+
+// noRedact is set by the global --no-redact flag (or MUSS_NO_REDACT).
+var noRedact bool
+
+// profile is set by the global --profile flag
+// (MUSS_PROFILE is applied when the config is loaded).
+var profile string
+
 // AddCommandBuilder takes the provided function and adds it to the list of
 // commands that will be added to the root command when it is built.
 func AddCommandBuilder(f CommandBuilder) {
@@ -30,13 +42,83 @@ func NewRootCommand(cfg *config.ProjectConfig) *cobra.Command {
 		// SilenceUsage and Errors so that we don't print excessively when dc exits non-zero.
 		SilenceErrors: true,
 		SilenceUsage:  true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// Commands that pass their flags through don't parse ours.
+			if cmd.DisableFlagParsing {
+				if _, err := parseMussFlags(cmd, args); err != nil {
+					return err
+				}
+			}
+			cfg.Verbose = verbose
+			return ApplyProfile(cfg)
+		},
 	}
+	cmd.PersistentFlags().BoolVar(&verbose, "verbose", os.Getenv("MUSS_VERBOSE") != "",
+		"Show additional information (like why module configs were skipped).")
+	cmd.PersistentFlags().SetAnnotation("verbose", "muss-only", []string{"true"})
+	cmd.PersistentFlags().BoolVar(&noRedact, "no-redact", os.Getenv("MUSS_NO_REDACT") != "",
+		"Show secret values in the output of commands (rather than masking them).")
+	cmd.PersistentFlags().SetAnnotation("no-redact", "muss-only", []string{"true"})
+	cmd.PersistentFlags().StringVar(&profile, "profile", "",
+		"Use the named profile from the project file (overrides MUSS_PROFILE).")
+	cmd.PersistentFlags().SetAnnotation("profile", "muss-only", []string{"true"})
+
 	for _, f := range cmdBuilders {
 		cmd.AddCommand(f(cfg))
 	}
 	return cmd
 }
 
+// parseMussFlags sets the muss-only global flags (like --profile)
+// found at the start of the args of a command that doesn't parse its flags
+// and returns the rest of the args (to pass on).
+// Scanning stops at "--" or the first arg that isn't a flag
+// (so the args of a container command are left alone).
+func parseMussFlags(cmd *cobra.Command, args []string) ([]string, error) {
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			rest = append(rest, args[i:]...)
+			break
+		}
+
+		name, value, hasValue := strings.TrimPrefix(arg, "--"), "", false
+		if j := strings.Index(name, "="); j >= 0 {
+			name, value, hasValue = name[:j], name[j+1:], true
+		}
+		flag := cmd.Root().PersistentFlags().Lookup(name)
+		if !strings.HasPrefix(arg, "--") || flag == nil || !isMussOnly(flag) {
+			rest = append(rest, arg)
+			continue
+		}
+
+		if !hasValue {
+			if flag.Value.Type() == "bool" {
+				value = "true"
+			} else if i+1 < len(args) {
+				i++
+				value = args[i]
+			} else {
+				return nil, fmt.Errorf("flag needs an argument: %s", arg)
+			}
+		}
+		if err := flag.Value.Set(value); err != nil {
+			return nil, fmt.Errorf("invalid argument %q for %s: %w", value, arg, err)
+		}
+	}
+	return rest, nil
+}
+
+// ApplyProfile activates the profile chosen with the --profile flag (if any).
+// Commands that define their own persistent pre-run should call it.
+func ApplyProfile(cfg *config.ProjectConfig) error {
+	if profile == "" || cfg == nil || cfg.LoadError != nil {
+		return nil
+	}
+	return cfg.SetProfile(profile)
+}
+
 // Execute loads the config and runs the root command with the provided arguments.
 func Execute(args []string) int {
 	// We'll inspect the error later when we have command context.
@@ -88,6 +88,85 @@ func TestRootCommand(t *testing.T) {
 		})
 	})
 
+	t.Run("verbose", func(t *testing.T) {
+		testutil.WithTempDir(t, func(tmpdir string) {
+			cfg, err := config.NewConfigFromMap(map[string]interface{}{
+				"default_module_order": []string{"repo", "registry"},
+				"module_definitions": []map[string]interface{}{
+					{
+						"name": "foo",
+						"configs": map[string]interface{}{
+							"repo":     map[string]interface{}{"when": map[string]interface{}{"path": "../foo"}},
+							"registry": map[string]interface{}{},
+						},
+					},
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			run := func(args ...string) string {
+				var stderr strings.Builder
+				rootCmd := NewRootCommand(cfg)
+				rootCmd.SetErr(&stderr)
+				assert.Equal(t, 0, ExecuteRoot(rootCmd, args), "exit 0")
+				return stderr.String()
+			}
+
+			note := "Module 'foo' skipped config 'repo': path '../foo' does not exist.\n"
+
+			assert.Equal(t, "", run("wrap", "true"), "notes not shown")
+			assert.Equal(t, note, run("--verbose", "wrap", "true"), "notes shown with flag")
+
+			os.Setenv("MUSS_VERBOSE", "1")
+			defer os.Unsetenv("MUSS_VERBOSE")
+			assert.Equal(t, note, run("wrap", "true"), "notes shown with env var")
+		})
+	})
+
+	t.Run("profile", func(t *testing.T) {
+		testutil.WithTempDir(t, func(tmpdir string) {
+			cfg, err := config.NewConfigFromMap(map[string]interface{}{
+				"module_definitions": []map[string]interface{}{
+					{
+						"name": "foo",
+						"configs": map[string]interface{}{
+							"sole": map[string]interface{}{
+								"services": map[string]interface{}{"foo": map[string]interface{}{"image": "foo"}},
+							},
+						},
+					},
+				},
+				"profiles": map[string]interface{}{
+					"none": map[string]interface{}{
+						"modules": map[string]interface{}{"foo": map[string]interface{}{"disabled": true}},
+					},
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			run := func(args ...string) (int, string) {
+				var stderr strings.Builder
+				rootCmd := NewRootCommand(cfg)
+				rootCmd.SetErr(&stderr)
+				return ExecuteRoot(rootCmd, args), stderr.String()
+			}
+
+			exitCode, stderr := run("--profile", "none", "wrap", "true")
+			assert.Equal(t, 0, exitCode, "exit 0")
+			assert.Equal(t, "", stderr)
+			assert.Equal(t, "none", cfg.ActiveProfile)
+			assert.NotContains(t, testutil.ReadFile(t, "docker-compose.yml"), "foo", "profile applied")
+
+			exitCode, stderr = run("--profile", "full", "wrap", "true")
+			assert.Equal(t, 1, exitCode, "exit 1")
+			assert.Equal(t, []string{"Error:  profile 'full' is not defined (available profiles: none)\n"}, getLines(stderr, 1))
+		})
+	})
+
 	t.Run("Execute()", func(t *testing.T) {
 		testutil.WithTempDir(t, func(tmpdir string) {
 			yaml := `---
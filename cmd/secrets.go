@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/get-bridge/muss/config"
+)
+
+func newSecretsCommand(cfg *config.ProjectConfig) *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "secrets",
+		Short: "Inspect and manage the secret cache",
+		Long: `Inspect and manage the encrypted cache of the secrets
+used by the chosen module configs.
+
+Secret values are never printed unless --reveal is given.`,
+		Args: cobra.NoArgs,
+	}
+
+	cmd.AddCommand(newSecretsListCommand(cfg))
+	cmd.AddCommand(newSecretsRefreshCommand(cfg))
+	cmd.AddCommand(newSecretsClearCommand(cfg))
+
+	return cmd
+}
+
+func newSecretsListCommand(cfg *config.ProjectConfig) *cobra.Command {
+	reveal := false
+
+	var cmd = &cobra.Command{
+		Use:   "list",
+		Short: "List the secrets and whether they are cached",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cfg.LoadError != nil {
+				return QuietErrorOrNil(cfg.LoadError)
+			}
+			secrets, err := cfg.SecretsInfo(reveal)
+			PrintConfigMessages(cmd, cfg)
+			if err != nil {
+				return QuietErrorOrNil(err)
+			}
+			return writeSecrets(cmd.OutOrStdout(), secrets, reveal)
+		},
+	}
+
+	cmd.Flags().BoolVar(&reveal, "reveal", reveal,
+		"Print the secret values (getting any that aren't cached).")
+
+	return cmd
+}
+
+func newSecretsRefreshCommand(cfg *config.ProjectConfig) *cobra.Command {
+	reveal := false
+
+	var cmd = &cobra.Command{
+		Use:   "refresh [varname...]",
+		Short: "Get new values for the secrets",
+		Long: `Remove the cached values of the secrets and get them again.
+
+If any varnames are given only those secrets will be refreshed.`,
+		Args: cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cfg.LoadError != nil {
+				return QuietErrorOrNil(cfg.LoadError)
+			}
+			secrets, err := cfg.RefreshSecrets(args, reveal)
+			PrintConfigMessages(cmd, cfg)
+			if err != nil {
+				return QuietErrorOrNil(err)
+			}
+			return writeSecrets(cmd.OutOrStdout(), secrets, reveal)
+		},
+	}
+
+	cmd.Flags().BoolVar(&reveal, "reveal", reveal,
+		"Print the new secret values.")
+
+	return cmd
+}
+
+func newSecretsClearCommand(cfg *config.ProjectConfig) *cobra.Command {
+	all := false
+
+	var cmd = &cobra.Command{
+		Use:   "clear",
+		Short: "Remove the cached secrets of the project",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// The cache of the project depends on where the project is.
+			if cfg.LoadError != nil && !all {
+				return QuietErrorOrNil(cfg.LoadError)
+			}
+			removed, err := cfg.ClearSecretCache(all)
+			if err != nil {
+				return QuietErrorOrNil(err)
+			}
+			// Don't leave the plain text of secrets as files behind either.
+			if err := cfg.RemoveSecretFiles(all); err != nil {
+				return QuietErrorOrNil(err)
+			}
+
+			noun := "secrets"
+			if removed == 1 {
+				noun = "secret"
+			}
+			from := "the project"
+			if all {
+				from = "all projects"
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Removed %d cached %s from %s.\n", removed, noun, from)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&all, "all", all,
+		"Remove the cached secrets (and secret files) of all projects.")
+
+	return cmd
+}
+
+func writeSecrets(w io.Writer, secrets []config.SecretInfo, reveal bool) error {
+	if len(secrets) == 0 {
+		_, err := fmt.Fprintln(w, "The chosen module configs have no secrets.")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	header := "VARNAME\tMODULE\tPROVIDER\tCACHED\tAGE\tEXPIRES"
+	if reveal {
+		header += "\tVALUE"
+	}
+	fmt.Fprintln(tw, header)
+
+	for _, s := range secrets {
+		varname := s.VarName
+		if varname == "" {
+			varname = "(parse)"
+		}
+		cached, age, expires := "never", "-", "-"
+		if s.Cacheable {
+			cached = "no"
+		}
+		if s.Cached {
+			cached = "yes"
+			if s.Expired() {
+				cached = "expired"
+			}
+			age = time.Since(s.CachedAt).Round(time.Second).String()
+			expires = "with passphrase"
+			if !s.Expires.IsZero() {
+				expires = s.Expires.Format("2006-01-02 15:04:05")
+			}
+		}
+		line := fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s", varname, s.Module, s.Provider, cached, age, expires)
+		if reveal {
+			line += "\t" + strconv.Quote(s.Value)
+		}
+		fmt.Fprintln(tw, line)
+	}
+	return tw.Flush()
+}
+
+func init() {
+	AddCommandBuilder(newSecretsCommand)
+}
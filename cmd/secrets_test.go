@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/get-bridge/muss/config"
+	"github.com/get-bridge/muss/testutil"
+)
+
+func TestSecretsCommand(t *testing.T) {
+	testutil.WithTempDir(t, func(tmpdir string) {
+		os.Setenv("MUSS_TEST_PASSPHRASE", "howdy")
+		defer os.Unsetenv("MUSS_TEST_PASSPHRASE")
+
+		// Load the project file so that the cache is specific to the tempdir.
+		testutil.WriteFile(t, "muss.yaml", `
+secret_passphrase: $MUSS_TEST_PASSPHRASE
+module_definitions:
+  - name: app
+    configs:
+      sole:
+        secrets:
+          MUSS_TEST_SECRET: {exec: [echo, shh]}
+          MUSS_TEST_OTHER: {exec: [echo, "it's"]}
+`)
+		cfg, err := config.NewConfigFromDefaultFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Run("list", func(t *testing.T) {
+			stdout, stderr, err := runTestCommand(cfg, []string{"secrets", "list"})
+			assert.Nil(t, err)
+			assert.Equal(t, "", stderr)
+			assert.Equal(t, `VARNAME           MODULE  PROVIDER  CACHED  AGE  EXPIRES
+MUSS_TEST_OTHER   app     exec      no      -    -
+MUSS_TEST_SECRET  app     exec      no      -    -
+`, stdout)
+		})
+
+		t.Run("refresh", func(t *testing.T) {
+			stdout, _, err := runTestCommand(cfg, []string{"secrets", "refresh", "MUSS_TEST_SECRET"})
+			assert.Nil(t, err)
+			assert.Regexp(t, regexp.MustCompile(`\nMUSS_TEST_SECRET  app     exec      yes     \d+s +with passphrase\n$`), stdout)
+			assert.NotContains(t, stdout, "shh")
+
+			_, _, err = runTestCommand(cfg, []string{"secrets", "refresh", "MUSS_TEST_NOPE"})
+			assert.EqualError(t, err, "no secret sets 'MUSS_TEST_NOPE'")
+		})
+
+		t.Run("list reveal", func(t *testing.T) {
+			stdout, _, err := runTestCommand(cfg, []string{"secrets", "list", "--reveal"})
+			assert.Nil(t, err)
+			assert.Regexp(t, regexp.MustCompile(`^VARNAME +MODULE +PROVIDER +CACHED +AGE +EXPIRES +VALUE
+MUSS_TEST_OTHER +app +exec +no +- +- +"it's"
+MUSS_TEST_SECRET +app +exec +yes +\d+s +with passphrase +"shh"
+$`), stdout)
+		})
+
+		t.Run("clear", func(t *testing.T) {
+			stdout, _, err := runTestCommand(cfg, []string{"secrets", "clear"})
+			assert.Nil(t, err)
+			assert.Equal(t, "Removed 2 cached secrets from the project.\n", stdout)
+		})
+	})
+
+	t.Run("clear removes secret files", func(t *testing.T) {
+		testutil.WithTempDir(t, func(tmpdir string) {
+			os.Setenv("MUSS_TEST_DB_PASS", "open sesame")
+			defer os.Unsetenv("MUSS_TEST_DB_PASS")
+
+			testutil.WriteFile(t, "muss.yaml", `
+module_definitions:
+  - name: app
+    configs:
+      sole:
+        services:
+          app: {image: app, secrets: [DB_PASS]}
+        secrets:
+          DB_PASS: {env: [MUSS_TEST_DB_PASS], as: file}
+`)
+			cfg, err := config.NewConfigFromDefaultFile()
+			if err != nil {
+				t.Fatal(err)
+			}
+			testutil.CaptureStderr(t, func() {
+				if _, err := cfg.Env(true); err != nil {
+					t.Fatal(err)
+				}
+			})
+
+			dc, err := cfg.ComposeConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			file := subMap(dc, "secrets", "DB_PASS")["file"].(string)
+			assert.Equal(t, "open sesame", testutil.ReadFile(t, file))
+
+			_, _, err = runTestCommand(cfg, []string{"secrets", "clear"})
+			assert.Nil(t, err)
+
+			_, err = os.Stat(file)
+			assert.True(t, os.IsNotExist(err), "secret file removed")
+		})
+	})
+}
@@ -64,7 +64,10 @@ If you want to force Compose to stop and recreate all containers, use the
 
 			stopAfter := true
 
-			delegator := cmdDelegator(cmd)
+			delegator, err := cmdDelegator(cmd)
+			if err != nil {
+				return err
+			}
 			err = delegator.FilterStderr(newDCErrorFilter(cfg))
 			if err != nil {
 				return err
@@ -11,6 +11,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/get-bridge/muss/proc"
+	"github.com/get-bridge/muss/testutil"
 )
 
 func TestWrapCommand(t *testing.T) {
@@ -94,6 +95,51 @@ func TestWrapCommand(t *testing.T) {
 			assert.Equal(t, "sh\n", stdout, "defaults to $SHELL")
 		})
 
+		t.Run("redact secrets", func(t *testing.T) {
+			os.Unsetenv("MUSS_TEST_SECRET")
+			defer os.Unsetenv("MUSS_TEST_SECRET")
+			os.Setenv("MUSS_TEST_SOURCE", "hush-hush")
+			defer os.Unsetenv("MUSS_TEST_SOURCE")
+
+			cfg := newTestConfig(t, map[string]interface{}{
+				"module_definitions": []map[string]interface{}{
+					{
+						"name": "app",
+						"configs": map[string]interface{}{
+							"sole": map[string]interface{}{
+								"secrets": map[string]interface{}{
+									"MUSS_TEST_SECRET": map[string]interface{}{
+										"env": []string{"MUSS_TEST_SOURCE"},
+									},
+								},
+							},
+						},
+					},
+				},
+			})
+			testutil.CaptureStderr(t, func() {
+				if _, err := cfg.Env(true); err != nil {
+					t.Fatal(err)
+				}
+			})
+
+			args := []string{"wrap", "-c", `echo "token=$MUSS_TEST_SECRET"; printf "$MUSS_TEST_SECRET" | base64 >&2`}
+			stdout, stderr, err := runTestCommand(cfg, args)
+			assert.Nil(t, err)
+			assert.Equal(t, "token=********\n", stdout)
+			assert.Equal(t, "********\n", stderr)
+
+			stdout, _, err = runTestCommand(cfg, append([]string{"--no-redact"}, args...))
+			assert.Nil(t, err)
+			assert.Equal(t, "token=hush-hush\n", stdout, "opt out with flag")
+
+			os.Setenv("MUSS_NO_REDACT", "1")
+			defer os.Unsetenv("MUSS_NO_REDACT")
+			stdout, _, err = runTestCommand(cfg, args)
+			assert.Nil(t, err)
+			assert.Equal(t, "token=hush-hush\n", stdout, "opt out with env var")
+		})
+
 		t.Run("usage errors", func(t *testing.T) {
 
 			assert.Contains(t, errFromWrapCmd(t, "-c", "echo", "--exec"),
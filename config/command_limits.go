@@ -0,0 +1,74 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// defaultRetryBackoff is the delay before the first retry
+// if retry_backoff isn't set (it doubles for each retry after that).
+const defaultRetryBackoff = time.Second
+
+// commandLimits are the timeout and retries for a secret or env command.
+type commandLimits struct {
+	timeout time.Duration
+	retries int
+	backoff time.Duration
+}
+
+func parseCommandLimits(timeout string, retries int, backoff string) (commandLimits, error) {
+	limits := commandLimits{retries: retries, backoff: defaultRetryBackoff}
+	if retries < 0 {
+		return limits, fmt.Errorf("retries must not be negative, found %d", retries)
+	}
+	if timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return limits, fmt.Errorf("invalid timeout: %w", err)
+		}
+		limits.timeout = d
+	}
+	if backoff != "" {
+		d, err := time.ParseDuration(backoff)
+		if err != nil {
+			return limits, fmt.Errorf("invalid retry_backoff: %w", err)
+		}
+		limits.backoff = d
+	}
+	return limits, nil
+}
+
+// run calls the function (with a context that is done after the timeout)
+// until it succeeds or the retries are used up.
+// The label names what timed out in the error.
+func (l commandLimits) run(label string, f func(context.Context) ([]byte, error)) ([]byte, error) {
+	delay := l.backoff
+	for attempt := 1; ; attempt++ {
+		value, err := l.attempt(f)
+		if err == nil {
+			return value, nil
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("%s timed out after %s", label, l.timeout)
+		}
+		if attempt > l.retries {
+			if l.retries > 0 {
+				err = fmt.Errorf("%w (%d attempts)", err, attempt)
+			}
+			return nil, err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (l commandLimits) attempt(f func(context.Context) ([]byte, error)) ([]byte, error) {
+	if l.timeout == 0 {
+		return f(context.Background())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+	defer cancel()
+	return f(ctx)
+}
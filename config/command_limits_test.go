@@ -0,0 +1,110 @@
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/get-bridge/muss/testutil"
+)
+
+func TestCommandLimits(t *testing.T) {
+	t.Run("parse", func(t *testing.T) {
+		limits, err := parseCommandLimits("", 0, "")
+		assert.Nil(t, err)
+		assert.Equal(t, commandLimits{backoff: defaultRetryBackoff}, limits, "defaults")
+
+		limits, err = parseCommandLimits("1m", 2, "10ms")
+		assert.Nil(t, err)
+		assert.Equal(t, commandLimits{timeout: time.Minute, retries: 2, backoff: 10 * time.Millisecond}, limits)
+
+		_, err = parseCommandLimits("soon", 0, "")
+		assert.EqualError(t, err, `invalid timeout: time: invalid duration "soon"`)
+		_, err = parseCommandLimits("", 0, "later")
+		assert.EqualError(t, err, `invalid retry_backoff: time: invalid duration "later"`)
+		_, err = parseCommandLimits("", -1, "")
+		assert.EqualError(t, err, "retries must not be negative, found -1")
+	})
+
+	t.Run("retries", func(t *testing.T) {
+		testutil.WithTempDir(t, func(tmpdir string) {
+			// Fails until the third attempt.
+			script := `n=$(cat count 2>/dev/null || echo 0); n=$((n+1)); echo $n > count; [ $n -ge 3 ] && echo ok`
+			e := &EnvCommand{Exec: []string{"sh", "-c", script}, Retries: 1, RetryBackoff: "1ms"}
+
+			_, err := e.Value()
+			assert.EqualError(t, err, "command failed: exit status 1 (2 attempts)")
+
+			e.Retries = 2
+			testutil.WriteFile(t, "count", "0")
+			start := time.Now()
+			value, err := e.Value()
+			assert.Nil(t, err)
+			assert.Equal(t, "ok", string(value))
+			assert.True(t, time.Since(start) >= 3*time.Millisecond, "backoff doubles")
+		})
+	})
+
+	t.Run("env command timeout", func(t *testing.T) {
+		e := &EnvCommand{Exec: []string{"sh", "-c", "sleep 10 & wait"}, Timeout: "100ms"}
+		start := time.Now()
+		_, err := e.Value()
+		assert.EqualError(t, err, "env command 'sh -c sleep 10 & wait' timed out after 100ms")
+		assert.True(t, time.Since(start) < 5*time.Second, "killed")
+
+		e.Timeout = "nope"
+		_, err = e.Value()
+		assert.EqualError(t, err, `invalid timeout: time: invalid duration "nope"`)
+	})
+
+	t.Run("secret timeout", func(t *testing.T) {
+		cfg := &ProjectConfig{
+			SecretCommands: map[string]*SecretCommand{
+				"slow": {
+					Exec:    []string{"sleep"},
+					Cache:   "none",
+					Timeout: "100ms",
+					Retries: 3,
+				},
+			},
+		}
+		s, err := parseSecret(cfg, map[string]interface{}{
+			"varname":       "MUSS_TEST_SLOW",
+			"slow":          []string{"10"},
+			"retries":       1,
+			"retry_backoff": "1ms",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.module = "app"
+		assert.Equal(t, commandLimits{timeout: 100 * time.Millisecond, retries: 1, backoff: time.Millisecond}, s.limits, "spec overrides command")
+
+		_, err = s.Value()
+		assert.EqualError(t, err, "secret MUSS_TEST_SLOW (app) timed out after 100ms (2 attempts)")
+
+		_, err = parseSecret(cfg, map[string]interface{}{
+			"varname": "MUSS_TEST_SLOW",
+			"slow":    []string{"10"},
+			"timeout": "never",
+		})
+		assert.EqualError(t, err, `secret 'slow': invalid timeout: time: invalid duration "never"`)
+	})
+
+	t.Run("providers without context", func(t *testing.T) {
+		p := &testSecretProvider{value: func() ([]byte, error) {
+			time.Sleep(time.Second)
+			return []byte("late"), nil
+		}}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := providerValue(ctx, p, nil)
+		assert.Equal(t, context.DeadlineExceeded, err, "abandoned")
+
+		value, err := providerValue(context.Background(), p, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, "late", string(value))
+	})
+}
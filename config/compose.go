@@ -54,10 +54,13 @@ func (cfg *ProjectConfig) FilesToGenerate() (FileGenMap, error) {
 
 // ComposeFilePath returns the path of the target compose file.
 func (cfg *ProjectConfig) ComposeFilePath() string {
-	if cfg != nil && cfg.ComposeFile != "" {
-		return cfg.ComposeFile
+	if cfg == nil {
+		return "docker-compose.yml"
 	}
-	return "docker-compose.yml"
+	if cfg.ComposeFile != "" {
+		return cfg.projectPath(cfg.ComposeFile)
+	}
+	return cfg.projectPath("docker-compose.yml")
 }
 
 // parseModuleDefinitions iterates the ProjectConfig.ModuleDefinitions
@@ -67,7 +70,11 @@ func (cfg *ProjectConfig) ComposeFilePath() string {
 func (cfg *ProjectConfig) parseModuleDefinitions() (err error) {
 	defer func() {
 		if r := recover(); r != nil {
-			err = r.(error)
+			if e, ok := r.(error); ok {
+				err = fmt.Errorf("failed to merge module configs: %w", e)
+			} else {
+				err = fmt.Errorf("failed to merge module configs: %v", r)
+			}
 		}
 	}()
 
@@ -78,17 +85,40 @@ func (cfg *ProjectConfig) parseModuleDefinitions() (err error) {
 	files := make(FileGenMap)
 	secrets := make([]envLoader, 0)
 
-	for _, module := range cfg.ModuleDefinitions {
-		servconf, err := module.chooseConfig(cfg)
-		if err != nil {
+	configs := make([]map[string]interface{}, len(cfg.ModuleDefinitions))
+	layers := make([]mergeLayer, 0)
+	// Report the problems in every included file at once.
+	var invalid ValidationErrors
+	for i, module := range cfg.ModuleDefinitions {
+		servconf, moduleLayers, err := module.chooseConfig(cfg)
+		if errs, ok := err.(ValidationErrors); ok {
+			invalid = append(invalid, errs...)
+			continue
+		} else if err != nil {
 			return err
 		}
+		configs[i] = servconf
+		layers = append(layers, moduleLayers...)
+	}
+	if err := invalid.errorOrNil(); err != nil {
+		return err
+	}
+
+	if err := checkModuleDependencies(cfg, cfg.ModuleDefinitions, configs); err != nil {
+		return err
+	}
+
+	for i, servconf := range configs {
+		if servconf == nil {
+			continue
+		}
 
 		secretsToParse := make([]map[string]interface{}, 0)
 		if s, ok := servconf["secrets"]; ok {
 
 			if mapsi, ok := s.(map[string]interface{}); ok {
-				for varname, spec := range mapsi {
+				for _, varname := range sortedKeys(mapsi) {
+					spec := mapsi[varname]
 					if val, ok := spec.(map[string]interface{}); ok {
 						secretsToParse = append(secretsToParse, mapMerge(map[string]interface{}{"varname": varname}, val))
 					} else {
@@ -105,22 +135,48 @@ func (cfg *ProjectConfig) parseModuleDefinitions() (err error) {
 				}
 			}
 
+			composeSecrets := make(map[string]interface{})
 			for _, spec := range secretsToParse {
 				parsed, err := parseSecret(cfg, spec)
 				if err != nil {
 					return err
 				}
+				parsed.module = cfg.ModuleDefinitions[i].Name
 				secrets = append(secrets, parsed)
+				if parsed.asFile {
+					composeSecrets[parsed.Varname] = map[string]interface{}{"file": parsed.secretFile()}
+				}
 			}
 
 			delete(servconf, "secrets")
+
+			// Secrets as files are compose secrets
+			// (only in /run/secrets of the services that list them).
+			if len(composeSecrets) > 0 {
+				servconf["secrets"] = composeSecrets
+			}
 		}
 
 		dcc = mapMerge(dcc, servconf)
 	}
 
-	if cfg.User != nil && cfg.User.Override != nil {
-		dcc = mapMerge(dcc, cfg.User.Override)
+	for _, user := range cfg.userLayers() {
+		if user.config.Override != nil {
+			path := "override"
+			if user.source.Section != "" {
+				path = user.source.Section + ".override"
+			}
+			value, err := envInterpolation(true).interpolateValue(user.config.Override, path)
+			if err != nil {
+				return inFile(user.source.File, err)
+			}
+			override := value.(map[string]interface{})
+			dcc = mapMerge(dcc, override)
+			layers = append(layers, mergeLayer{
+				source: user.source,
+				values: override,
+			})
+		}
 	}
 
 	// Iterate over each service to remove any muss extensions
@@ -133,8 +189,9 @@ func (cfg *ProjectConfig) parseModuleDefinitions() (err error) {
 				if err != nil {
 					return err
 				}
+				// Relative sources are relative to the project dir.
 				for path, fn := range bindvols {
-					files[path] = fn
+					files[cfg.projectPath(path)] = fn
 				}
 
 				if !isValidService(service) {
@@ -154,6 +211,7 @@ func (cfg *ProjectConfig) parseModuleDefinitions() (err error) {
 	// If we haven't returned any errors it's safe to update the value.
 
 	cfg.composeConfig = dcc
+	cfg.mergeLayers = layers
 	cfg.filesToGenerate = files
 	cfg.Secrets = append(cfg.Secrets, secrets...)
 
@@ -234,18 +292,30 @@ func iterateBindMounts(service map[string]interface{}, f func(string, string, ma
 		for _, volume := range volumes {
 			if v, ok := volume.(map[string]interface{}); ok {
 				if v["type"] == "bind" {
-					source, err := homedir.Expand(expand(v["source"].(string)))
+					source, err := expand(v["source"].(string))
+					if err != nil {
+						return err
+					}
+					source, err = homedir.Expand(source)
 					if err != nil {
 						return err
 					}
 					f(source, v["target"].(string), v)
 				}
 			} else if v, ok := volume.(string); ok {
-				expanded, err := homedir.Expand(expand(v))
+				expanded, err := expand(v)
+				if err != nil {
+					return err
+				}
+				expanded, err = homedir.Expand(expanded)
 				if err != nil {
 					return err
 				}
 				parts := strings.Split(expanded, ":")
+				// An anonymous volume (just a target) isn't a bind mount.
+				if len(parts) < 2 {
+					continue
+				}
 				source, target := parts[0], parts[1]
 				// We could fake the volume long-syntax map here but we don't currently need it.
 				f(source, target, nil)
@@ -258,38 +328,154 @@ func iterateBindMounts(service map[string]interface{}, f func(string, string, ma
 
 var keysToOverwrite = []string{"entrypoint", "command"}
 
+// mergeDirectiveKey can be added to any map in a module config or the user
+// override to control how it is merged onto the config beneath it.
+// The value can be "replace" to replace the whole map
+// or a map of sibling keys to "replace", "remove", or "merge".
+const mergeDirectiveKey = "x-muss-merge"
+
+var mergeDirectives = []string{"merge", "remove", "replace"}
+
 func mapMerge(target map[string]interface{}, source map[string]interface{}) map[string]interface{} {
+	return mapMergeAt(target, source, nil)
+}
+
+// mapMergeAt merges the maps found at the path (the keys leading to them)
+// so that service values can be merged according to compose semantics.
+func mapMergeAt(target map[string]interface{}, source map[string]interface{}, at []string) map[string]interface{} {
+	directives, replace := parseMergeDirectives(source)
+	if replace {
+		target = nil
+	}
+
 	result := make(map[string]interface{}, len(target)+len(source))
 	for k, v := range target {
 		result[k] = v
 	}
 	for k, v := range source {
-		if !mapMergeOverwrites(k) {
-			if current, ok := result[k]; ok {
-				if m, ok := current.(map[string]interface{}); ok {
-					result[k] = mapMerge(m, v.(map[string]interface{}))
-					continue
-				} else if s, ok := current.([]interface{}); ok {
-					vs := v.([]interface{})
-					tmp := make([]interface{}, 0, len(s)+len(vs))
-					tmp = append(tmp, s...)
-					tmp = append(tmp, vs...)
-					result[k] = tmp
-					continue
+		if k == mergeDirectiveKey {
+			continue
+		}
+
+		switch directives[k] {
+		case "remove":
+			panic(fmt.Errorf("invalid %s: '%s' is removed but also has a value", mergeDirectiveKey, k))
+		case "replace":
+			// Skip merging.
+		default:
+			if directives[k] == "merge" || !mapMergeOverwrites(k) {
+				if current, ok := result[k]; ok {
+					if merge := serviceValueMerger(at, k); merge != nil {
+						result[k] = merge(k, current, v)
+						continue
+					} else if m, ok := current.(map[string]interface{}); ok {
+						result[k] = mapMergeAt(m, v.(map[string]interface{}), appendPath(at, k))
+						continue
+					} else if s, ok := current.([]interface{}); ok {
+						vs := v.([]interface{})
+						tmp := make([]interface{}, 0, len(s)+len(vs))
+						tmp = append(tmp, s...)
+						tmp = append(tmp, vs...)
+						result[k] = tmp
+						continue
+					}
 				}
 			}
 		}
 
-		// Break the reference for any maps that we copy over.
+		// Break the reference for any maps that we copy over
+		// (and apply any directives they contain).
 		if vmap, ok := v.(map[string]interface{}); ok {
-			result[k] = mapMerge(map[string]interface{}{}, vmap)
+			result[k] = mapMergeAt(map[string]interface{}{}, vmap, appendPath(at, k))
 		} else {
 			result[k] = v
 		}
 	}
+	for k, d := range directives {
+		if d == "remove" {
+			delete(result, k)
+		}
+	}
+	return result
+}
+
+// mergeIncludes merges a config onto its includes like mapMerge
+// but keeps the directives of both in the result so that they also apply
+// to the modules beneath it (just as they would without an include).
+func mergeIncludes(base, config map[string]interface{}) map[string]interface{} {
+	return keepMergeDirectives(mapMerge(base, config), base, config)
+}
+
+// keepMergeDirectives returns the merged map with the combined directives
+// of the maps (at the same paths) that it was merged from.
+func keepMergeDirectives(merged, base, config map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(merged))
+	for k, v := range merged {
+		if m, ok := v.(map[string]interface{}); ok {
+			baseMap, _ := base[k].(map[string]interface{})
+			configMap, _ := config[k].(map[string]interface{})
+			v = keepMergeDirectives(m, baseMap, configMap)
+		}
+		result[k] = v
+	}
+	delete(result, mergeDirectiveKey)
+	if directives := combineMergeDirectives(base, config); directives != nil {
+		result[mergeDirectiveKey] = directives
+	}
 	return result
 }
 
+// combineMergeDirectives returns the directives that have the same effect
+// on the maps beneath the base as merging the base and then the config.
+func combineMergeDirectives(base, config map[string]interface{}) interface{} {
+	baseDirectives, baseReplace := parseMergeDirectives(base)
+	directives, replace := parseMergeDirectives(config)
+	if baseReplace || replace {
+		return "replace"
+	}
+	if baseDirectives == nil && directives == nil {
+		return nil
+	}
+	result := make(map[string]interface{}, len(baseDirectives)+len(directives))
+	for k, d := range baseDirectives {
+		// A key removed beneath the config but set by it replaces the value.
+		if _, ok := config[k]; ok && d == "remove" {
+			d = "replace"
+		}
+		result[k] = d
+	}
+	for k, d := range directives {
+		result[k] = d
+	}
+	return result
+}
+
+// parseMergeDirectives returns the directive for each key of the map
+// (or true if the whole map should replace the one beneath it).
+// Since it is called while merging an invalid value will panic.
+func parseMergeDirectives(m map[string]interface{}) (map[string]string, bool) {
+	value, ok := m[mergeDirectiveKey]
+	if !ok {
+		return nil, false
+	}
+	if value == "replace" {
+		return nil, true
+	}
+	directives, ok := value.(map[string]interface{})
+	if !ok {
+		panic(fmt.Errorf("invalid %s: must be 'replace' or a map of keys to one of: %s", mergeDirectiveKey, strings.Join(mergeDirectives, ", ")))
+	}
+	result := make(map[string]string, len(directives))
+	for k, d := range directives {
+		directive, _ := d.(string)
+		if !containsString(mergeDirectives, directive) {
+			panic(fmt.Errorf("invalid %s for '%s': must be one of: %s", mergeDirectiveKey, k, strings.Join(mergeDirectives, ", ")))
+		}
+		result[k] = directive
+	}
+	return result, false
+}
+
 func mapMergeOverwrites(k string) bool {
 	for _, o := range keysToOverwrite {
 		if o == k {
@@ -308,13 +494,13 @@ func (cfg *ProjectConfig) composeFileBytes(dcc map[string]interface{}) ([]byte,
 	content := []byte(`#
 # THIS FILE IS GENERATED!
 #
-# To add new module definition files edit ` + cfg.ProjectFile + `.
+# To add new module definition files edit ` + cfg.projectRelativePath(cfg.ProjectFile) + `.
 #
 `)
 
 	if cfg.UserFile != "" {
 		content = append(content,
-			[]byte(fmt.Sprintf("# To configure the modules you want to use edit %v.\n#\n", cfg.UserFile))...)
+			[]byte(fmt.Sprintf("# To configure the modules you want to use edit %v.\n#\n", cfg.projectRelativePath(cfg.UserFile)))...)
 	}
 
 	content = append(content, []byte("\n---\n")...)
@@ -0,0 +1,201 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// serviceValueMerger returns the function to merge the value of the key
+// if the path leads to a service ("services.NAME") and compose identifies
+// the items of the value by something other than their position
+// (so that the result doesn't have duplicates that compose would reject).
+func serviceValueMerger(at []string, key string) func(string, interface{}, interface{}) interface{} {
+	if len(at) != 2 || at[0] != "services" {
+		return nil
+	}
+	switch key {
+	case "environment", "labels":
+		return mergeKeyValues("=")
+	case "extra_hosts":
+		return mergeKeyValues(":")
+	case "ports":
+		return mergeListBy(portKey)
+	case "volumes":
+		return mergeListBy(volumeKey)
+	}
+	return nil
+}
+
+// appendPath returns a new path so that siblings don't share a backing array.
+func appendPath(at []string, key string) []string {
+	path := make([]string, len(at), len(at)+1)
+	copy(path, at)
+	return append(path, key)
+}
+
+// mergeListBy returns a function that appends the items of a list
+// except that an item with the same identity as an existing item
+// will replace it (in the same position).
+// Items without an identity are always appended.
+// A nil value (a key without a value) is treated as an empty list.
+func mergeListBy(identity func(interface{}) string) func(string, interface{}, interface{}) interface{} {
+	return func(key string, current, value interface{}) interface{} {
+		if current == nil || value == nil {
+			return nonNil(value, current)
+		}
+		currentList, ok := current.([]interface{})
+		valueList, ok2 := value.([]interface{})
+		if !ok || !ok2 {
+			panic(fmt.Errorf("invalid '%s' for service: must be a list", key))
+		}
+
+		result := make([]interface{}, 0, len(currentList)+len(valueList))
+		index := make(map[string]int, len(currentList))
+		for _, item := range currentList {
+			if id := identity(item); id != "" {
+				index[id] = len(result)
+			}
+			result = append(result, item)
+		}
+		for _, item := range valueList {
+			id := identity(item)
+			if i, ok := index[id]; ok && id != "" {
+				result[i] = item
+				continue
+			}
+			if id != "" {
+				index[id] = len(result)
+			}
+			result = append(result, item)
+		}
+		return result
+	}
+}
+
+// nonNil returns the value unless it is nil.
+func nonNil(value, fallback interface{}) interface{} {
+	if value == nil {
+		return fallback
+	}
+	return value
+}
+
+// volumeKey returns the container path of a volume.
+func volumeKey(volume interface{}) string {
+	switch v := volume.(type) {
+	case map[string]interface{}:
+		if target, ok := v["target"].(string); ok {
+			return target
+		}
+	case string:
+		parts := strings.Split(v, ":")
+		// An anonymous volume is just the target.
+		if len(parts) == 1 {
+			return parts[0]
+		}
+		return parts[1]
+	}
+	return ""
+}
+
+// portKey returns the container port (or range) and protocol of a port.
+func portKey(port interface{}) string {
+	switch p := port.(type) {
+	case map[string]interface{}:
+		target, ok := p["target"]
+		if !ok {
+			return ""
+		}
+		protocol, _ := p["protocol"].(string)
+		if protocol == "" {
+			protocol = "tcp"
+		}
+		return fmt.Sprintf("%v/%s", target, protocol)
+	case int:
+		return fmt.Sprintf("%d/tcp", p)
+	case string:
+		protocol := "tcp"
+		if i := strings.LastIndex(p, "/"); i >= 0 {
+			protocol = p[i+1:]
+			p = p[:i]
+		}
+		// The container port is last (after any host ip and port).
+		parts := strings.Split(p, ":")
+		return parts[len(parts)-1] + "/" + protocol
+	}
+	return ""
+}
+
+// mergeKeyValues returns a function that merges values that compose
+// accepts as either a map or a list of "KEY<sep>VALUE" strings.
+// The values are merged by key; the result will be a list if both are lists
+// (with any replaced items in their original position) or a map otherwise.
+// A nil value (a key without a value) is treated as empty.
+func mergeKeyValues(sep string) func(string, interface{}, interface{}) interface{} {
+	return func(key string, current, value interface{}) interface{} {
+		if current == nil || value == nil {
+			return nonNil(value, current)
+		}
+		keys, values, isList := keyValues(key, current, sep)
+
+		// Merge maps like any other (so that merge directives work).
+		if valueMap, ok := value.(map[string]interface{}); ok {
+			return mapMerge(values, valueMap)
+		}
+
+		valueKeys, valueValues, _ := keyValues(key, value, sep)
+		for _, k := range valueKeys {
+			if _, ok := values[k]; !ok {
+				keys = append(keys, k)
+			}
+			values[k] = valueValues[k]
+		}
+
+		if !isList {
+			return values
+		}
+		result := make([]interface{}, len(keys))
+		for i, k := range keys {
+			if v := values[k]; v != nil {
+				result[i] = fmt.Sprintf("%s%s%v", k, sep, v)
+			} else {
+				result[i] = k
+			}
+		}
+		return result
+	}
+}
+
+// keyValues returns the keys (in order) and values of a map or list.
+// A list item without the separator has a nil value
+// (like a map key without a value).
+func keyValues(key string, value interface{}, sep string) ([]string, map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := sortedKeys(v)
+		values := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			values[k] = item
+		}
+		return keys, values, false
+	case []interface{}:
+		keys := make([]string, 0, len(v))
+		values := make(map[string]interface{}, len(v))
+		for _, item := range v {
+			str, ok := item.(string)
+			if !ok {
+				panic(fmt.Errorf("invalid '%s' for service: list items must be strings, found %#v", key, item))
+			}
+			k, val := str, interface{}(nil)
+			if i := strings.Index(str, sep); i >= 0 {
+				k, val = str[:i], str[i+len(sep):]
+			}
+			if _, ok := values[k]; !ok {
+				keys = append(keys, k)
+			}
+			values[k] = val
+		}
+		return keys, values, true
+	}
+	panic(fmt.Errorf("invalid '%s' for service: must be a map or a list", key))
+}
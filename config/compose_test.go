@@ -270,6 +270,83 @@ module_definitions:
 			actualVarNames)
 	})
 
+	t.Run("secrets as files", func(t *testing.T) {
+		setCacheRoot("/tmp/.muss-test-cache")
+
+		projectConfig := assertComposed(t,
+			`
+module_definitions:
+- name: one
+  configs:
+    sole:
+      services:
+        app:
+          image: app
+          secrets: [other, DB_PASS]
+        worker:
+          image: worker
+      secrets:
+        DB_PASS:
+          env: [MUSS_TEST_DB_PASS]
+          as: file
+        API_KEY:
+          env: [MUSS_TEST_API_KEY]
+          as: env
+- name: two
+  configs:
+    sole:
+      services:
+        db:
+          image: db
+`,
+			`
+version: '3.7'
+secrets:
+  DB_PASS:
+    file: `+secretFileDir+`/DB_PASS
+services:
+  app:
+    image: app
+    secrets: [other, DB_PASS]
+  worker:
+    image: worker
+  db:
+    image: db
+`,
+			"compose secrets only for the services that list them",
+		)
+
+		if assert.Equal(t, 2, len(projectConfig.Secrets)) {
+			assert.Equal(t, "API_KEY", projectConfig.Secrets[0].VarName())
+			assert.False(t, projectConfig.Secrets[0].(*secretCmd).asFile)
+			assert.True(t, projectConfig.Secrets[1].(*secretCmd).asFile)
+		}
+
+		assertConfigError(t, `
+module_definitions:
+- name: one
+  configs:
+    sole:
+      secrets:
+        - env: [MUSS_TEST_DB_PASS]
+          parse: true
+          as: file
+`,
+			"secret 'env' as a file needs a varname (and can't parse)")
+
+		assertConfigError(t, `
+module_definitions:
+- name: one
+  configs:
+    sole:
+      secrets:
+        DB_PASS:
+          env: [MUSS_TEST_DB_PASS]
+          as: volume
+`,
+			`secret "as" must be "env" or "file", found "volume"`)
+	})
+
 	t.Run("include errors", func(t *testing.T) {
 		assertConfigError(t, `
 module_definitions:
@@ -322,6 +399,137 @@ module_definitions:
 `,
 			"failed to read 'no-file.txt': open no-file.txt: no such file",
 			"bad include type")
+
+		assertConfigError(t, `
+module_definitions:
+- name: one
+  configs:
+    _a:
+      include: [_b]
+    _b:
+      include: [_a]
+    sole:
+      include: [_a]
+`,
+			"invalid 'include'; cycle detected: sole -> _a -> _b -> _a",
+			"include cycle")
+
+		assertConfigError(t, `
+module_definitions:
+- name: one
+  configs:
+    sole:
+      include: [sole]
+`,
+			"invalid 'include'; cycle detected: sole -> sole",
+			"config includes itself")
+
+		testutil.WithTempDir(t, func(tmpdir string) {
+			testutil.WriteFile(t, "loop.yml", `
+include:
+  - file: loop.yml
+`)
+
+			assertConfigError(t, `
+module_definitions:
+- name: one
+  configs:
+    sole:
+      include:
+        - file: loop.yml
+`,
+				"invalid 'include'; cycle detected: sole -> file:loop.yml -> file:loop.yml",
+				"file include cycle")
+		})
+	})
+
+	t.Run("module dependencies", func(t *testing.T) {
+		modules := `
+module_definitions:
+- name: app
+  requires: [store]
+  configs:
+    sole:
+      services:
+        app: {image: alpine}
+- name: store
+  configs:
+    sole:
+      services:
+        store: {image: alpine}
+- name: cache
+  configs:
+    _base:
+      requires: [app]
+    memory:
+      include: [_base]
+      conflicts: [store]
+      services:
+        cache: {image: alpine}
+    redis:
+      include: [_base]
+      services:
+        cache: {image: redis}
+`
+
+		assertComposed(t, modules+`
+user: {module_order: [redis]}
+`,
+			"{version: '3.7', services: {app: {image: alpine}, store: {image: alpine}, cache: {image: redis}}}",
+			"requirements met and config keys removed")
+
+		assertConfigError(t, modules+`
+user:
+  module_order: [redis]
+  modules:
+    store: {disabled: true}
+`,
+			"module 'app' requires module 'store' which is disabled",
+			"module requires disabled module")
+
+		assertConfigError(t, modules+`
+user:
+  module_order: [redis]
+  modules:
+    app: {disabled: true}
+`,
+			"module 'cache' requires module 'app' which is disabled",
+			"included config requires disabled module")
+
+		assertComposed(t, modules+`
+user:
+  modules:
+    app: {disabled: true}
+    store: {disabled: true}
+`,
+			"{version: '3.7'}",
+			"no config chosen for cache so it requires nothing")
+
+		assertConfigError(t, modules+`
+user: {module_order: [memory]}
+`,
+			"module 'cache' conflicts with module 'store'; disable one of them",
+			"config conflicts with enabled module")
+
+		assertConfigError(t, `
+module_definitions:
+- name: app
+  requires: [nope]
+  configs:
+    sole: {}
+`,
+			"module 'app' requires module 'nope' which is not defined",
+			"module requires undefined module")
+
+		assertConfigError(t, `
+module_definitions:
+- name: app
+  configs:
+    sole:
+      requires: nope
+`,
+			"invalid 'requires' for module 'app'; must be a list of module names",
+			"invalid requires")
 	})
 
 	t.Run("include", func(t *testing.T) {
@@ -404,6 +612,66 @@ module_definitions:
 `,
 				"{version: '2.3', services: {app: {image: alpine:edge, init: true, tty: true, stdin_open: true}}}",
 				"include strings and file mixed")
+
+			testutil.WriteFile(t, filepath.Join("files", "nested", "inner.yml"), `
+services:
+  app:
+    init: true
+`)
+			testutil.WriteFile(t, filepath.Join("files", "nested", "outer.yml"), `
+include:
+  - _base
+  - file: inner.yml
+services:
+  app:
+    tty: true
+`)
+
+			assertComposed(t, `
+module_definitions:
+- name: one
+  file: `+filepath.Join("files", "sd.yml")+`
+  configs:
+    _base:
+      services:
+        app:
+          image: alpine
+          init: false
+    _mid:
+      include:
+        - file: nested/outer.yml
+      services:
+        app:
+          image: alpine:edge
+    sole:
+      include:
+        - _mid
+        - _base
+`,
+				"{version: '3.7', services: {app: {image: alpine, init: false, tty: true}}}",
+				"nested includes resolved recursively")
+
+			assertComposed(t, `
+module_definitions:
+- name: one
+  file: `+filepath.Join("files", "sd.yml")+`
+  configs:
+    _base:
+      services:
+        app:
+          image: alpine
+    _mid:
+      include: [_base]
+      services:
+        app:
+          init: true
+    sole:
+      include:
+        - _mid
+        - file: nested/outer.yml
+`,
+				"{version: '3.7', services: {app: {image: alpine, init: true, tty: true}}}",
+				"same config included more than once")
 		})
 
 	})
@@ -492,3 +760,353 @@ func assertPreparedVolumes(t *testing.T, service map[string]interface{}, exp Fil
 func describeFunc(v interface{}) string {
 	return fmt.Sprintf("%#v", v)
 }
+
+func TestMergeDirectives(t *testing.T) {
+	os.Unsetenv("MUSS_MODULE_ORDER")
+
+	modules := `
+module_definitions:
+- name: app
+  configs:
+    _base:
+      services:
+        app:
+          image: app
+          ports: ["3000:3000"]
+          healthcheck: {test: [CMD, check]}
+          environment: {A: "1", B: "2"}
+          entrypoint: [run]
+    sole:
+      include: [_base]
+      services:
+        app:
+          x-muss-merge: {ports: replace, healthcheck: remove, entrypoint: merge}
+          ports: ["8080:3000"]
+          environment:
+            x-muss-merge: replace
+            C: "3"
+          entrypoint: [--debug]
+- name: db
+  configs:
+    sole:
+      services:
+        db: {image: postgres, ports: ["5432:5432"]}
+`
+
+	t.Run("module config", func(t *testing.T) {
+		assertComposed(t, modules, `
+version: '3.7'
+services:
+  app:
+    image: app
+    ports: ["8080:3000"]
+    environment: {C: "3"}
+    entrypoint: [run, --debug]
+  db: {image: postgres, ports: ["5432:5432"]}
+`, "directives applied to includes")
+	})
+
+	t.Run("user override", func(t *testing.T) {
+		assertComposed(t, modules+`
+user:
+  override:
+    services:
+      x-muss-merge: {db: remove}
+      app:
+        x-muss-merge: {ports: replace}
+        ports: []
+`, `
+version: '3.7'
+services:
+  app:
+    image: app
+    ports: []
+    environment: {C: "3"}
+    entrypoint: [run, --debug]
+`, "directives applied to override")
+	})
+
+	t.Run("earlier modules", func(t *testing.T) {
+		earlier := `
+module_definitions:
+- name: web
+  configs:
+    sole:
+      services:
+        app: {image: web, ports: ["80:80"], healthcheck: {test: [CMD, web]}, environment: {W: "1"}}
+`
+		exp := `
+version: '3.7'
+services:
+  app:
+    image: app
+    ports: ["81:81"]
+    environment: {A: "1", C: "3"}
+`
+		assertComposed(t, earlier+`
+- name: app
+  configs:
+    sole:
+      services:
+        app:
+          x-muss-merge: {ports: replace, healthcheck: remove}
+          image: app
+          ports: ["81:81"]
+          environment: {x-muss-merge: replace, A: "1", C: "3"}
+`, exp, "without include")
+
+		assertComposed(t, earlier+`
+- name: app
+  configs:
+    _base:
+      services:
+        app: {image: app, ports: ["3000:3000"], environment: {A: "1", B: "2"}}
+    _checked:
+      services:
+        app:
+          x-muss-merge: {healthcheck: remove}
+    sole:
+      include: [_base, _checked]
+      services:
+        app:
+          x-muss-merge: {ports: replace}
+          ports: ["81:81"]
+          environment: {x-muss-merge: replace, A: "1", C: "3"}
+`, exp, "with include (directives apply to includes and earlier modules)")
+
+		assertComposed(t, earlier+`
+- name: app
+  configs:
+    _base:
+      services:
+        app: {x-muss-merge: {healthcheck: remove, ports: replace}, image: app, ports: ["3000:3000"]}
+    sole:
+      include: [_base]
+      services:
+        app: {healthcheck: {test: [CMD, app]}, ports: ["81:81"]}
+`, `
+version: '3.7'
+services:
+  app:
+    image: app
+    ports: ["3000:3000", "81:81"]
+    healthcheck: {test: [CMD, app]}
+    environment: {W: "1"}
+`, "included directives apply beneath the include")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		assertConfigError(t, `
+module_definitions:
+- name: app
+  configs:
+    sole:
+      services:
+        app: {x-muss-merge: {ports: remove}, ports: []}
+`,
+			"failed to merge module configs: invalid x-muss-merge: 'ports' is removed but also has a value",
+			"remove with value")
+
+		assertConfigError(t, `
+module_definitions:
+- name: app
+  configs:
+    sole:
+      services:
+        app: {x-muss-merge: {ports: drop}}
+`,
+			"failed to merge module configs: invalid x-muss-merge for 'ports': must be one of: merge, remove, replace",
+			"unknown directive")
+	})
+}
+
+func TestComposeAwareMerging(t *testing.T) {
+	os.Unsetenv("MUSS_MODULE_ORDER")
+
+	for _, rule := range []string{"volumes", "ports", "environment", "labels", "extra_hosts"} {
+		t.Run(rule, func(t *testing.T) {
+			exp := testutil.ReadFile(t, "../testdata/expectations/merge-"+rule+".yml")
+			assertComposed(t, "module_files: [../testdata/merge/"+rule+".yml]", exp, rule+" merged by key")
+		})
+	}
+
+	t.Run("modules and user override", func(t *testing.T) {
+		assertComposed(t, `
+module_files: [../testdata/merge/ports.yml, ../testdata/merge/labels.yml]
+user:
+  override:
+    services:
+      app:
+        ports: ['3002:3000']
+        labels: [com.example.owner=me]
+`, `
+version: '3.7'
+services:
+  app:
+    image: app
+    ports:
+      - '3002:3000'
+      - '8081:80/tcp'
+      - '127.0.0.1:5354:53/udp'
+      - target: 9000
+        published: 9001
+      - '5353:53'
+    labels:
+      com.example.team: core
+      com.example.tier: frontend
+      com.example.owner: me
+`, "later modules and the override merge by key too")
+	})
+
+	t.Run("nil values", func(t *testing.T) {
+		assertComposed(t, `
+module_definitions:
+- name: base
+  configs:
+    sole:
+      services:
+        app: {image: app, environment: , ports: , volumes: , labels: }
+- name: app
+  configs:
+    sole:
+      services:
+        app:
+          environment: [A=1]
+          ports: ['80:80']
+          volumes: ['./src:/src']
+          labels: {team: core}
+- name: empty
+  configs:
+    sole:
+      services:
+        app: {environment: , ports: , volumes: , labels: }
+`, `
+version: '3.7'
+services:
+  app:
+    image: app
+    environment: [A=1]
+    ports: ['80:80']
+    volumes: ['./src:/src']
+    labels: {team: core}
+`, "nil values are empty")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		assertConfigError(t, `
+module_definitions:
+- name: app
+  configs:
+    _base:
+      services:
+        app: {image: app, environment: [A=1]}
+    sole:
+      include: [_base]
+      services:
+        app: {environment: [{A: 2}]}
+`,
+			"failed to merge module configs: invalid 'environment' for service: list items must be strings, found map[string]interface {}{\"A\":2}",
+			"invalid environment")
+	})
+}
+
+func TestModuleConfigInterpolation(t *testing.T) {
+	testutil.WithTempDir(t, func(tmpdir string) {
+		os.Setenv("MUSS_TEST_VAR", "x")
+		defer os.Unsetenv("MUSS_TEST_VAR")
+		os.Setenv("MUSS_TEST_ENV", "shared")
+		defer os.Unsetenv("MUSS_TEST_ENV")
+		os.Unsetenv("MUSS_TEST_UNSET")
+
+		testutil.WriteFile(t, "shared/app.yml", `
+services:
+  app:
+    environment:
+      DOLLARS: "$$5 ${MUSS_TEST_VAR:+$$}"
+`)
+
+		config := `
+secret_passphrase: $MUSS_TEST_PASSPHRASE
+module_definitions:
+- name: app
+  configs:
+    sole:
+      include:
+        - file: ${MUSS_TEST_ENV}/app.yml
+      secrets:
+        APP_SECRET:
+          exec: [echo, "${MUSS_TEST_UNSET:-default}"]
+      services:
+        app:
+          image: "app:${MUSS_TEST_VAR}"
+          environment:
+            SECRET: ${APP_SECRET}
+            LATER: ${MUSS_TEST_UNSET:-fallback}
+            ALTERNATE: ${MUSS_TEST_VAR:+alt}
+user:
+  override:
+    services:
+      app:
+        environment:
+          USER: ${MUSS_TEST_VAR-none}
+`
+
+		cfg := assertComposed(t, config, `
+version: '3.7'
+services:
+  app:
+    image: 'app:${MUSS_TEST_VAR}'
+    environment:
+      DOLLARS: "$$5 ${MUSS_TEST_VAR:+$$}"
+      SECRET: ${APP_SECRET}
+      LATER: ${MUSS_TEST_UNSET:-fallback}
+      ALTERNATE: ${MUSS_TEST_VAR:+alt}
+      USER: ${MUSS_TEST_VAR-none}
+`, "interpolates muss keys and leaves compose values for docker-compose")
+
+		if assert.Equal(t, 1, len(cfg.Secrets)) {
+			s := cfg.Secrets[0].(*secretCmd)
+			assert.Equal(t, []string{"echo", "${MUSS_TEST_UNSET:-default}"}, s.args, "secret args are interpolated when loaded")
+
+			args, err := s.expandArgs(false)
+			assert.Nil(t, err)
+			assert.Equal(t, []string{"echo", "default"}, args)
+
+			os.Setenv("MUSS_TEST_UNSET", "later")
+			args, err = s.expandArgs(false)
+			os.Unsetenv("MUSS_TEST_UNSET")
+			assert.Nil(t, err)
+			assert.Equal(t, []string{"echo", "later"}, args, "uses vars set after the config is loaded")
+		}
+
+		assertConfigError(t, `
+module_definitions:
+- name: app
+  configs:
+    sole:
+      services:
+        app:
+          image: app
+          environment: {A: "${MUSS_TEST_VAR:?}", B: "${MUSS_TEST_VAR/x}"}
+`, "configs.sole.services.app.environment.B: Invalid interpolation format: '${MUSS_TEST_VAR/x}'")
+
+		assertConfigError(t, `
+module_definitions:
+- name: app
+  configs:
+    sole:
+      include: [{file: "${MUSS_TEST_UNSET:?is required}/app.yml"}]
+`, "configs.sole.include.0.file: Variable 'MUSS_TEST_UNSET' is required: is required")
+
+		testutil.WriteFile(t, "muss.user.yaml", `
+override:
+  services: {app: {image: "${MUSS_TEST_VAR"}}
+`)
+		assertConfigError(t, `
+module_definitions:
+- name: app
+  configs:
+    sole: {services: {app: {image: app}}}
+`, "muss.user.yaml: override.services.app.image: Invalid interpolation format: '${MUSS_TEST_VAR'")
+	})
+}
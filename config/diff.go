@@ -0,0 +1,157 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Selection describes alternative module choices for a config.
+type Selection struct {
+	// Configs maps module names to the config to use for them
+	// (taking precedence over profiles, user files, and MUSS_MODULE_ORDER).
+	Configs map[string]string
+	// Profile is the name of a profile to use instead of the active one.
+	Profile string
+	// UserFile is a user file to use instead of the configured one.
+	UserFile string
+}
+
+// IsEmpty returns true if the selection doesn't change anything.
+func (s Selection) IsEmpty() bool {
+	return len(s.Configs) == 0 && s.Profile == "" && s.UserFile == ""
+}
+
+// WithSelection returns a copy of the config that chooses module configs
+// using the selection (the original is not modified).
+func (cfg *ProjectConfig) WithSelection(selection Selection) (*ProjectConfig, error) {
+	alt := *cfg
+	alt.Secrets = nil
+	alt.Warnings = nil
+	alt.Notes = nil
+	alt.composeConfig = nil
+	alt.mergeLayers = nil
+	alt.filesToGenerate = nil
+
+	if selection.UserFile != "" {
+		user, err := readUserFile(selection.UserFile)
+		if err != nil {
+			if _, ok := err.(ValidationErrors); ok {
+				return nil, err
+			}
+			return nil, fmt.Errorf("Failed to read user file '%s': %w", selection.UserFile, err)
+		}
+		alt.UserFile = selection.UserFile
+		alt.User = user
+		alt.transformDeprecatedUserFields()
+	}
+
+	if selection.Profile != "" {
+		if err := alt.SetProfile(selection.Profile); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(selection.Configs) > 0 {
+		alt.selectedConfigs = make(map[string]string, len(cfg.selectedConfigs)+len(selection.Configs))
+		for module, config := range cfg.selectedConfigs {
+			alt.selectedConfigs[module] = config
+		}
+		for _, module := range sortedKeys(selection.Configs) {
+			if !alt.hasModule(module) {
+				return nil, fmt.Errorf("module '%s' is not defined", module)
+			}
+			alt.selectedConfigs[module] = selection.Configs[module]
+		}
+	}
+
+	return &alt, nil
+}
+
+// ComposeFileConfig returns the contents of the compose file on disk.
+func (cfg *ProjectConfig) ComposeFileConfig() (map[string]interface{}, error) {
+	file := cfg.ComposeFilePath()
+	if !fileExists(file) {
+		return nil, fmt.Errorf("compose file '%s' does not exist (run `muss config save` to generate it)", file)
+	}
+	dcc, err := readYamlFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read compose file '%s': %w", file, err)
+	}
+	return dcc, nil
+}
+
+// ConfigChange is a difference between two compose configs.
+// Old is nil for an added value and New is nil for a removed value.
+type ConfigChange struct {
+	Path   string      `json:"path"`
+	Action string      `json:"action"`
+	Old    interface{} `json:"old,omitempty"`
+	New    interface{} `json:"new,omitempty"`
+}
+
+// Actions of a ConfigChange.
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// DiffConfigs returns the changes (sorted by path) that would turn
+// one compose config into the other.
+// Maps are compared by key and lists by index
+// (keys are separated by dots like `config explain` paths).
+func DiffConfigs(from, to map[string]interface{}) []ConfigChange {
+	changes := make([]ConfigChange, 0)
+	diffValues(&changes, nil, from, to)
+	return changes
+}
+
+func diffValues(changes *[]ConfigChange, at []string, from, to interface{}) {
+	switch f := from.(type) {
+	case map[string]interface{}:
+		if t, ok := to.(map[string]interface{}); ok {
+			keys := make(map[string]interface{}, len(f)+len(t))
+			for k := range f {
+				keys[k] = nil
+			}
+			for k := range t {
+				keys[k] = nil
+			}
+			for _, k := range sortedKeys(keys) {
+				fv, inFrom := f[k]
+				tv, inTo := t[k]
+				path := appendPath(at, k)
+				switch {
+				case !inTo:
+					*changes = append(*changes, ConfigChange{Path: strings.Join(path, "."), Action: ChangeRemoved, Old: fv})
+				case !inFrom:
+					*changes = append(*changes, ConfigChange{Path: strings.Join(path, "."), Action: ChangeAdded, New: tv})
+				default:
+					diffValues(changes, path, fv, tv)
+				}
+			}
+			return
+		}
+	case []interface{}:
+		if t, ok := to.([]interface{}); ok {
+			for i := 0; i < len(f) || i < len(t); i++ {
+				path := appendPath(at, strconv.Itoa(i))
+				switch {
+				case i >= len(t):
+					*changes = append(*changes, ConfigChange{Path: strings.Join(path, "."), Action: ChangeRemoved, Old: f[i]})
+				case i >= len(f):
+					*changes = append(*changes, ConfigChange{Path: strings.Join(path, "."), Action: ChangeAdded, New: t[i]})
+				default:
+					diffValues(changes, path, f[i], t[i])
+				}
+			}
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(from, to) {
+		*changes = append(*changes, ConfigChange{Path: strings.Join(at, "."), Action: ChangeChanged, Old: from, New: to})
+	}
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/get-bridge/muss/testutil"
+)
+
+func TestDiffConfigs(t *testing.T) {
+	from := map[string]interface{}{
+		"version": "3.7",
+		"services": map[string]interface{}{
+			"app": map[string]interface{}{
+				"image":   "app",
+				"volumes": []interface{}{"./a:/a", "./b:/b"},
+			},
+			"db": map[string]interface{}{"image": "postgres"},
+		},
+	}
+	to := map[string]interface{}{
+		"version": "3.7",
+		"services": map[string]interface{}{
+			"app": map[string]interface{}{
+				"build":   "../app",
+				"volumes": []interface{}{"./a:/a"},
+			},
+			"db":    map[string]interface{}{"image": "postgres"},
+			"redis": map[string]interface{}{"image": "redis"},
+		},
+	}
+
+	assert.Equal(t, []ConfigChange{
+		{Path: "services.app.build", Action: ChangeAdded, New: "../app"},
+		{Path: "services.app.image", Action: ChangeRemoved, Old: "app"},
+		{Path: "services.app.volumes.1", Action: ChangeRemoved, Old: "./b:/b"},
+		{Path: "services.redis", Action: ChangeAdded, New: map[string]interface{}{"image": "redis"}},
+	}, DiffConfigs(from, to))
+
+	assert.Equal(t, []ConfigChange{
+		{Path: "version", Action: ChangeChanged, Old: "3.7", New: "3.8"},
+	}, DiffConfigs(map[string]interface{}{"version": "3.7"}, map[string]interface{}{"version": "3.8"}))
+
+	assert.Equal(t, []ConfigChange{
+		{Path: "services.app.command", Action: ChangeChanged, Old: "run", New: []interface{}{"run"}},
+	}, DiffConfigs(
+		map[string]interface{}{"services": map[string]interface{}{"app": map[string]interface{}{"command": "run"}}},
+		map[string]interface{}{"services": map[string]interface{}{"app": map[string]interface{}{"command": []interface{}{"run"}}}}),
+		"different types")
+
+	assert.Equal(t, []ConfigChange{}, DiffConfigs(from, from))
+}
+
+func TestWithSelection(t *testing.T) {
+	testutil.WithTempDir(t, func(tmpdir string) {
+		os.Unsetenv("MUSS_MODULE_ORDER")
+
+		testutil.WriteFile(t, "other.user.yaml", "module_order: [repo]\noverride: {services: {app: {environment: {FOO: bar}}}}\n")
+		testutil.WriteFile(t, "bad.user.yaml", "modules: []\n")
+
+		_, cfg, err := parseAndCompose(`
+default_module_order: [registry]
+module_definitions:
+- name: app
+  configs:
+    repo: {services: {app: {build: ../app}}}
+    registry: {services: {app: {image: app}}}
+- name: db
+  configs:
+    repo: {services: {db: {build: ../db}}}
+    registry: {services: {db: {image: db}}}
+profiles:
+  dev: {module_order: [repo]}
+`)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		compose := func(selection Selection) map[string]interface{} {
+			t.Helper()
+			alt, err := cfg.WithSelection(selection)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dcc, err := alt.ComposeConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			return dcc["services"].(map[string]interface{})
+		}
+		app := func(service string) map[string]interface{} {
+			return map[string]interface{}{"build": "../" + service}
+		}
+		registry := func(service string) map[string]interface{} {
+			return map[string]interface{}{"image": service}
+		}
+
+		assert.True(t, Selection{}.IsEmpty())
+
+		assert.Equal(t, map[string]interface{}{"app": app("app"), "db": registry("db")},
+			compose(Selection{Configs: map[string]string{"app": "repo"}}),
+			"configs")
+
+		assert.Equal(t, map[string]interface{}{"app": app("app"), "db": app("db")},
+			compose(Selection{Profile: "dev"}),
+			"profile")
+
+		assert.Equal(t, map[string]interface{}{"app": registry("app"), "db": app("db")},
+			compose(Selection{Profile: "dev", Configs: map[string]string{"app": "registry"}}),
+			"configs take precedence over profile")
+
+		os.Setenv("MUSS_MODULE_ORDER", "repo")
+		assert.Equal(t, map[string]interface{}{"app": registry("app"), "db": app("db")},
+			compose(Selection{Configs: map[string]string{"app": "registry"}}),
+			"configs take precedence over MUSS_MODULE_ORDER")
+		os.Unsetenv("MUSS_MODULE_ORDER")
+
+		assert.Equal(t, map[string]interface{}{
+			"app": map[string]interface{}{"build": "../app", "environment": map[string]interface{}{"FOO": "bar"}},
+			"db":  app("db"),
+		}, compose(Selection{UserFile: "other.user.yaml"}), "user file")
+
+		dcc, err := cfg.ComposeConfig()
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]interface{}{"app": registry("app"), "db": registry("db")},
+			dcc["services"], "original unchanged")
+
+		_, err = cfg.WithSelection(Selection{Configs: map[string]string{"web": "repo"}})
+		assert.EqualError(t, err, "module 'web' is not defined")
+
+		alt, err := cfg.WithSelection(Selection{Configs: map[string]string{"app": "nope"}})
+		assert.Nil(t, err)
+		_, err = alt.ComposeConfig()
+		assert.EqualError(t, err, "Config 'nope' for module 'app' does not exist")
+
+		_, err = cfg.WithSelection(Selection{Profile: "ci"})
+		assert.EqualError(t, err, "profile 'ci' is not defined (available profiles: dev)")
+
+		_, err = cfg.WithSelection(Selection{UserFile: "missing.yaml"})
+		assert.Contains(t, err.Error(), "Failed to read user file 'missing.yaml': ")
+
+		_, err = cfg.WithSelection(Selection{UserFile: "bad.user.yaml"})
+		assert.IsType(t, ValidationErrors{}, err)
+	})
+}
@@ -0,0 +1,226 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// parseDotenv parses "NAME=VALUE" lines the way docker compose parses
+// ".env" files and returns the names (in order) and their values:
+//
+//   - blank lines and lines starting with "#" are ignored
+//   - an "export " prefix is ignored
+//   - unquoted values are trimmed and end at a " #" comment
+//   - single quoted values are used literally (and can span lines)
+//   - double quoted values can span lines and use the escapes
+//     \n, \r, \t, \", \\, and \$
+//   - variables in unquoted and double quoted values are interpolated
+//     like compose files (see interpolation) with the values from lookup,
+//     earlier values in the content, or the inherited values
+func parseDotenv(content []byte, lookup func(string) (string, bool), inherited map[string]string) ([]string, map[string]string, error) {
+	p := &dotenvParser{src: []rune(string(content)), line: 1}
+	names := make([]string, 0)
+	values := make(map[string]string)
+
+	in := &interpolation{lookup: func(name string) (string, bool) {
+		if lookup != nil {
+			if value, ok := lookup(name); ok {
+				return value, ok
+			}
+		}
+		if value, ok := values[name]; ok {
+			return value, ok
+		}
+		value, ok := inherited[name]
+		return value, ok
+	}}
+
+	for {
+		p.skipSpaceAndComments()
+		if p.done() {
+			break
+		}
+
+		name, err := p.name()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		line := p.line
+		value, quote, err := p.value(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if quote != '\'' {
+			value, err = in.interpolate(value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid value for '%s' on line %d: %w", name, line, err)
+			}
+		}
+
+		if _, ok := values[name]; !ok {
+			names = append(names, name)
+		}
+		values[name] = value
+	}
+
+	return names, values, nil
+}
+
+type dotenvParser struct {
+	src  []rune
+	pos  int
+	line int
+}
+
+func (p *dotenvParser) done() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *dotenvParser) peek() rune {
+	return p.src[p.pos]
+}
+
+func (p *dotenvParser) next() rune {
+	r := p.src[p.pos]
+	p.pos++
+	if r == '\n' {
+		p.line++
+	}
+	return r
+}
+
+func (p *dotenvParser) skipLine() {
+	for !p.done() && p.peek() != '\n' {
+		p.next()
+	}
+}
+
+func (p *dotenvParser) skipSpaceAndComments() {
+	for !p.done() {
+		switch r := p.peek(); {
+		case r == '#':
+			p.skipLine()
+		case unicode.IsSpace(r):
+			p.next()
+		default:
+			return
+		}
+	}
+}
+
+// restOfLine returns the rest of the current line (without consuming it).
+func (p *dotenvParser) restOfLine() string {
+	end := p.pos
+	for end < len(p.src) && p.src[end] != '\n' {
+		end++
+	}
+	return string(p.src[p.pos:end])
+}
+
+func (p *dotenvParser) name() (string, error) {
+	if rest := p.restOfLine(); strings.HasPrefix(rest, "export ") || strings.HasPrefix(rest, "export\t") {
+		p.pos += len("export")
+		for !p.done() && (p.peek() == ' ' || p.peek() == '\t') {
+			p.next()
+		}
+	}
+
+	line := p.restOfLine()
+	i := strings.Index(line, "=")
+	if i < 0 {
+		return "", fmt.Errorf("failed to parse name=value line: %s", strings.TrimSpace(line))
+	}
+
+	name := strings.TrimSpace(line[:i])
+	if !isDotenvName(name) {
+		return "", fmt.Errorf("invalid variable name '%s' on line %d", name, p.line)
+	}
+	p.pos += len([]rune(line[:i])) + 1
+	return name, nil
+}
+
+func isDotenvName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// value returns the value (and the quote that surrounded it, if any).
+func (p *dotenvParser) value(name string) (string, rune, error) {
+	for !p.done() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.next()
+	}
+	if p.done() {
+		return "", 0, nil
+	}
+
+	quote := p.peek()
+	if quote != '\'' && quote != '"' {
+		value := p.restOfLine()
+		p.skipLine()
+		// A comment must be separated from the value.
+		for i, r := range value {
+			if r == '#' && i > 0 && (value[i-1] == ' ' || value[i-1] == '\t') {
+				value = value[:i]
+				break
+			}
+		}
+		return strings.TrimSpace(value), 0, nil
+	}
+
+	start := p.line
+	p.next()
+	var value strings.Builder
+	for {
+		if p.done() {
+			return "", 0, fmt.Errorf("unterminated quoted value for '%s' starting on line %d", name, start)
+		}
+		r := p.next()
+		if r == quote {
+			break
+		}
+		if r == '\\' && quote == '"' && !p.done() {
+			switch e := p.next(); e {
+			case 'n':
+				value.WriteRune('\n')
+			case 'r':
+				value.WriteRune('\r')
+			case 't':
+				value.WriteRune('\t')
+			case '$':
+				// Escape it for the expansion.
+				value.WriteString("$$")
+			case '"', '\\':
+				value.WriteRune(e)
+			default:
+				value.WriteRune('\\')
+				value.WriteRune(e)
+			}
+			continue
+		}
+		value.WriteRune(r)
+	}
+
+	// Only a comment can follow the closing quote.
+	if rest := strings.TrimSpace(p.restOfLine()); rest != "" && !strings.HasPrefix(rest, "#") {
+		return "", 0, fmt.Errorf("unexpected characters after the quoted value for '%s' on line %d", name, p.line)
+	}
+	p.skipLine()
+	return value.String(), quote, nil
+}
+
+// FormatDotenv returns a NAME="VALUE" line (with the value escaped)
+// that parseDotenv (or docker-compose) can read.
+func FormatDotenv(name, value string) string {
+	return fmt.Sprintf("%s=\"%s\"\n", name, dotenvEscaper.Replace(value))
+}
+
+var dotenvEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`, "$", `\$`)
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDotenv(t *testing.T) {
+	lookup := func(name string) (string, bool) {
+		env := map[string]string{"HOME": "/home/me", "EMPTY": ""}
+		value, ok := env[name]
+		return value, ok
+	}
+
+	content := `
+# comment
+PLAIN=value
+SPACED = some value  # comment
+HASH=a#b
+export EXPORTED="bar baz"
+	export  TABBED=1
+EMPTY_VALUE=
+SINGLE='literal $HOME \n # not a comment'
+DOUBLE="line one\nline two\ttab \"quoted\" \\ \$HOME"
+MULTI="first
+second"
+MULTI_SINGLE='first
+second'
+EXPANDED=$HOME/${PLAIN}/$UNKNOWN/$INHERITED
+DEFAULTS=${UNKNOWN:-fallback} ${EMPTY:-empty} ${EMPTY-set} ${UNKNOWN-unset}
+DOLLARS=cost: $$5
+QUOTED_COMMENT="value" # comment
+CRLF=windows` + "\r" + `
+PLAIN=last wins
+`
+
+	names, values, err := parseDotenv([]byte(content), lookup, map[string]string{"INHERITED": "old", "PLAIN": "old"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"PLAIN", "SPACED", "HASH", "EXPORTED", "TABBED", "EMPTY_VALUE", "SINGLE", "DOUBLE",
+		"MULTI", "MULTI_SINGLE", "EXPANDED", "DEFAULTS", "DOLLARS", "QUOTED_COMMENT", "CRLF",
+	}, names)
+	assert.Equal(t, map[string]string{
+		"PLAIN":          "last wins",
+		"SPACED":         "some value",
+		"HASH":           "a#b",
+		"EXPORTED":       "bar baz",
+		"TABBED":         "1",
+		"EMPTY_VALUE":    "",
+		"SINGLE":         `literal $HOME \n # not a comment`,
+		"DOUBLE":         "line one\nline two\ttab \"quoted\" \\ $HOME",
+		"MULTI":          "first\nsecond",
+		"MULTI_SINGLE":   "first\nsecond",
+		"EXPANDED":       "/home/me/value//old",
+		"DEFAULTS":       "fallback empty  unset",
+		"DOLLARS":        "cost: $5",
+		"QUOTED_COMMENT": "value",
+		"CRLF":           "windows",
+	}, values)
+
+	errors := map[string]string{
+		"NO_EQUAL_SIGN":                "failed to parse name=value line: NO_EQUAL_SIGN",
+		"A=1\nBAD NAME=2":              "invalid variable name 'BAD NAME' on line 2",
+		"A=1\n=2":                      "invalid variable name '' on line 2",
+		"A=1\nB=\"open\n\nC=3":         "unterminated quoted value for 'B' starting on line 2",
+		"A='one' two":                  "unexpected characters after the quoted value for 'A' on line 1",
+		"A=1\nB=${C:?is missing}":      "invalid value for 'B' on line 2: Variable 'C' is required: is missing",
+		"A=\"multi\nline\" extra\nB=2": "unexpected characters after the quoted value for 'A' on line 2",
+	}
+	for content, expErr := range errors {
+		_, _, err := parseDotenv([]byte(content), nil, nil)
+		assert.EqualError(t, err, expErr, content)
+	}
+}
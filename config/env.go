@@ -2,11 +2,19 @@ package config
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+
+	"github.com/get-bridge/muss/proc"
 )
 
 // EnvCommand is a command that sets (an) env var(s).
@@ -14,6 +22,13 @@ type EnvCommand struct {
 	Exec    []string `yaml:"exec"`
 	Parse   bool     `yaml:"parse"`
 	Varname string   `yaml:"varname"`
+	// Timeout (a duration) kills the command (and anything it started)
+	// if it takes longer.
+	Timeout string `yaml:"timeout,omitempty"`
+	// Retries is the number of times to run the command again if it fails
+	// (waiting RetryBackoff and then twice as long each time).
+	Retries      int    `yaml:"retries,omitempty"`
+	RetryBackoff string `yaml:"retry_backoff,omitempty"`
 }
 
 type envLoader interface {
@@ -22,22 +37,175 @@ type envLoader interface {
 	VarName() string
 }
 
+// EnvVar is an env var that muss sets for the project.
+type EnvVar struct {
+	Name  string
+	Value string
+	// Secret is true if the value came from a secret command
+	// (or the env commands that setup a secret command).
+	Secret bool
+	// Changed is true if the var was not already set to the value.
+	Changed bool
+}
+
 // LoadEnv will load environment variables from all config sources
-// including project_name and secret commands.
+// including project_name, env_files, and secret commands.
 func (cfg *ProjectConfig) LoadEnv() error {
+	_, _, err := cfg.setupEnv(true)
+	return err
+}
+
+// Env loads the environment (like LoadEnv, optionally without running
+// the secret commands) and returns the env vars that muss sets
+// (including any that were already set).
+func (cfg *ProjectConfig) Env(secrets bool) ([]EnvVar, error) {
+	// The secrets are found when the compose config is generated.
+	if err := cfg.loadComposeConfig(); err != nil {
+		return nil, err
+	}
+
+	before := environMap()
+	names, secretNames, err := cfg.setupEnv(secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := make([]EnvVar, 0, len(names)+len(secretNames))
+	add := func(name string, secret bool) {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return
+		}
+		previous, ok := before[name]
+		vars = append(vars, EnvVar{
+			Name:    name,
+			Value:   value,
+			Secret:  secret,
+			Changed: !ok || previous != value,
+		})
+	}
+	for _, name := range names {
+		add(name, false)
+	}
+	for _, name := range secretNames {
+		add(name, true)
+	}
+	return vars, nil
+}
+
+// setupEnv loads the environment and returns the names of the vars that
+// it sets (or would have if they weren't already set)
+// and the names of the vars set by the secret commands (if secrets is true).
+// Vars from secret commands that parse their output are only included
+// if they were not already set.
+func (cfg *ProjectConfig) setupEnv(secrets bool) ([]string, []string, error) {
+	names := make([]string, 0)
 	if cfg.ProjectName != "" {
 		setenvIfUnset("COMPOSE_PROJECT_NAME", cfg.ProjectName)
+		names = append(names, "COMPOSE_PROJECT_NAME")
 	}
 
-	if cfg.ComposeFile != "" {
-		setenvIfUnset("COMPOSE_FILE", cfg.ComposeFile)
+	// From a subdirectory docker-compose needs to be told where the file is
+	// (as an absolute path so that an exported value works from any dir).
+	if cfg.ComposeFile != "" || cfg.ComposeFilePath() != "docker-compose.yml" {
+		file, err := filepath.Abs(cfg.ComposeFilePath())
+		if err != nil {
+			return nil, nil, err
+		}
+		setenvIfUnset("COMPOSE_FILE", file)
+		names = append(names, "COMPOSE_FILE")
 	}
 
-	if err := loadEnvFromCmds(cfg.Secrets...); err != nil {
-		return fmt.Errorf("Failed to load secrets: %w", err)
+	// Load env files first since secret commands may need them.
+	fileNames, err := cfg.loadEnvFiles()
+	if err != nil {
+		return nil, nil, err
 	}
+	names = appendOnce(names, fileNames...)
 
-	return nil
+	if !secrets {
+		return names, nil, nil
+	}
+
+	before := environMap()
+	if err := cfg.loadSecrets(); err != nil {
+		return nil, nil, fmt.Errorf("Failed to load secrets: %w", err)
+	}
+
+	secretNames := make([]string, 0)
+	// Only the values of secret specs are redacted
+	// (not those of env commands that run while the secrets load).
+	redactNames := make([]string, 0)
+	secretFiles := make([]string, 0)
+	for _, s := range cfg.Secrets {
+		if s, ok := s.(*secretCmd); ok {
+			if s.asFile {
+				secretFiles = append(secretFiles, s.secretFile())
+				continue
+			}
+			redactNames = appendOnce(redactNames, s.VarName())
+			redactNames = appendOnce(redactNames, s.parsedNames...)
+			if secretEnvCommands[s.name] != nil {
+				for _, e := range secretEnvCommands[s.name].envCmds {
+					secretNames = appendOnce(secretNames, e.VarName())
+				}
+			}
+		}
+		secretNames = appendOnce(secretNames, s.VarName())
+	}
+	for name := range environMap() {
+		if _, ok := before[name]; !ok {
+			secretNames = appendOnce(secretNames, name)
+		}
+	}
+	sort.Strings(secretNames)
+	sort.Strings(redactNames)
+	loadedSecretNames = redactNames
+	loadedSecretFiles = secretFiles
+
+	return names, secretNames, nil
+}
+
+// loadedSecretNames are the vars set by secret specs when the env was loaded
+// and loadedSecretFiles are the files written for compose secrets.
+var loadedSecretNames, loadedSecretFiles []string
+
+// SecretValues returns the values of the vars set by secret specs
+// and of the compose secret files when the env was loaded.
+func SecretValues() []string {
+	values := make([]string, 0, len(loadedSecretNames)+len(loadedSecretFiles))
+	for _, name := range loadedSecretNames {
+		if value := os.Getenv(name); value != "" {
+			values = append(values, value)
+		}
+	}
+	for _, file := range loadedSecretFiles {
+		if value, err := ioutil.ReadFile(file); err == nil && len(value) > 0 {
+			values = append(values, string(value))
+		}
+	}
+	return values
+}
+
+// environMap returns the current environment as a map.
+func environMap() map[string]string {
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if i := strings.Index(kv, "="); i > 0 {
+			env[kv[:i]] = kv[i+1:]
+		}
+	}
+	return env
+}
+
+// appendOnce appends the (non-empty) names that the list doesn't have.
+func appendOnce(list []string, names ...string) []string {
+	for _, name := range names {
+		if name != "" && !containsString(list, name) {
+			list = append(list, name)
+		}
+	}
+	return list
 }
 
 // ShouldParse is true if the output should be parsed and false if varname
@@ -48,14 +216,40 @@ func (e *EnvCommand) ShouldParse() bool {
 
 // Value will run the command and return the output.
 func (e *EnvCommand) Value() ([]byte, error) {
+	limits, err := parseCommandLimits(e.Timeout, e.Retries, e.RetryBackoff)
+	if err != nil {
+		return nil, err
+	}
+	label := fmt.Sprintf("env command '%s'", strings.Join(e.Exec, " "))
+	return limits.run(label, func(ctx context.Context) ([]byte, error) {
+		return runCommand(ctx, e.Exec)
+	})
+}
+
+// runCommand runs the command and returns the output.
+// If the context can be done the command runs in its own process group
+// (which is killed when the context is done).
+func runCommand(ctx context.Context, args []string) ([]byte, error) {
 	var stdout bytes.Buffer
-	cmd := exec.Command(e.Exec[0], e.Exec[1:]...)
+	cmd := exec.Command(args[0], args[1:]...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = &stdout
 	// Pass stderr to show password prompts (or any problems).
 	cmd.Stderr = os.Stderr
+	if commandStderr != nil {
+		cmd.Stderr = commandStderr
+	}
 
-	if err := cmd.Run(); err != nil {
+	var err error
+	if ctx.Done() == nil {
+		err = cmd.Run()
+	} else {
+		err = proc.RunContext(ctx, cmd)
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	if err != nil {
 		return nil, fmt.Errorf("command failed: %s", err)
 	}
 
@@ -67,51 +261,136 @@ func (e *EnvCommand) VarName() string {
 	return e.Varname
 }
 
-func loadEnv(e envLoader) error {
+// commandStderr (if set) replaces os.Stderr for commands
+// (so that the progress display can show their output).
+var commandStderr io.Writer
+
+// loadEnv sets the env var(s) from the loader and returns what happened.
+func loadEnv(e envLoader) (secretState, error) {
+	if s, ok := e.(*secretCmd); ok && s.asFile {
+		return loadSecretFile(s)
+	}
 	// For a single value...
 	if !e.ShouldParse() {
 		varname := e.VarName()
 		if varname == "" {
-			return errors.New(`env command must have either "parse: true" or a "varname"`)
+			return secretFailed, errors.New(`env command must have either "parse: true" or a "varname"`)
 		}
 		// Only get it if not already set.
-		if _, ok := os.LookupEnv(varname); !ok {
-			val, err := e.Value()
-			if err != nil {
-				return err
-			}
-			if err := os.Setenv(varname, string(val)); err != nil {
-				return err
-			}
+		if _, ok := os.LookupEnv(varname); ok {
+			return secretSet, nil
 		}
-	} else {
-		if e.VarName() != "" {
-			return errors.New(`use "parse: true" or "varname", not both`)
-		}
-		// If we don't know what env vars it will load
-		// we have to call it.
-		val, err := e.Value()
+		val, state, err := loaderValue(e)
 		if err != nil {
-			return err
+			return secretFailed, err
+		}
+		if err := os.Setenv(varname, string(val)); err != nil {
+			return secretFailed, err
 		}
-		return loadEnvFromBytes(val)
+		return state, nil
 	}
-	return nil
+
+	if e.VarName() != "" {
+		return secretFailed, errors.New(`use "parse: true" or "varname", not both`)
+	}
+	// If we don't know what env vars it will load
+	// we have to call it.
+	val, state, err := loaderValue(e)
+	if err != nil {
+		return secretFailed, err
+	}
+	names, err := loadEnvFromBytes(val)
+	if err != nil {
+		return secretFailed, err
+	}
+	if s, ok := e.(*secretCmd); ok {
+		s.parsedNames = names
+	}
+	return state, nil
+}
+
+// loadSecretFile writes the value of the secret to its file
+// (every time, since the file is removed on down).
+func loadSecretFile(s *secretCmd) (secretState, error) {
+	val, state, err := loaderValue(s)
+	if err != nil {
+		return secretFailed, err
+	}
+	if err := writePrivateFile(s.secretFile(), val); err != nil {
+		return secretFailed, err
+	}
+	return state, nil
+}
+
+// loaderValue returns the value of the loader
+// and whether it came from the cache.
+func loaderValue(e envLoader) ([]byte, secretState, error) {
+	if s, ok := e.(*secretCmd); ok {
+		val, cached, err := s.value()
+		if cached {
+			return val, secretCached, err
+		}
+		return val, secretDone, err
+	}
+	val, err := e.Value()
+	return val, secretDone, err
 }
 
 // loadEnvFromCmds takes envLoaders and runs them and updates the current env.
 func loadEnvFromCmds(envCmds ...envLoader) error {
+	return loadEnvConcurrently(envCmds, 0, nil)
+}
+
+// loadSecrets loads the secrets (secret_concurrency at a time)
+// and shows their progress on stderr.
+func (cfg *ProjectConfig) loadSecrets() error {
+	if len(cfg.Secrets) == 0 {
+		return nil
+	}
+
+	progress := newSecretProgress(os.Stderr, isTerminal(os.Stderr), cfg.Verbose, cfg.Secrets)
+	commandStderr = progress.writer()
+	defer func() {
+		commandStderr = nil
+		progress.stop()
+	}()
+
+	limit := cfg.SecretConcurrency
+	if limit == 0 {
+		limit = defaultSecretConcurrency
+	}
+	return loadEnvConcurrently(cfg.Secrets, limit, progress)
+}
+
+// loadEnvConcurrently runs the loaders (no more than limit at a time
+// unless limit is 0) and reports their states to the progress (if not nil).
+func loadEnvConcurrently(envCmds []envLoader, limit int, progress *secretProgress) error {
+	var slots chan bool
+	if limit > 0 {
+		slots = make(chan bool, limit)
+	}
+
 	cmdErrors := make(chan error, len(envCmds))
 	var wg sync.WaitGroup
-	for _, env := range envCmds {
+	for i, env := range envCmds {
 		wg.Add(1)
-		go func(env envLoader) {
+		go func(i int, env envLoader) {
 			defer wg.Done()
-			err := loadEnv(env)
+			if slots != nil {
+				slots <- true
+				defer func() { <-slots }()
+			}
+			if progress != nil {
+				progress.update(i, secretRunning)
+			}
+			state, err := loadEnv(env)
+			if progress != nil {
+				progress.update(i, state)
+			}
 			if err != nil {
 				cmdErrors <- err
 			}
-		}(env)
+		}(i, env)
 	}
 	wg.Wait()
 	close(cmdErrors)
@@ -126,23 +405,55 @@ func loadEnvFromCmds(envCmds ...envLoader) error {
 	return nil
 }
 
-func loadEnvFromBytes(env []byte) error {
-	lines := bytes.Split(env, []byte("\n"))
+// loadEnvFromBytes sets any unset env vars from dotenv content
+// (see parseDotenv) and returns the names of the vars it set.
+func loadEnvFromBytes(env []byte) ([]string, error) {
+	names, values, err := parseDotenv(env, os.LookupEnv, nil)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, line := range lines {
-		if len(line) == 0 {
-			continue
+	set := make([]string, 0, len(names))
+	for _, name := range names {
+		if _, ok := os.LookupEnv(name); !ok {
+			os.Setenv(name, values[name])
+			set = append(set, name)
 		}
+	}
 
-		parts := bytes.SplitN(line, []byte("="), 2)
-		if len(parts) != 2 {
-			return fmt.Errorf("failed to parse name=value line: %s", line)
-		}
+	return set, nil
+}
 
-		setenvIfUnset(string(parts[0]), string(parts[1]))
+// loadEnvFiles sets any unset env vars from the dotenv files
+// (like compose, values in later files take precedence)
+// and returns the names of the vars in the files.
+func (cfg *ProjectConfig) loadEnvFiles() ([]string, error) {
+	names := make([]string, 0)
+	values := make(map[string]string)
+
+	for _, file := range cfg.EnvFiles {
+		file = cfg.projectPath(file)
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read env file '%s': %w", file, err)
+		}
+		// Files can refer to values from the env or earlier files.
+		fileNames, fileValues, err := parseDotenv(content, os.LookupEnv, values)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load env file '%s': %w", file, err)
+		}
+		for _, name := range fileNames {
+			if _, ok := values[name]; !ok {
+				names = append(names, name)
+			}
+			values[name] = fileValues[name]
+		}
 	}
 
-	return nil
+	for _, name := range names {
+		setenvIfUnset(name, values[name])
+	}
+	return names, nil
 }
 
 func setenvIfUnset(key string, value string) (err error) {
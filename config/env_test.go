@@ -2,9 +2,12 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/get-bridge/muss/testutil"
 )
 
 func envIsUnset(key string) bool {
@@ -52,17 +55,26 @@ func TestConfigEnv(t *testing.T) {
 			"compose_file": "dc.muss.yml",
 		})
 
+		abs := func(file string) string {
+			t.Helper()
+			abs, err := filepath.Abs(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return abs
+		}
+
 		assert.Nil(t, cfg.LoadEnv(), "no errors")
-		assert.Equal(t, os.Getenv("COMPOSE_FILE"), "dc.muss.yml")
+		assert.Equal(t, os.Getenv("COMPOSE_FILE"), abs("dc.muss.yml"), "absolute path")
 
 		cfg.ComposeFile = "nerts"
 
 		assert.Nil(t, cfg.LoadEnv(), "no errors")
-		assert.Equal(t, os.Getenv("COMPOSE_FILE"), "dc.muss.yml", "doesn't overwrite")
+		assert.Equal(t, os.Getenv("COMPOSE_FILE"), abs("dc.muss.yml"), "doesn't overwrite")
 
 		os.Unsetenv("COMPOSE_FILE")
 		assert.Nil(t, cfg.LoadEnv(), "no errors")
-		assert.Equal(t, os.Getenv("COMPOSE_FILE"), "nerts", "sets when not set")
+		assert.Equal(t, os.Getenv("COMPOSE_FILE"), abs("nerts"), "sets when not set")
 	})
 
 	t.Run("secrets", func(t *testing.T) {
@@ -77,6 +89,118 @@ func TestConfigEnv(t *testing.T) {
 
 		assert.Nil(t, cfg.LoadEnv(), "no errors")
 		assert.Equal(t, os.Getenv("MUSS_TEST_ENV"), "42")
+
+		os.Unsetenv("MUSS_TEST_ENV")
+		cfg.Secrets[len(cfg.Secrets)-1] = &EnvCommand{
+			Parse: true,
+			Exec:  []string{"/bin/sh", "-c", `echo 'MUSS_TEST_ENV=abc$$def${MUSS_TEST_UNSET:-x}'; echo "MUSS_TEST_QUOTED='\$d'"`},
+		}
+		os.Unsetenv("MUSS_TEST_UNSET")
+		os.Unsetenv("MUSS_TEST_QUOTED")
+		defer os.Unsetenv("MUSS_TEST_QUOTED")
+		assert.Nil(t, cfg.LoadEnv(), "no errors")
+		assert.Equal(t, "abc$defx", os.Getenv("MUSS_TEST_ENV"), "output is interpolated like a compose .env file")
+		assert.Equal(t, "$d", os.Getenv("MUSS_TEST_QUOTED"), "except single quoted values")
+	})
+
+	t.Run("env_files", func(t *testing.T) {
+		testutil.WithTempDir(t, func(tmpdir string) {
+			for _, name := range []string{"MUSS_TEST_ENV", "MUSS_TEST_A", "MUSS_TEST_B", "MUSS_TEST_C"} {
+				os.Unsetenv(name)
+				defer os.Unsetenv(name)
+			}
+			os.Setenv("MUSS_TEST_ENV", "from env")
+
+			testutil.WriteFile(t, "project/.env", `
+# shared defaults
+MUSS_TEST_ENV=from file
+MUSS_TEST_A="a ${MUSS_TEST_ENV}"
+MUSS_TEST_B=b
+`)
+			testutil.WriteFile(t, "project/.env.local", `
+export MUSS_TEST_B='local'
+MUSS_TEST_C=${MUSS_TEST_B}-${MUSS_TEST_A}
+`)
+			os.Mkdir("sub", 0755)
+			os.Chdir("sub")
+			defer os.Chdir(tmpdir)
+
+			cfg := newTestConfig(t, map[string]interface{}{
+				"env_files": []string{".env", ".env.local"},
+			})
+			cfg.projectDir = "../project"
+
+			assert.Nil(t, cfg.LoadEnv(), "no errors")
+			assert.Equal(t, "from env", os.Getenv("MUSS_TEST_ENV"), "doesn't overwrite")
+			assert.Equal(t, "a from env", os.Getenv("MUSS_TEST_A"), "expands env")
+			assert.Equal(t, "local", os.Getenv("MUSS_TEST_B"), "later files take precedence")
+			assert.Equal(t, "local-a from env", os.Getenv("MUSS_TEST_C"), "expands earlier values")
+
+			cfg.EnvFiles = []string{".env.missing"}
+			err := cfg.LoadEnv()
+			if assert.NotNil(t, err) {
+				assert.Contains(t, err.Error(), "Failed to read env file '../project/.env.missing': ")
+			}
+
+			testutil.WriteFile(t, "../project/.env.bad", "MUSS_TEST_D='oops\n")
+			cfg.EnvFiles = []string{".env.bad"}
+			assert.EqualError(t, cfg.LoadEnv(),
+				"Failed to load env file '../project/.env.bad': unterminated quoted value for 'MUSS_TEST_D' starting on line 1")
+		})
+	})
+
+	t.Run("Env", func(t *testing.T) {
+		testutil.WithTempDir(t, func(tmpdir string) {
+			for _, name := range []string{"COMPOSE_PROJECT_NAME", "COMPOSE_FILE", "MUSS_TEST_A", "MUSS_TEST_B", "MUSS_TEST_SECRET", "MUSS_TEST_PARSED", "MUSS_TEST_SPEC", "MUSS_TEST_SPEC_PARSED"} {
+				os.Unsetenv(name)
+				defer os.Unsetenv(name)
+			}
+			os.Setenv("MUSS_TEST_B", "from env")
+
+			testutil.WriteFile(t, ".env", "MUSS_TEST_A=a\nMUSS_TEST_B=b\n")
+			cfg := newTestConfig(t, map[string]interface{}{
+				"project_name": "musstest",
+				"env_files":    []string{".env"},
+			})
+			cfg.Secrets = append(cfg.Secrets,
+				&EnvCommand{Varname: "MUSS_TEST_SECRET", Exec: []string{"echo", "shh"}},
+				&EnvCommand{Parse: true, Exec: []string{"echo", "MUSS_TEST_PARSED=p"}},
+				&secretCmd{
+					EnvCommand: &EnvCommand{Varname: "MUSS_TEST_SPEC"},
+					provider:   envSecretProvider{},
+					args:       []string{"MUSS_TEST_B"},
+					cache:      "none",
+				},
+				&secretCmd{
+					EnvCommand: &EnvCommand{Parse: true},
+					provider:   execSecretProvider{},
+					args:       []string{"echo", "MUSS_TEST_SPEC_PARSED=parsed value\nMUSS_TEST_B=ignored"},
+					cache:      "none",
+				},
+			)
+
+			vars, err := cfg.Env(false)
+			assert.Nil(t, err)
+			assert.Equal(t, []EnvVar{
+				{Name: "COMPOSE_PROJECT_NAME", Value: "musstest", Changed: true},
+				{Name: "MUSS_TEST_A", Value: "a", Changed: true},
+				{Name: "MUSS_TEST_B", Value: "from env"},
+			}, vars, "without secrets")
+			assert.True(t, envIsUnset("MUSS_TEST_SECRET"), "secrets not loaded")
+
+			vars, err = cfg.Env(true)
+			assert.Nil(t, err)
+			assert.Equal(t, []EnvVar{
+				{Name: "COMPOSE_PROJECT_NAME", Value: "musstest"},
+				{Name: "MUSS_TEST_A", Value: "a"},
+				{Name: "MUSS_TEST_B", Value: "from env"},
+				{Name: "MUSS_TEST_PARSED", Value: "p", Secret: true, Changed: true},
+				{Name: "MUSS_TEST_SECRET", Value: "shh", Secret: true, Changed: true},
+				{Name: "MUSS_TEST_SPEC", Value: "from env", Secret: true, Changed: true},
+				{Name: "MUSS_TEST_SPEC_PARSED", Value: "parsed value", Secret: true, Changed: true},
+			}, vars, "with secrets")
+			assert.Equal(t, []string{"from env", "parsed value"}, SecretValues(), "only secret specs are redacted")
+		})
 	})
 
 	t.Run("returns error", func(t *testing.T) {
@@ -4,60 +4,248 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"strconv"
+	"strings"
 )
 
-func expand(s string) string {
-	return os.Expand(s, shellVarExpand)
+// interpolation replaces variables in strings the way docker-compose does:
+// "$NAME", "${NAME}", "${NAME:-default}", "${NAME-default}",
+// "${NAME:?error}", "${NAME?error}", "${NAME:+alternate}",
+// "${NAME+alternate}", and "$$" for a literal "$".
+// A "$" that does not start a variable is left as it is
+// and "${params.NAME}" is left for substituteParams.
+type interpolation struct {
+	lookup func(string) (string, bool)
+	// compose means that the result will be interpolated by docker-compose
+	// so every variable is checked but left for it (values aren't written
+	// to the compose file since they may be secrets, or set later by
+	// secrets or env files) and any other literal "$" is escaped.
+	compose bool
+	// bracedOnly means that only "${...}" expressions are replaced
+	// (and "$${" for a literal "${"); any other "$" is left as it is
+	// so that args for a shell can still use "$NAME", "$$", and "$(...)".
+	bracedOnly bool
+	// blank (if set) is called with any variable that is replaced with "".
+	blank func(spec string)
 }
 
-func expandWarnOnEmpty(s string) string {
-	return os.Expand(s, shellVarExpandWarnOnEmpty)
+var reInterpolationSpec = regexp.MustCompile(`(?s)^([_a-zA-Z][_a-zA-Z0-9]*)(?:(:?[-?+])(.*))?$`)
+
+// envInterpolation returns an interpolation that looks up the environment.
+func envInterpolation(compose bool) *interpolation {
+	return &interpolation{lookup: os.LookupEnv, compose: compose}
+}
+
+func expand(s string) (string, error) {
+	return envInterpolation(false).interpolate(s)
+}
+
+func expandWarnOnEmpty(s string) (string, error) {
+	in := envInterpolation(false)
+	in.blank = func(spec string) {
+		fmt.Fprintf(os.Stderr, "${%s} is blank\n", spec)
+	}
+	return in.interpolate(s)
 }
 
-func shellVarExpand(spec string) string {
-	re := regexp.MustCompile(`^([_a-zA-Z][_a-zA-Z0-9]*)(?:(:?[-?])(.*))?$`)
-	match := re.FindStringSubmatch(spec)
-	requiredErrorSpec := "Variable '%s' is required: %s"
+// interpolate returns the string with any variables replaced.
+func (in *interpolation) interpolate(s string) (string, error) {
+	var result strings.Builder
+	for i := 0; i < len(s); {
+		j := strings.IndexByte(s[i:], '$')
+		if j < 0 {
+			result.WriteString(s[i:])
+			break
+		}
+		result.WriteString(s[i : i+j])
+		i += j
 
-	if len(match) > 0 {
-		name, op, value := match[1], match[2], match[3]
-		switch op {
-		case "": // no operator
-			return os.Getenv(name)
-		case ":-": // null or unset
-			env := os.Getenv(name)
-			if env == "" {
-				return value
+		switch {
+		case in.bracedOnly && strings.HasPrefix(s[i:], "$${"):
+			result.WriteString("${")
+			i += 3
+		case strings.HasPrefix(s[i:], "$$") && !in.bracedOnly:
+			in.writeValue(&result, "$")
+			i += 2
+		case strings.HasPrefix(s[i:], "${"):
+			end := closingBrace(s, i+2)
+			if end < 0 {
+				return "", fmt.Errorf("Invalid interpolation format: '%s'", s[i:])
+			}
+			value, err := in.substitute(s[i+2:end], s[i:end+1])
+			if err != nil {
+				return "", err
 			}
-			return env
-		case "-": // unset
-			env, ok := os.LookupEnv(name)
-			if !ok {
-				return value
+			result.WriteString(value)
+			i = end + 1
+		case in.bracedOnly:
+			result.WriteByte('$')
+			i++
+		default:
+			n := 1
+			for n < len(s)-i && isVarNameByte(s[i+n], n == 1) {
+				n++
 			}
-			return env
-		case ":?": // error if null or unset
-			env := os.Getenv(name)
-			if env == "" {
-				panic(fmt.Sprintf(requiredErrorSpec, name, value))
+			if n == 1 {
+				in.writeValue(&result, "$")
+				i++
+				continue
 			}
-			return env
-		case "?": // error if null
-			env, ok := os.LookupEnv(name)
-			if !ok {
-				panic(fmt.Sprintf(requiredErrorSpec, name, value))
+			value, err := in.substitute(s[i+1:i+n], s[i:i+n])
+			if err != nil {
+				return "", err
+			}
+			result.WriteString(value)
+			i += n
+		}
+	}
+	return result.String(), nil
+}
+
+// substitute returns the (escaped) value for the spec
+// (the part of the expression inside the braces).
+func (in *interpolation) substitute(spec, expression string) (string, error) {
+	match := reInterpolationSpec.FindStringSubmatch(spec)
+	if match == nil {
+		if strings.HasPrefix(spec, "params.") {
+			return expression, nil
+		}
+		return "", fmt.Errorf("Invalid interpolation format: '${%s}'", spec)
+	}
+
+	name, op, arg := match[1], match[2], match[3]
+	if in.compose {
+		if _, err := in.interpolate(arg); err != nil {
+			return "", err
+		}
+		return expression, nil
+	}
+	value, ok := in.lookup(name)
+
+	var result strings.Builder
+	switch op {
+	case "": // no operator
+		in.writeValue(&result, value)
+	case ":-": // null or unset
+		if value == "" {
+			return in.interpolateArg(arg, spec)
+		}
+		in.writeValue(&result, value)
+	case "-": // unset
+		if !ok {
+			return in.interpolateArg(arg, spec)
+		}
+		in.writeValue(&result, value)
+	case ":?": // error if null or unset
+		if value == "" {
+			return "", fmt.Errorf("Variable '%s' is required: %s", name, arg)
+		}
+		in.writeValue(&result, value)
+	case "?": // error if unset
+		if !ok {
+			return "", fmt.Errorf("Variable '%s' is required: %s", name, arg)
+		}
+		in.writeValue(&result, value)
+	case ":+": // alternate if not null
+		if value != "" {
+			return in.interpolateArg(arg, spec)
+		}
+	case "+": // alternate if set
+		if ok {
+			return in.interpolateArg(arg, spec)
+		}
+	}
+
+	if result.Len() == 0 && in.blank != nil {
+		in.blank(spec)
+	}
+	return result.String(), nil
+}
+
+// interpolateArg interpolates a default or alternate value
+// (which can contain other variables).
+func (in *interpolation) interpolateArg(arg, spec string) (string, error) {
+	value, err := in.interpolate(arg)
+	if err == nil && value == "" && in.blank != nil {
+		in.blank(spec)
+	}
+	return value, err
+}
+
+func (in *interpolation) writeValue(result *strings.Builder, value string) {
+	if in.compose {
+		value = strings.ReplaceAll(value, "$", "$$")
+	}
+	result.WriteString(value)
+}
+
+// closingBrace returns the index of the brace that closes the expression
+// starting at i (allowing nested expressions) or -1 if there isn't one.
+func closingBrace(s string, i int) int {
+	depth := 0
+	for ; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "$$"):
+			i++
+		case strings.HasPrefix(s[i:], "${"):
+			depth++
+			i++
+		case s[i] == '}':
+			if depth == 0 {
+				return i
 			}
-			return env
+			depth--
 		}
 	}
+	return -1
+}
 
-	panic(fmt.Sprintf("Invalid interpolation format: '${%s}'", spec))
+func isVarNameByte(b byte, first bool) bool {
+	return b == '_' || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (!first && b >= '0' && b <= '9')
 }
 
-func shellVarExpandWarnOnEmpty(spec string) string {
-	val := shellVarExpand(spec)
-	if val == "" {
-		fmt.Fprintf(os.Stderr, "${%s} is blank\n", spec)
+// interpolateValue returns a copy of the value with every string interpolated
+// (map keys are left alone).
+// Errors include the key path of the string.
+func (in *interpolation) interpolateValue(value interface{}, path string) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for _, k := range sortedKeys(v) {
+			item, err := in.interpolateValue(v[k], joinPath(path, k))
+			if err != nil {
+				return nil, err
+			}
+			result[k] = item
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			item, err := in.interpolateValue(item, joinPath(path, strconv.Itoa(i)))
+			if err != nil {
+				return nil, err
+			}
+			result[i] = item
+		}
+		return result, nil
+	case string:
+		result, err := in.interpolate(v)
+		if err != nil {
+			if path == "" {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return result, nil
+	}
+	return value, nil
+}
+
+// inFile adds the file (if there is one) to an interpolateValue error.
+func inFile(file string, err error) error {
+	if file == "" {
+		return err
 	}
-	return val
+	return fmt.Errorf("%s: %w", file, err)
 }
@@ -9,66 +9,156 @@ import (
 	"github.com/get-bridge/muss/testutil"
 )
 
+func assertExpand(t *testing.T, spec, exp, msg string) {
+	t.Helper()
+	expanded, err := expand(spec)
+	assert.Nil(t, err, msg)
+	assert.Equal(t, exp, expanded, msg)
+}
+
+func assertExpandError(t *testing.T, spec, expErr, msg string) {
+	t.Helper()
+	_, err := expand(spec)
+	assert.EqualError(t, err, expErr, msg)
+}
+
 func assertExpandWithWarnings(t *testing.T, spec, exp, expStderr, msg string) {
+	t.Helper()
 	var expanded string
+	var err error
 	stderr := testutil.CaptureStderr(t, func() {
-		expanded = expandWarnOnEmpty(spec)
+		expanded, err = expandWarnOnEmpty(spec)
 	})
+	assert.Nil(t, err, msg)
 	assert.Equal(t, expStderr, stderr, "warns to stderr")
 	assert.Equal(t, exp, expanded, msg)
 }
 
 func TestShellVarExpand(t *testing.T) {
-	t.Run("unsupported syntax", func(t *testing.T) {
-		assert.PanicsWithValue(t, "Invalid interpolation format: '${MUSS_TEST_VAR:+nullorunset}'",
-			func() { expand("[${MUSS_TEST_VAR:+nullorunset}]") }, ":+")
+	t.Run("syntax", func(t *testing.T) {
+		os.Setenv("MUSS_TEST_VAR", "x")
+		defer os.Unsetenv("MUSS_TEST_VAR")
+
+		assertExpand(t, "$$MUSS_TEST_VAR $${MUSS_TEST_VAR}", "$MUSS_TEST_VAR ${MUSS_TEST_VAR}", "escaped")
+		assertExpand(t, "a $ b$", "a $ b$", "lone $")
+		assertExpand(t, "$MUSS_TEST_VAR.$MUSS_TEST_VAR-1", "x.x-1", "name ends")
+		assertExpand(t, "${params.tag}", "${params.tag}", "params are left alone")
+		assertExpand(t, "${MUSS_TEST_UNSET:-${MUSS_TEST_VAR}/${MUSS_TEST_UNSET:-z}}", "x/z", "nested")
+
+		assertExpandError(t, "[${MUSS_TEST_VAR", "Invalid interpolation format: '${MUSS_TEST_VAR'", "unclosed")
+		assertExpandError(t, "[${MUSS TEST}]", "Invalid interpolation format: '${MUSS TEST}'", "invalid name")
+		assertExpandError(t, "[${MUSS_TEST_VAR:=x}]", "Invalid interpolation format: '${MUSS_TEST_VAR:=x}'", "unsupported operator")
 	})
 
 	t.Run("var unset", func(t *testing.T) {
 		os.Unsetenv("MUSS_TEST_VAR")
-		assert.Equal(t, "[]", expand("[$MUSS_TEST_VAR]"), "var")
-		assert.Equal(t, "[]", expand("[${MUSS_TEST_VAR}]"), "braces")
+		assertExpand(t, "[$MUSS_TEST_VAR]", "[]", "var")
+		assertExpand(t, "[${MUSS_TEST_VAR}]", "[]", "braces")
 
-		assert.Equal(t, "[]", expand("[${MUSS_TEST_VAR:-}]"), "default empty")
+		assertExpand(t, "[${MUSS_TEST_VAR:-}]", "[]", "default empty")
 
-		assert.Equal(t, "[nullorunset]", expand("[${MUSS_TEST_VAR:-nullorunset}]"), ":-")
-		assert.Equal(t, "[unset]", expand("[${MUSS_TEST_VAR-unset}]"), "-")
+		assertExpand(t, "[${MUSS_TEST_VAR:-nullorunset}]", "[nullorunset]", ":-")
+		assertExpand(t, "[${MUSS_TEST_VAR-unset}]", "[unset]", "-")
+		assertExpand(t, "[${MUSS_TEST_VAR:+notnull}]", "[]", ":+")
+		assertExpand(t, "[${MUSS_TEST_VAR+set}]", "[]", "+")
 
-		assert.PanicsWithValue(t, "Variable 'MUSS_TEST_VAR' is required: nullorunset",
-			func() { expand("[${MUSS_TEST_VAR:?nullorunset}]") }, ":?")
-		assert.PanicsWithValue(t, "Variable 'MUSS_TEST_VAR' is required: unset",
-			func() { expand("[${MUSS_TEST_VAR?unset}]") }, "?")
+		assertExpandError(t, "[${MUSS_TEST_VAR:?nullorunset}]", "Variable 'MUSS_TEST_VAR' is required: nullorunset", ":?")
+		assertExpandError(t, "[${MUSS_TEST_VAR?unset}]", "Variable 'MUSS_TEST_VAR' is required: unset", "?")
 
 		assertExpandWithWarnings(t, "[${MUSS_TEST_VAR}]", "[]", "${MUSS_TEST_VAR} is blank\n", "expanded blank")
 	})
 
 	t.Run("var blank", func(t *testing.T) {
 		os.Setenv("MUSS_TEST_VAR", "")
-		assert.Equal(t, "[]", expand("[$MUSS_TEST_VAR]"), "var")
-		assert.Equal(t, "[]", expand("[${MUSS_TEST_VAR}]"), "braces")
+		assertExpand(t, "[$MUSS_TEST_VAR]", "[]", "var")
+		assertExpand(t, "[${MUSS_TEST_VAR}]", "[]", "braces")
 
-		assert.Equal(t, "[]", expand("[${MUSS_TEST_VAR:-}]"), "default empty")
+		assertExpand(t, "[${MUSS_TEST_VAR:-}]", "[]", "default empty")
 
-		assert.Equal(t, "[nullorunset]", expand("[${MUSS_TEST_VAR:-nullorunset}]"), ":-")
-		assert.Equal(t, "[]", expand("[${MUSS_TEST_VAR-unset}]"), "-")
+		assertExpand(t, "[${MUSS_TEST_VAR:-nullorunset}]", "[nullorunset]", ":-")
+		assertExpand(t, "[${MUSS_TEST_VAR-unset}]", "[]", "-")
+		assertExpand(t, "[${MUSS_TEST_VAR:+notnull}]", "[]", ":+")
+		assertExpand(t, "[${MUSS_TEST_VAR+set}]", "[set]", "+")
 
-		assert.PanicsWithValue(t, "Variable 'MUSS_TEST_VAR' is required: nullorunset",
-			func() { expand("[${MUSS_TEST_VAR:?nullorunset}]") }, ":?")
-		assert.Equal(t, "[]", expand("[${MUSS_TEST_VAR?unset}]"), "?")
+		assertExpandError(t, "[${MUSS_TEST_VAR:?nullorunset}]", "Variable 'MUSS_TEST_VAR' is required: nullorunset", ":?")
+		assertExpand(t, "[${MUSS_TEST_VAR?unset}]", "[]", "?")
 
 		assertExpandWithWarnings(t, "[${MUSS_TEST_VAR}]", "[]", "${MUSS_TEST_VAR} is blank\n", "expanded blank")
 	})
 
 	t.Run("var nonblank", func(t *testing.T) {
 		os.Setenv("MUSS_TEST_VAR", "not blank")
-		assert.Equal(t, "[not blank]", expand("[$MUSS_TEST_VAR]"), "var")
-		assert.Equal(t, "[not blank]", expand("[${MUSS_TEST_VAR}]"), "braces")
-		assert.Equal(t, "[not blank]", expand("[${MUSS_TEST_VAR:-}]"), "default empty")
-		assert.Equal(t, "[not blank]", expand("[${MUSS_TEST_VAR:-nullorunset}]"), ":-")
-		assert.Equal(t, "[not blank]", expand("[${MUSS_TEST_VAR-unset}]"), "-")
-		assert.Equal(t, "[not blank]", expand("[${MUSS_TEST_VAR:?nullorunset}]"), ":?")
-		assert.Equal(t, "[not blank]", expand("[${MUSS_TEST_VAR?nullorunset}]"), "?")
+		assertExpand(t, "[$MUSS_TEST_VAR]", "[not blank]", "var")
+		assertExpand(t, "[${MUSS_TEST_VAR}]", "[not blank]", "braces")
+		assertExpand(t, "[${MUSS_TEST_VAR:-}]", "[not blank]", "default empty")
+		assertExpand(t, "[${MUSS_TEST_VAR:-nullorunset}]", "[not blank]", ":-")
+		assertExpand(t, "[${MUSS_TEST_VAR-unset}]", "[not blank]", "-")
+		assertExpand(t, "[${MUSS_TEST_VAR:?nullorunset}]", "[not blank]", ":?")
+		assertExpand(t, "[${MUSS_TEST_VAR?nullorunset}]", "[not blank]", "?")
+		assertExpand(t, "[${MUSS_TEST_VAR:+notnull}]", "[notnull]", ":+")
+		assertExpand(t, "[${MUSS_TEST_VAR+set}]", "[set]", "+")
 
 		assertExpandWithWarnings(t, "[${MUSS_TEST_VAR}]", "[not blank]", "", "expanded non blank")
 	})
+
+	t.Run("compose", func(t *testing.T) {
+		os.Setenv("MUSS_TEST_VAR", "$ecret")
+		defer os.Unsetenv("MUSS_TEST_VAR")
+		os.Unsetenv("MUSS_TEST_UNSET")
+
+		in := envInterpolation(true)
+		for spec, exp := range map[string]string{
+			"$MUSS_TEST_VAR ${MUSS_TEST_VAR:-x}":      "$MUSS_TEST_VAR ${MUSS_TEST_VAR:-x}",
+			"$$MUSS_TEST_VAR a $ b":                   "$$MUSS_TEST_VAR a $$ b",
+			"$MUSS_TEST_UNSET ${MUSS_TEST_UNSET:-x}":  "$MUSS_TEST_UNSET ${MUSS_TEST_UNSET:-x}",
+			"${MUSS_TEST_UNSET:?later}":               "${MUSS_TEST_UNSET:?later}",
+			"${MUSS_TEST_VAR:+${MUSS_TEST_UNSET}/$$}": "${MUSS_TEST_VAR:+${MUSS_TEST_UNSET}/$$}",
+		} {
+			result, err := in.interpolate(spec)
+			assert.Nil(t, err, spec)
+			assert.Equal(t, exp, result, "leaves vars for compose (without their values): "+spec)
+		}
+
+		_, err := in.interpolate("${MUSS_TEST_VAR:-${MUSS TEST}}")
+		assert.EqualError(t, err, "Invalid interpolation format: '${MUSS TEST}'", "checks nested expressions")
+	})
+
+	t.Run("braced only", func(t *testing.T) {
+		os.Setenv("MUSS_TEST_VAR", "x")
+		defer os.Unsetenv("MUSS_TEST_VAR")
+
+		in := envInterpolation(false)
+		in.bracedOnly = true
+		for spec, exp := range map[string]string{
+			"${MUSS_TEST_VAR} ${MUSS_TEST_UNSET:-${MUSS_TEST_VAR}}": "x x",
+			"$MUSS_TEST_VAR $$ $1 $(pwd) $":                         "$MUSS_TEST_VAR $$ $1 $(pwd) $",
+			"$${MUSS_TEST_VAR}":                                     "${MUSS_TEST_VAR}",
+		} {
+			result, err := in.interpolate(spec)
+			assert.Nil(t, err, spec)
+			assert.Equal(t, exp, result, "leaves other $ alone: "+spec)
+		}
+	})
+
+	t.Run("values", func(t *testing.T) {
+		os.Setenv("MUSS_TEST_VAR", "x")
+		defer os.Unsetenv("MUSS_TEST_VAR")
+		os.Unsetenv("MUSS_TEST_UNSET")
+
+		in := envInterpolation(false)
+		value, err := in.interpolateValue(map[string]interface{}{
+			"a": []interface{}{"$MUSS_TEST_VAR", 1, true},
+			"b": map[string]interface{}{"$MUSS_TEST_VAR": "${MUSS_TEST_VAR}-y"},
+		}, "")
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"a": []interface{}{"x", 1, true},
+			"b": map[string]interface{}{"$MUSS_TEST_VAR": "x-y"},
+		}, value, "interpolates strings (but not keys)")
+
+		_, err = in.interpolateValue(map[string]interface{}{
+			"a": []interface{}{"ok", map[string]interface{}{"b": "${MUSS_TEST_UNSET:?set it}"}},
+		}, "configs.repo")
+		assert.EqualError(t, err, "configs.repo.a.1.b: Variable 'MUSS_TEST_UNSET' is required: set it")
+	})
 }
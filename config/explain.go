@@ -0,0 +1,188 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ValueSource describes a map that was merged into the compose config:
+// a module config (or one of its includes) or the user override.
+type ValueSource struct {
+	File     string
+	Module   string
+	Config   string
+	Includes []string
+	Override bool
+	// Section is the part of the file the source is in
+	// (like the project's section of the global user file).
+	Section string
+}
+
+// String describes the source for people.
+func (s ValueSource) String() string {
+	var desc string
+	if s.Override {
+		desc = "user override"
+		if s.Section != "" {
+			desc += fmt.Sprintf(" '%s'", s.Section)
+		}
+	} else {
+		desc = fmt.Sprintf("module '%s' config '%s'", s.Module, s.Config)
+		for _, include := range s.Includes {
+			desc += fmt.Sprintf(" include '%s'", include)
+		}
+	}
+	if s.File != "" {
+		desc += fmt.Sprintf(" (%s)", s.File)
+	}
+	return desc
+}
+
+// mergeLayer is a map (and where it came from)
+// in the order it was merged into the compose config.
+type mergeLayer struct {
+	source ValueSource
+	values map[string]interface{}
+}
+
+// ValueOrigin is a value that a source contributed to a path
+// in the compose config.  Directive is "replace" or "remove" if an
+// x-muss-merge directive applied to it.
+type ValueOrigin struct {
+	Source    ValueSource
+	Value     interface{}
+	Directive string
+}
+
+// Explanation describes how a value in the compose config was determined.
+type Explanation struct {
+	Path  string
+	Value interface{}
+	// Found is false if the path is not in the compose config
+	// (for example if it was removed).
+	Found bool
+	// Origins are in the order they were merged (the last one wins).
+	Origins []ValueOrigin
+}
+
+// Explain returns the value at the path (keys separated by dots) in the
+// compose config and the value each module config, include, or override
+// had for it.
+func (cfg *ProjectConfig) Explain(path string) (*Explanation, error) {
+	dcc, err := cfg.ComposeConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := strings.Split(path, ".")
+	exp := &Explanation{Path: path}
+	exp.Value, _, exp.Found = lookupPath(dcc, keys)
+
+	for _, layer := range cfg.mergeLayers {
+		if value, directive, ok := lookupPath(layer.values, keys); ok {
+			exp.Origins = append(exp.Origins, ValueOrigin{
+				Source:    layer.source,
+				Value:     value,
+				Directive: directive,
+			})
+		}
+	}
+
+	if !exp.Found && len(exp.Origins) == 0 {
+		return nil, fmt.Errorf("'%s' is not in the compose config or any module config", path)
+	}
+	return exp, nil
+}
+
+func (cfg *ProjectConfig) userOverrideFile() string {
+	if cfg.UserFile != "" && fileExists(cfg.UserFile) {
+		return cfg.UserFile
+	}
+	return cfg.ProjectFile
+}
+
+// lookupPath returns the value at the path (and any merge directive
+// that applies to it).
+// Since keys can contain dots (like labels) the shortest matching
+// key is used at each step.
+// Items in lists can be found by index or (for lists like environment)
+// by the key before "=" or ":".
+func lookupPath(value interface{}, keys []string) (interface{}, string, bool) {
+	directive := ""
+	for len(keys) > 0 {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			directives, replace := parseMergeDirectives(v)
+			if replace {
+				directive = "replace"
+			}
+			key, n := matchKey(keys, func(k string) bool {
+				_, ok := v[k]
+				return ok
+			})
+			if n == 0 {
+				if directives[keys[0]] == "remove" {
+					return nil, "remove", true
+				}
+				return nil, "", false
+			}
+			if directives[key] == "replace" {
+				directive = "replace"
+			}
+			value = v[key]
+			keys = keys[n:]
+		case []interface{}:
+			if i, err := strconv.Atoi(keys[0]); err == nil {
+				if i < 0 || i >= len(v) {
+					return nil, "", false
+				}
+				value = v[i]
+				keys = keys[1:]
+				continue
+			}
+			items := listKeyValues(v)
+			key, n := matchKey(keys, func(k string) bool {
+				_, ok := items[k]
+				return ok
+			})
+			if n == 0 {
+				return nil, "", false
+			}
+			value = items[key]
+			keys = keys[n:]
+		default:
+			return nil, "", false
+		}
+	}
+	return value, directive, true
+}
+
+// matchKey returns the shortest key (made by joining keys with dots)
+// that exists and the number of keys used (or 0 if there are none).
+func matchKey(keys []string, exists func(string) bool) (string, int) {
+	for n := 1; n <= len(keys); n++ {
+		if key := strings.Join(keys[:n], "."); exists(key) {
+			return key, n
+		}
+	}
+	return "", 0
+}
+
+// listKeyValues returns the items of a list of "KEY=VALUE" (or "KEY:VALUE")
+// strings as a map ("KEY" without a value is nil).
+func listKeyValues(list []interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(list))
+	for _, item := range list {
+		str, ok := item.(string)
+		if !ok {
+			continue
+		}
+		if i := strings.IndexAny(str, "=:"); i >= 0 {
+			result[str[:i]] = str[i+1:]
+		} else {
+			result[str] = nil
+		}
+	}
+	return result
+}
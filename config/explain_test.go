@@ -0,0 +1,96 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplain(t *testing.T) {
+	os.Unsetenv("MUSS_MODULE_ORDER")
+
+	project := `
+module_files: [../testdata/app.yml]
+default_module_order: [repo]
+module_definitions:
+- name: extra
+  params:
+    level: {type: string, default: info}
+  configs:
+    sole:
+      services:
+        web:
+          environment: ['LOG_LEVEL=${params.level}']
+          labels: {com.example.team: web}
+user:
+  override:
+    services:
+      web:
+        x-muss-merge: {stdin_open: remove}
+        environment: {PANDA: PANDA}
+`
+	_, cfg, err := parseAndCompose(project)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := func(config string, includes ...string) ValueSource {
+		return ValueSource{File: "../testdata/app.yml", Module: "app", Config: config, Includes: append([]string{}, includes...)}
+	}
+	extra := ValueSource{Module: "extra", Config: "sole", Includes: []string{}}
+	override := ValueSource{Override: true}
+
+	t.Run("overridden values in merge order", func(t *testing.T) {
+		exp, err := cfg.Explain("services.web.environment.PANDA")
+		assert.Nil(t, err)
+		assert.Equal(t, &Explanation{
+			Path:  "services.web.environment.PANDA",
+			Value: "PANDA",
+			Found: true,
+			Origins: []ValueOrigin{
+				{Source: source("repo", "_base"), Value: "BEAR"},
+				{Source: override, Value: "PANDA"},
+			},
+		}, exp)
+	})
+
+	t.Run("lists, params, and keys with dots", func(t *testing.T) {
+		exp, err := cfg.Explain("services.web.environment.LOG_LEVEL")
+		assert.Nil(t, err)
+		assert.Equal(t, []ValueOrigin{{Source: extra, Value: "info"}}, exp.Origins)
+		assert.Equal(t, "info", exp.Value)
+
+		exp, err = cfg.Explain("services.web.labels.com.example.team")
+		assert.Nil(t, err)
+		assert.Equal(t, "web", exp.Value)
+
+		exp, err = cfg.Explain("services.web.entrypoint")
+		assert.Nil(t, err)
+		assert.Equal(t, []interface{}{"/app/entrypoint"}, exp.Value)
+		assert.Equal(t, []ValueOrigin{
+			{Source: source("repo", "_base"), Value: []interface{}{"/entrypoint"}},
+			{Source: source("repo"), Value: []interface{}{"/app/entrypoint"}},
+		}, exp.Origins)
+	})
+
+	t.Run("removed", func(t *testing.T) {
+		exp, err := cfg.Explain("services.web.stdin_open")
+		assert.Nil(t, err)
+		assert.False(t, exp.Found)
+		assert.Equal(t, []ValueOrigin{
+			{Source: source("repo", "_base"), Value: true},
+			{Source: override, Directive: "remove"},
+		}, exp.Origins)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := cfg.Explain("services.web.nope")
+		assert.EqualError(t, err, "'services.web.nope' is not in the compose config or any module config")
+	})
+
+	t.Run("source descriptions", func(t *testing.T) {
+		assert.Equal(t, "module 'app' config 'repo' include '_base' (../testdata/app.yml)", source("repo", "_base").String())
+		assert.Equal(t, "user override (muss.user.yaml)", ValueSource{Override: true, File: "muss.user.yaml"}.String())
+	})
+}
@@ -0,0 +1,247 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// extendsKey lists the base project files that a project file extends.
+const extendsKey = "extends"
+
+// resolveExtends returns the project config with the base project files
+// that it extends (and any that they extend) merged beneath it.
+// Base files are relative to the file that extends them;
+// dir is the directory of that file relative to the project dir.
+// The chain holds the files currently being resolved
+// so that a cycle can be reported rather than recursing forever.
+func (cfg *ProjectConfig) resolveExtends(object map[string]interface{}, dir string, chain []string) (map[string]interface{}, error) {
+	value, ok := object[extendsKey]
+	if !ok {
+		return object, nil
+	}
+
+	var bases []string
+	if str, ok := value.(string); ok {
+		bases = []string{str}
+	} else if list, ok := stringSlice(value); ok {
+		bases = list
+	} else {
+		return nil, fmt.Errorf("invalid '%s'; must be a string or a list of strings", extendsKey)
+	}
+
+	result := map[string]interface{}{}
+	for _, base := range bases {
+		rel := base
+		if !filepath.IsAbs(rel) {
+			rel = filepath.Join(dir, base)
+		}
+		file := cfg.projectPath(rel)
+
+		link := filepath.Clean(file)
+		for _, c := range chain {
+			if sameFilePath(c, link) {
+				return nil, fmt.Errorf("invalid '%s'; cycle detected: %s", extendsKey, strings.Join(append(chain, link), " -> "))
+			}
+		}
+
+		baseObject, err := readValidatedYamlFile(file, projectConfigSchema())
+		if err != nil {
+			if _, ok := err.(ValidationErrors); ok {
+				return nil, err
+			}
+			return nil, fmt.Errorf("failed to read '%s': %w", file, err)
+		}
+		rebaseProjectPaths(baseObject, filepath.Dir(rel), file)
+
+		// Copy the chain so that sibling bases don't share a backing array.
+		next := make([]string, len(chain), len(chain)+1)
+		copy(next, chain)
+		resolved, err := cfg.resolveExtends(baseObject, filepath.Dir(rel), append(next, link))
+		if err != nil {
+			return nil, err
+		}
+		result = mergeProjectMaps(result, resolved)
+	}
+
+	project := make(map[string]interface{}, len(object))
+	for k, v := range object {
+		if k != extendsKey {
+			project[k] = v
+		}
+	}
+	return mergeProjectMaps(result, project), nil
+}
+
+// sameFilePath returns true if the (cleaned) paths refer to the same file
+// (even if one is relative).
+func sameFilePath(a, b string) bool {
+	if a == b {
+		return true
+	}
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// rebaseProjectPaths makes the env and module files of a base project file
+// relative to the project dir (rather than the base file)
+// and has the modules it defines include files relative to it.
+// Other paths (like compose_file) are for the project
+// so they are left relative to the project dir.
+func rebaseProjectPaths(object map[string]interface{}, dir, file string) {
+	for _, key := range []string{"env_files", "module_files", "service_files"} {
+		entries, ok := stringSlice(object[key])
+		if !ok {
+			continue
+		}
+		rebased := make([]interface{}, len(entries))
+		for i, entry := range entries {
+			if !isModuleRepoSource(entry) && !filepath.IsAbs(entry) {
+				entry = filepath.Join(dir, entry)
+			}
+			rebased[i] = entry
+		}
+		object[key] = rebased
+	}
+
+	for _, key := range []string{"module_definitions", "service_definitions"} {
+		defs, ok := interfaceSlice(object[key])
+		if !ok {
+			continue
+		}
+		for _, def := range defs {
+			if m, ok := def.(map[string]interface{}); ok {
+				if _, ok := m["file"]; !ok {
+					m["file"] = file
+				}
+			}
+		}
+	}
+}
+
+// mergeProjectMaps merges a project config onto a base project config:
+//
+//   - env_files and module_files are appended to the base list
+//   - module_definitions are appended except that a module with the same name
+//     as one in the base replaces it
+//   - default_module_order is prepended to the base list (so it is preferred)
+//   - secret_commands and profiles are merged by name
+//     (a command or profile with the same name replaces the base one)
+//   - anything else replaces the base value
+func mergeProjectMaps(base, project map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(base)+len(project))
+	for k, v := range base {
+		result[k] = v
+	}
+	for k, v := range project {
+		current, ok := result[k]
+		if !ok {
+			result[k] = v
+			continue
+		}
+		switch k {
+		case "env_files", "module_files", "service_files":
+			result[k] = appendLists(current, v)
+		case "module_definitions", "service_definitions":
+			result[k] = mergeModuleDefinitions(current, v)
+		case "default_module_order", "default_service_preference":
+			result[k] = uniqueList(appendLists(v, current))
+		case "secret_commands", "profiles":
+			if currentMap, ok := current.(map[string]interface{}); ok {
+				if valueMap, ok := v.(map[string]interface{}); ok {
+					merged := make(map[string]interface{}, len(currentMap)+len(valueMap))
+					for name, item := range currentMap {
+						merged[name] = item
+					}
+					for name, item := range valueMap {
+						merged[name] = item
+					}
+					result[k] = merged
+					continue
+				}
+			}
+			result[k] = v
+		default:
+			result[k] = v
+		}
+	}
+	return result
+}
+
+func appendLists(a, b interface{}) interface{} {
+	aList, ok := interfaceSlice(a)
+	bList, ok2 := interfaceSlice(b)
+	if !ok || !ok2 {
+		// Let validation of the result report it.
+		return b
+	}
+	result := make([]interface{}, 0, len(aList)+len(bList))
+	result = append(result, aList...)
+	return append(result, bList...)
+}
+
+func uniqueList(list interface{}) interface{} {
+	items, ok := interfaceSlice(list)
+	if !ok {
+		return list
+	}
+	result := make([]interface{}, 0, len(items))
+	seen := make(map[string]bool, len(items))
+	for _, item := range items {
+		if str, ok := item.(string); ok {
+			if seen[str] {
+				continue
+			}
+			seen[str] = true
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+// interfaceSlice returns the items of any kind of slice
+// (maps built in go may not use []interface{}).
+func interfaceSlice(value interface{}) ([]interface{}, bool) {
+	if list, ok := value.([]interface{}); ok {
+		return list, true
+	}
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice {
+		return nil, false
+	}
+	result := make([]interface{}, v.Len())
+	for i := range result {
+		result[i] = v.Index(i).Interface()
+	}
+	return result, true
+}
+
+func mergeModuleDefinitions(base, project interface{}) interface{} {
+	baseDefs, ok := interfaceSlice(base)
+	projectDefs, ok2 := interfaceSlice(project)
+	if !ok || !ok2 {
+		return project
+	}
+
+	names := make(map[string]bool, len(projectDefs))
+	for _, def := range projectDefs {
+		if m, ok := def.(map[string]interface{}); ok {
+			if name, ok := m["name"].(string); ok {
+				names[name] = true
+			}
+		}
+	}
+
+	result := make([]interface{}, 0, len(baseDefs)+len(projectDefs))
+	for _, def := range baseDefs {
+		if m, ok := def.(map[string]interface{}); ok {
+			if name, ok := m["name"].(string); ok && names[name] {
+				continue
+			}
+		}
+		result = append(result, def)
+	}
+	return append(result, projectDefs...)
+}
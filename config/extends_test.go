@@ -0,0 +1,119 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/get-bridge/muss/testutil"
+)
+
+func TestExtends(t *testing.T) {
+	testutil.WithTempDir(t, func(tmpdir string) {
+		os.Unsetenv("MUSS_FILE")
+		os.Unsetenv("MUSS_MODULE_ORDER")
+
+		testutil.WriteFile(t, "org/common.yaml", `
+secret_passphrase: $ORG_PASSPHRASE
+secret_commands:
+  vault: {exec: [vault, read]}
+  aws: {exec: [aws, secret]}
+`)
+		testutil.WriteFile(t, "org/base.yaml", `
+extends: common.yaml
+project_name: base
+default_module_order: [registry, repo]
+module_files: [modules/*.yml]
+module_definitions:
+- name: shared
+  configs:
+    sole:
+      include: [{file: shared.yml}]
+- name: replaced
+  configs:
+    sole: {services: {replaced: {image: base}}}
+profiles:
+  ci: {module_order: [registry]}
+`)
+		testutil.WriteFile(t, "org/modules/db.yml", `
+name: db
+configs:
+  registry: {services: {db: {image: postgres}}}
+  repo: {services: {db: {build: ../db}}}
+`)
+		testutil.WriteFile(t, "org/shared.yml", "services: {shared: {image: shared}}\n")
+
+		testutil.WriteFile(t, "app/app.yml", `
+name: app
+configs:
+  registry: {services: {app: {image: app}}}
+  repo: {services: {app: {build: .}}}
+`)
+		testutil.WriteFile(t, "app/muss.yaml", `
+extends: [../org/base.yaml]
+project_name: app
+default_module_order: [repo]
+module_files: [app.yml]
+module_definitions:
+- name: replaced
+  configs:
+    sole: {services: {replaced: {image: project}}}
+secret_commands:
+  aws: {exec: [aws, other]}
+profiles:
+  dev: {module_order: [repo]}
+`)
+
+		os.Chdir("app")
+		defer os.Chdir(tmpdir)
+
+		cfg, err := NewConfigFromDefaultFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Run("merge rules", func(t *testing.T) {
+			assert.Equal(t, "app", cfg.ProjectName, "project replaces")
+			assert.Equal(t, "$ORG_PASSPHRASE", cfg.SecretPassphrase, "inherited")
+			assert.Equal(t, []string{"repo", "registry"}, cfg.DefaultModuleOrder, "project order first")
+			assert.Equal(t, []string{"../org/modules/*.yml", "app.yml"}, cfg.ModuleFiles, "appended and relative to the base file")
+
+			assert.Equal(t, []string{"vault", "read"}, cfg.SecretCommands["vault"].Exec, "merged by name")
+			assert.Equal(t, []string{"aws", "other"}, cfg.SecretCommands["aws"].Exec, "project replaces by name")
+			assert.Equal(t, []string{"ci", "dev"}, sortedKeys(cfg.Profiles))
+
+			names := make([]string, 0)
+			for _, m := range cfg.ModuleDefinitions {
+				names = append(names, m.Name)
+			}
+			assert.Equal(t, []string{"shared", "replaced", "db", "app"}, names)
+		})
+
+		t.Run("compose", func(t *testing.T) {
+			dcc, err := cfg.ComposeConfig()
+			assert.Nil(t, err)
+			assert.Equal(t, map[string]interface{}{
+				"app":      map[string]interface{}{"build": "."},
+				"db":       map[string]interface{}{"build": "../db"},
+				"replaced": map[string]interface{}{"image": "project"},
+				"shared":   map[string]interface{}{"image": "shared"},
+			}, dcc["services"], "base includes are relative to the base file")
+		})
+
+		t.Run("errors", func(t *testing.T) {
+			_, err := NewConfigFromMap(map[string]interface{}{"extends": "missing.yaml"})
+			assert.Contains(t, err.Error(), "failed to read 'missing.yaml': ")
+
+			testutil.WriteFile(t, "cycle/a.yaml", "extends: b.yaml\n")
+			testutil.WriteFile(t, "cycle/b.yaml", "extends: ../../app/cycle/a.yaml\n")
+			_, err = NewConfigFromMap(map[string]interface{}{"extends": []string{"cycle/a.yaml"}})
+			assert.EqualError(t, err, "invalid 'extends'; cycle detected: cycle/a.yaml -> cycle/b.yaml -> ../app/cycle/a.yaml")
+
+			testutil.WriteFile(t, "invalid.yaml", "module_files: {a: b}\n")
+			_, err = NewConfigFromMap(map[string]interface{}{"extends": "invalid.yaml"})
+			assert.IsType(t, ValidationErrors{}, err)
+			assert.Contains(t, err.Error(), "invalid.yaml:1:15: module_files: expected a list")
+		})
+	})
+}
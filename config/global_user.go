@@ -0,0 +1,79 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// globalUserFile returns the path of the user file that applies to every
+// project: $XDG_CONFIG_HOME/muss/user.yaml (or ~/.config/muss/user.yaml).
+func globalUserFile() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "muss", "user.yaml")
+}
+
+// readGlobalUserFile reads and validates the global user file.
+func readGlobalUserFile(file string) (*UserConfig, error) {
+	userMap, err := readValidatedYamlFile(file, globalUserConfigSchema())
+	if err != nil {
+		return nil, err
+	}
+	return UserConfigFromMap(userMap)
+}
+
+// projectKey returns the name of the project's section
+// in the global user file: the project_name or the name of the project dir.
+func (cfg *ProjectConfig) projectKey() string {
+	if cfg.ProjectName != "" {
+		return cfg.ProjectName
+	}
+	dir := cfg.projectDir
+	if dir == "" {
+		dir = "."
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(abs)
+}
+
+// userLayer is a user config and where it came from.
+type userLayer struct {
+	source ValueSource
+	config *UserConfig
+}
+
+// userLayers returns the user configs that apply to the project
+// in order of increasing precedence: the global user file,
+// the project's section of the global user file, and the project user file.
+func (cfg *ProjectConfig) userLayers() []userLayer {
+	layers := make([]userLayer, 0, 3)
+	if cfg.GlobalUser != nil {
+		layers = append(layers, userLayer{
+			source: ValueSource{File: cfg.GlobalUserFile, Override: true},
+			config: cfg.GlobalUser,
+		})
+		key := cfg.projectKey()
+		if project := cfg.GlobalUser.Projects[key]; project != nil {
+			layers = append(layers, userLayer{
+				source: ValueSource{File: cfg.GlobalUserFile, Override: true, Section: "projects." + key},
+				config: project,
+			})
+		}
+	}
+	if cfg.User != nil {
+		layers = append(layers, userLayer{
+			source: ValueSource{File: cfg.userOverrideFile(), Override: true},
+			config: cfg.User,
+		})
+	}
+	return layers
+}
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/get-bridge/muss/testutil"
+)
+
+func TestGlobalUserFile(t *testing.T) {
+	testutil.WithTempDir(t, func(tmpdir string) {
+		os.Unsetenv("MUSS_FILE")
+		os.Unsetenv("MUSS_USER_FILE")
+		os.Unsetenv("MUSS_MODULE_ORDER")
+
+		global := filepath.Join(tmpdir, "test-config", "muss", "user.yaml")
+		assert.Equal(t, global, globalUserFile())
+
+		testutil.WriteFile(t, global, `
+module_order: [registry]
+modules:
+  stats: {disabled: true}
+  app: {params: {tag: stable}}
+override:
+  services:
+    app: {environment: {EDITOR: vim, FOO: global}}
+projects:
+  shop:
+    modules:
+      db: {config: repo}
+    override:
+      services:
+        app: {environment: {FOO: shop}}
+`)
+
+		project := `
+default_module_order: [repo]
+module_definitions:
+- name: app
+  params:
+    tag: {type: string, default: latest}
+  configs:
+    repo: {services: {app: {build: ../app}}}
+    registry: {services: {app: {image: "app:${params.tag}"}}}
+- name: db
+  configs:
+    repo: {services: {db: {build: ../db}}}
+    registry: {services: {db: {image: db}}}
+- name: stats
+  configs:
+    sole: {services: {stats: {image: stats}}}
+`
+
+		t.Run("global", func(t *testing.T) {
+			cfg := assertComposed(t, project, `
+version: '3.7'
+services:
+  app: {image: 'app:stable', environment: {EDITOR: vim, FOO: global}}
+  db: {image: db}
+`, "global user file beneath project defaults")
+			assert.Equal(t, global, cfg.GlobalUserFile)
+			assert.Equal(t, []string{"registry"}, cfg.GlobalUser.ModuleOrder)
+		})
+
+		t.Run("project section", func(t *testing.T) {
+			cfg := assertComposed(t, "project_name: shop\n"+project, `
+version: '3.7'
+services:
+  app: {image: 'app:stable', environment: {EDITOR: vim, FOO: shop}}
+  db: {build: ../db}
+`, "project section beneath the project user file")
+
+			exp, err := cfg.Explain("services.app.environment.FOO")
+			assert.Nil(t, err)
+			assert.Equal(t, []ValueOrigin{
+				{Source: ValueSource{File: global, Override: true}, Value: "global"},
+				{Source: ValueSource{File: global, Override: true, Section: "projects.shop"}, Value: "shop"},
+			}, exp.Origins)
+			assert.Equal(t, "user override 'projects.shop' ("+global+")", exp.Origins[1].Source.String())
+		})
+
+		t.Run("project user file", func(t *testing.T) {
+			testutil.WriteFile(t, "muss.user.yaml", `
+module_order: [repo]
+modules:
+  stats: {config: sole}
+  app: {params: {tag: edge}}
+override:
+  services:
+    app: {environment: {FOO: mine}}
+`)
+			defer os.Remove("muss.user.yaml")
+
+			assertComposed(t, "project_name: shop\n"+project, `
+version: '3.7'
+services:
+  app: {build: ../app, environment: {EDITOR: vim, FOO: mine}}
+  db: {build: ../db}
+  stats: {image: stats}
+`, "project user file takes precedence")
+		})
+
+		t.Run("project key", func(t *testing.T) {
+			cfg := &ProjectConfig{ProjectName: "shop"}
+			assert.Equal(t, "shop", cfg.projectKey())
+
+			os.MkdirAll("shop/sub", 0755)
+			os.Chdir("shop/sub")
+			defer os.Chdir(tmpdir)
+			cfg = &ProjectConfig{projectDir: ".."}
+			assert.Equal(t, "shop", cfg.projectKey(), "project dir name")
+		})
+
+		t.Run("invalid", func(t *testing.T) {
+			testutil.WriteFile(t, global, "services: {app: {config: repo}}\n")
+
+			assertConfigError(t, project,
+				global+":1:1: unknown key 'services' (valid keys: module_order, modules, override, projects)",
+				"deprecated keys are not valid in the global file")
+		})
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 
 	"github.com/mitchellh/mapstructure"
 	yaml "gopkg.in/yaml.v2"
@@ -16,6 +17,13 @@ func (cfg *ProjectConfig) loadDefaultFile() {
 	cfg.ProjectFile = os.Getenv("MUSS_FILE")
 	if cfg.ProjectFile == "" {
 		cfg.ProjectFile = defaultProjectFile
+		// Like git, find the project file in any parent dir
+		// so that muss works the same from anywhere in the project.
+		if found := findProjectFile(defaultProjectFile); found != "" {
+			cfg.ProjectFile = found
+			cfg.projectDir = filepath.Dir(found)
+			setProjectCacheDir(cfg.projectDir)
+		}
 	}
 
 	// If there is no config file do the best you can
@@ -25,8 +33,12 @@ func (cfg *ProjectConfig) loadDefaultFile() {
 		return
 	}
 
-	object, err := readYamlFile(cfg.ProjectFile)
+	object, err := readValidatedYamlFile(cfg.ProjectFile, projectConfigSchema())
 	if err != nil {
+		if _, ok := err.(ValidationErrors); ok {
+			cfg.LoadError = err
+			return
+		}
 		cfg.LoadError = fmt.Errorf("Failed to read config file '%s': %w", cfg.ProjectFile, err)
 		return
 	}
@@ -35,6 +47,15 @@ func (cfg *ProjectConfig) loadDefaultFile() {
 }
 
 func (cfg *ProjectConfig) loadMap(object map[string]interface{}) error {
+	chain := make([]string, 0)
+	if cfg.ProjectFile != "" {
+		chain = append(chain, filepath.Clean(cfg.ProjectFile))
+	}
+	object, err := cfg.resolveExtends(object, ".", chain)
+	if err != nil {
+		return err
+	}
+
 	if err := mapToStruct(object, cfg); err != nil {
 		return err
 	}
@@ -56,78 +77,177 @@ func (cfg *ProjectConfig) loadMap(object map[string]interface{}) error {
 		cfg.DeprecatedDefaultServicePreference = nil
 	}
 
-	loaded, err := loadModuleDefs(cfg.ModuleFiles)
+	// Collect the problems from all the files so they can be fixed at once.
+	var invalid ValidationErrors
+
+	moduleFiles, err := cfg.expandModuleFiles(cfg.ModuleFiles)
 	if err != nil {
 		return err
 	}
+
+	loaded, err := loadModuleDefs(moduleFiles)
+	if errs, ok := err.(ValidationErrors); ok {
+		invalid = append(invalid, errs...)
+	} else if err != nil {
+		return err
+	}
 	cfg.ModuleDefinitions = append(cfg.ModuleDefinitions, loaded...)
 
 	// Prefer env user file if present.
 	if envUserFile := os.Getenv("MUSS_USER_FILE"); envUserFile != "" {
 		cfg.UserFile = envUserFile
-	}
-	// If not set by env or project config use default.
-	if cfg.UserFile == "" {
-		cfg.UserFile = defaultUserFile
+	} else {
+		// If not set by env or project config use default.
+		if cfg.UserFile == "" {
+			cfg.UserFile = defaultUserFile
+		}
+		cfg.UserFile = cfg.projectPath(cfg.UserFile)
 	}
 
 	if cfg.UserFile != "" {
 		if fileExists(cfg.UserFile) {
-			userMap, err := readYamlFile(cfg.UserFile)
-			if err != nil {
-				return err
-			}
-			user, err := UserConfigFromMap(userMap)
-			if err != nil {
+			user, err := readUserFile(cfg.UserFile)
+			if errs, ok := err.(ValidationErrors); ok {
+				invalid = append(invalid, errs...)
+			} else if err != nil {
 				return err
+			} else {
+				cfg.User = user
 			}
-			cfg.User = user
 		}
 	}
 
-	if cfg.User != nil {
-		// Transform deprecated user fields.
-		if cfg.User.DeprecatedServices != nil {
-			cfg.Warn("User configuration 'services' is deprecated in favor of 'modules'.")
-			if cfg.User.Modules == nil {
-				cfg.User.Modules = make(map[string]UserModuleConfig)
-			}
-			for k, v := range cfg.User.DeprecatedServices {
-				if _, ok := cfg.User.Modules[k]; ok {
-					cfg.Warn(fmt.Sprintf("User configuration 'services.%s' ignored since 'modules.%s' is present.", k, k))
-				} else {
-					cfg.User.Modules[k] = v
-				}
-			}
-			cfg.User.DeprecatedServices = nil
-		}
-		if len(cfg.User.DeprecatedServicePreference) > 0 {
-			cfg.Warn("User configuration 'service_preference' is deprecated in favor of 'module_order'.")
-			cfg.User.ModuleOrder = append(cfg.User.DeprecatedServicePreference, cfg.User.ModuleOrder...)
-			cfg.User.DeprecatedServicePreference = nil
+	// The global user file applies to every project (beneath the user file).
+	if file := globalUserFile(); file != "" && fileExists(file) {
+		global, err := readGlobalUserFile(file)
+		if errs, ok := err.(ValidationErrors); ok {
+			invalid = append(invalid, errs...)
+		} else if err != nil {
+			return err
+		} else {
+			cfg.GlobalUserFile = file
+			cfg.GlobalUser = global
 		}
+	}
+
+	if len(invalid) > 0 {
+		return invalid
+	}
+
+	if err := checkDuplicateModules(cfg.ModuleDefinitions); err != nil {
+		return err
+	}
+
+	cfg.transformDeprecatedUserFields()
 
+	if err := cfg.SetProfile(os.Getenv("MUSS_PROFILE")); err != nil {
+		return err
 	}
 
 	return nil
 }
 
+// findProjectFile returns the path (relative to the current dir)
+// of the named file in the current dir or the closest parent dir
+// (or "" if it isn't found).
+func findProjectFile(name string) string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	prefix := ""
+	for {
+		if fileExists(filepath.Join(dir, name)) {
+			return prefix + name
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+		prefix += ".." + string(filepath.Separator)
+	}
+}
+
+// projectPath returns the path of a file in the project config
+// (which is relative to the project dir rather than the current dir).
+func (cfg *ProjectConfig) projectPath(file string) string {
+	if cfg.projectDir == "" || cfg.projectDir == "." || file == "" || filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(cfg.projectDir, file)
+}
+
+// projectRelativePath returns the path relative to the project dir
+// (the reverse of projectPath).
+func (cfg *ProjectConfig) projectRelativePath(file string) string {
+	if cfg.projectDir == "" || cfg.projectDir == "." || file == "" || filepath.IsAbs(file) {
+		return file
+	}
+	if rel, err := filepath.Rel(cfg.projectDir, file); err == nil {
+		return rel
+	}
+	return file
+}
+
+// readUserFile reads and validates a user file.
+func readUserFile(file string) (*UserConfig, error) {
+	userMap, err := readValidatedYamlFile(file, userConfigSchema())
+	if err != nil {
+		return nil, err
+	}
+	return UserConfigFromMap(userMap)
+}
+
+// transformDeprecatedUserFields moves any deprecated user fields
+// to the fields that replaced them.
+func (cfg *ProjectConfig) transformDeprecatedUserFields() {
+	if cfg.User == nil {
+		return
+	}
+	if cfg.User.DeprecatedServices != nil {
+		cfg.Warn("User configuration 'services' is deprecated in favor of 'modules'.")
+		if cfg.User.Modules == nil {
+			cfg.User.Modules = make(map[string]UserModuleConfig)
+		}
+		for k, v := range cfg.User.DeprecatedServices {
+			if _, ok := cfg.User.Modules[k]; ok {
+				cfg.Warn(fmt.Sprintf("User configuration 'services.%s' ignored since 'modules.%s' is present.", k, k))
+			} else {
+				cfg.User.Modules[k] = v
+			}
+		}
+		cfg.User.DeprecatedServices = nil
+	}
+	if len(cfg.User.DeprecatedServicePreference) > 0 {
+		cfg.Warn("User configuration 'service_preference' is deprecated in favor of 'module_order'.")
+		cfg.User.ModuleOrder = append(cfg.User.DeprecatedServicePreference, cfg.User.ModuleOrder...)
+		cfg.User.DeprecatedServicePreference = nil
+	}
+}
+
+// loadModuleDefs reads the module definitions from the files.
+// If any of the files are invalid the problems from all of them
+// are returned as ValidationErrors.
 func loadModuleDefs(files []string) ([]*ModuleDef, error) {
-	defs := make([]*ModuleDef, len(files))
-	for i, file := range files {
+	defs := make([]*ModuleDef, 0, len(files))
+	var invalid ValidationErrors
+	for _, file := range files {
 		module := newModuleDef(file)
-		msi, err := readYamlFile(file)
-		if err != nil {
+		msi, err := readValidatedYamlFile(file, moduleDefSchema())
+		if errs, ok := err.(ValidationErrors); ok {
+			invalid = append(invalid, errs...)
+			continue
+		} else if err != nil {
 			return nil, err
 		}
 		err = mapToStruct(msi, module)
 		if err != nil {
 			return nil, err
 		}
-		// TODO: validate
-		defs[i] = module
+		defs = append(defs, module)
 	}
-	return defs, nil
+	return defs, invalid.errorOrNil()
 }
 
 func fileExists(file string) bool {
@@ -186,6 +306,25 @@ func readYamlFile(file string) (map[string]interface{}, error) {
 	return parseYaml(content)
 }
 
+// readValidatedYamlFile reads the file and checks the content with the
+// validator before parsing it.  If there are problems with the content
+// they are returned as ValidationErrors.
+func readValidatedYamlFile(file string, validator nodeValidator) (map[string]interface{}, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	// Let the parser report syntax errors.
+	object, err := parseYaml(content)
+	if err != nil {
+		return nil, err
+	}
+	if errs := validateYaml(file, content, validator); len(errs) > 0 {
+		return nil, errs
+	}
+	return object, nil
+}
+
 var yamlFileCache = make(map[string][]byte)
 
 func readCachedYamlFile(file string) (map[string]interface{}, error) {
@@ -200,6 +339,20 @@ func readCachedYamlFile(file string) (map[string]interface{}, error) {
 	return parseYaml(content)
 }
 
+// readCachedValidatedYamlFile reads the file (like readCachedYamlFile)
+// and checks the content with the validator.  If there are problems with
+// the content they are returned as ValidationErrors.
+func readCachedValidatedYamlFile(file string, validator nodeValidator) (map[string]interface{}, error) {
+	object, err := readCachedYamlFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if errs := validateYaml(file, yamlFileCache[file], validator); len(errs) > 0 {
+		return nil, errs
+	}
+	return object, nil
+}
+
 // parseYaml from `[]byte` and return a `map[string]interface{}`.
 func parseYaml(content []byte) (map[string]interface{}, error) {
 	var obj map[interface{}]interface{}
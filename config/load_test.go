@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -115,6 +116,91 @@ func TestConfigLoad(t *testing.T) {
 	})
 }
 
+func TestConfigLoadFromSubdir(t *testing.T) {
+	testutil.WithTempDir(t, func(tmpdir string) {
+		os.Unsetenv("MUSS_FILE")
+		os.Unsetenv("MUSS_USER_FILE")
+		os.Unsetenv("COMPOSE_FILE")
+		defer os.Unsetenv("COMPOSE_FILE")
+		defer findCacheRoot()
+
+		testutil.WriteFile(t, defaultProjectFile, `
+module_files: [./modules/*.yml]
+compose_file: dc.yml
+`)
+		testutil.WriteFile(t, defaultUserFile, `override: {services: {app: {environment: {FOO: bar}}}}`)
+		testutil.WriteFile(t, "modules/app.yml", `
+name: app
+configs:
+  sole:
+    include: [{file: ../shared.yml}]
+    services:
+      app:
+        image: app
+        volumes: [{type: bind, source: ./data/file, target: /file, file: true}]
+`)
+		testutil.WriteFile(t, "shared.yml", "services: {app: {command: [run]}}")
+
+		expected := `#
+# THIS FILE IS GENERATED!
+#
+# To add new module definition files edit muss.yaml.
+#
+# To configure the modules you want to use edit muss.user.yaml.
+#
+
+---
+services:
+  app:
+    command:
+    - run
+    environment:
+      FOO: bar
+    image: app
+    volumes:
+    - source: ./data/file
+      target: /file
+      type: bind
+version: "3.7"
+`
+
+		cfg, err := NewConfigFromDefaultFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		rootSecretDir := secretDir
+		assert.Equal(t, "muss.yaml", cfg.ProjectFile)
+		assert.Equal(t, "muss.user.yaml", cfg.UserFile)
+		assert.Equal(t, "dc.yml", cfg.ComposeFilePath())
+		assert.Nil(t, cfg.Save())
+		assert.Equal(t, expected, testutil.ReadFile(t, "dc.yml"), "from the project dir")
+		composeFile, _ := filepath.Abs("dc.yml")
+		assert.Equal(t, composeFile, os.Getenv("COMPOSE_FILE"))
+		os.Unsetenv("COMPOSE_FILE")
+
+		os.Remove("dc.yml")
+		os.RemoveAll("data")
+		os.MkdirAll("app/src", 0755)
+		os.Chdir("app/src")
+		defer os.Chdir(tmpdir)
+
+		cfg, err = NewConfigFromDefaultFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "../../muss.yaml", cfg.ProjectFile)
+		assert.Equal(t, "../../muss.user.yaml", cfg.UserFile)
+		assert.Equal(t, "../../dc.yml", cfg.ComposeFilePath())
+		assert.Equal(t, rootSecretDir, secretDir, "same cache for the project")
+
+		assert.Nil(t, cfg.Save())
+		assert.Equal(t, expected, testutil.ReadFile(t, "../../dc.yml"), "same file from a subdir")
+		assert.Equal(t, composeFile, os.Getenv("COMPOSE_FILE"), "docker-compose can find it (from any dir)")
+		assert.FileExists(t, "../../data/file")
+		testutil.NoDirExists(t, "data")
+	})
+}
+
 type testSubThing struct {
 	List []interface{} `yaml:"list"`
 }
@@ -10,9 +10,12 @@ import (
 
 // ModuleDef represents a module definition read from a file.
 type ModuleDef struct {
-	Configs map[string]interface{} `yaml:"configs"`
-	File    string                 `yaml:"file"`
-	Name    string                 `yaml:"name"`
+	Configs   map[string]interface{}  `yaml:"configs"`
+	File      string                  `yaml:"file"`
+	Name      string                  `yaml:"name"`
+	Requires  []string                `yaml:"requires,omitempty"`
+	Conflicts []string                `yaml:"conflicts,omitempty"`
+	Params    map[string]*ModuleParam `yaml:"params,omitempty"`
 }
 
 func newModuleDef(file string) *ModuleDef {
@@ -21,95 +24,249 @@ func newModuleDef(file string) *ModuleDef {
 	}
 }
 
-func (s *ModuleDef) chooseConfig(cfg *ProjectConfig) (map[string]interface{}, error) {
+// chooseConfig returns the config to use for this module
+// (or nil if the module is disabled or has no matching config)
+// and the layers (the config and its includes) that were merged to make it.
+func (s *ModuleDef) chooseConfig(cfg *ProjectConfig) (map[string]interface{}, []mergeLayer, error) {
 	options := s.configOptions()
-	var result map[string]interface{}
-
-	// Check if user configured this module specifically.
-	userChoice := ""
-	if cfg.User != nil {
-		if userserv, ok := cfg.User.Modules[s.Name]; ok {
-			if userserv.Disabled {
-				return map[string]interface{}{}, nil
-			}
+	chosen := ""
 
-			userChoice = userserv.Config
-			if userChoice != "" {
-				if _, ok := s.Configs[userChoice]; !ok {
-					return nil, fmt.Errorf("Config '%s' for module '%s' does not exist", userChoice, s.Name)
-				}
-			}
+	// Check if user (or profile) configured this module specifically.
+	// A selection (like `config diff --use`) takes precedence over everything.
+	userChoice, selected := cfg.selectedConfigs[s.Name]
+	if userserv, ok := cfg.userModule(s.Name); ok && !selected {
+		if userserv.Disabled {
+			return nil, nil, nil
+		}
+
+		userChoice = userserv.Config
+	}
+	if userChoice != "" {
+		if _, ok := s.Configs[userChoice]; !ok {
+			return nil, nil, fmt.Errorf("Config '%s' for module '%s' does not exist", userChoice, s.Name)
 		}
 	}
 
 	order := make([]string, 0)
-	if envChoice := os.Getenv("MUSS_MODULE_ORDER"); envChoice != "" {
+	if envChoice := os.Getenv("MUSS_MODULE_ORDER"); envChoice != "" && !selected {
 		// If specified via env var, use it.
 		order = append(order, strings.Split(envChoice, ",")...)
-	} else if envChoice := os.Getenv("MUSS_SERVICE_PREFERENCE"); envChoice != "" {
+	} else if envChoice := os.Getenv("MUSS_SERVICE_PREFERENCE"); envChoice != "" && !selected {
 		cfg.Warn("MUSS_SERVICE_PREFERENCE is deprecated in favor of MUSS_MODULE_ORDER.")
 		order = append(order, envChoice)
 	} else if userChoice != "" {
 		// If user chose specifically, use it.
-		result = s.Configs[userChoice].(map[string]interface{})
+		chosen = userChoice
+		reason, err := s.unavailableReason(cfg, chosen)
+		if err != nil {
+			return nil, nil, err
+		}
+		if reason != "" {
+			cfg.Warn(fmt.Sprintf("Config '%s' for module '%s' was chosen but may not work: %s.", chosen, s.Name, reason))
+		}
 	}
 
-	// If there is only one option, use it.
+	// If there is only one option, use it (if it is available).
 	if len(options) == 1 {
-		result = s.Configs[options[0]].(map[string]interface{})
+		reason, err := s.unavailableReason(cfg, options[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		if reason == "" || chosen == options[0] {
+			chosen = options[0]
+		} else {
+			cfg.Note(fmt.Sprintf("Module '%s' skipped config '%s': %s.", s.Name, options[0], reason))
+			return nil, nil, nil
+		}
 	}
 
-	if result == nil {
-		// To determine which config option to use we can build a list...
-		// starting with any user configured preference...
-		if cfg.User != nil {
-			order = append(order, cfg.User.ModuleOrder...)
-		}
+	if chosen == "" {
+		// To determine which config option to use we can build a list
+		// starting with any profile or user configured preference
 		// followed by any project defaults...
-		order = append(order, cfg.DefaultModuleOrder...)
+		order = append(order, cfg.moduleOrder()...)
 
-		// then iterate and use the first preference that this module defines.
+		// then iterate and use the first preference that this module defines
+		// (and whose conditions are met).
 		for _, o := range order {
-			if found, ok := s.Configs[o]; ok {
-				result = found.(map[string]interface{})
+			if _, ok := s.Configs[o]; ok {
+				reason, err := s.unavailableReason(cfg, o)
+				if err != nil {
+					return nil, nil, err
+				}
+				if reason != "" {
+					cfg.Note(fmt.Sprintf("Module '%s' skipped config '%s': %s.", s.Name, o, reason))
+					continue
+				}
+				chosen = o
 				break
 			}
 		}
 	}
 
-	// TODO: recurse
-	if includes, ok := result["include"].([]interface{}); ok {
-		delete(result, "include")
-		base := map[string]interface{}{}
-		for _, i := range includes {
-			var input map[string]interface{}
-			if msi, ok := i.(map[string]interface{}); ok {
-				if file, ok := msi["file"].(string); ok && file != "" {
-					file = filepath.Join(filepath.Dir(s.File), file)
-					value, err := readCachedYamlFile(file)
-					if err != nil {
-						return nil, fmt.Errorf("failed to read '%s': %w", file, err)
-					}
-					input = value
-				} else {
-					return nil, errors.New("invalid 'include' map; valid keys: 'file'")
+	if chosen == "" {
+		return nil, nil, nil
+	}
+
+	// Modules defined in the project file include files relative to it.
+	file := s.File
+	if file == "" {
+		file = cfg.ProjectFile
+	}
+	layers := make([]mergeLayer, 0)
+	result, err := s.resolveIncludes(s.Configs[chosen].(map[string]interface{}), file, "configs."+chosen, []string{chosen}, &layers)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Conditions are only used for choosing.
+	delete(result, "when")
+
+	params, err := s.paramValues(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	substituted, err := s.substituteParams(result, params)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, layer := range layers {
+		// Values that were overridden may not have been substituted
+		// so leave them as they are if they can't be.
+		if values, err := s.substituteParams(layer.values, params); err == nil {
+			layers[i].values = values.(map[string]interface{})
+		}
+	}
+	return substituted.(map[string]interface{}), layers, nil
+}
+
+// resolveIncludes returns an interpolated copy of the config with the items
+// of its "include" list (and any of their includes) merged in beneath it.
+// Merge directives are kept so that they also apply to earlier modules.
+// Included files are relative to the file that includes them.
+// The path is the key path of the config in the file (for errors).
+// The chain holds the configs and files currently being resolved
+// so that an include cycle can be reported rather than recursing forever.
+// Each config and file is added to the layers in the order they are merged.
+func (s *ModuleDef) resolveIncludes(config map[string]interface{}, file, path string, chain []string, layers *[]mergeLayer) (map[string]interface{}, error) {
+	// Don't modify the original (it may be included or chosen again).
+	config, err := interpolateModuleConfig(config, path)
+	if err != nil {
+		return nil, inFile(file, err)
+	}
+	result := make(map[string]interface{}, len(config))
+	for k, v := range config {
+		if k != "include" {
+			result[k] = v
+		}
+	}
+
+	layer := mergeLayer{
+		source: ValueSource{
+			File:     file,
+			Module:   s.Name,
+			Config:   chain[0],
+			Includes: append([]string{}, chain[1:]...),
+		},
+		values: result,
+	}
+
+	includes, ok := config["include"].([]interface{})
+	if !ok {
+		if include, ok := config["include"]; ok {
+			result["include"] = include
+		}
+		*layers = append(*layers, layer)
+		return result, nil
+	}
+
+	base := map[string]interface{}{}
+	for _, i := range includes {
+		var input map[string]interface{}
+		var link, inputPath string
+		inputFile := file
+		if msi, ok := i.(map[string]interface{}); ok {
+			if f, ok := msi["file"].(string); ok && f != "" {
+				inputFile = filepath.Join(filepath.Dir(file), f)
+				link = "file:" + inputFile
+				if err := checkIncludeCycle(chain, link); err != nil {
+					return nil, err
 				}
-			} else if str, ok := i.(string); ok {
-				if value, ok := s.Configs[str].(map[string]interface{}); ok {
-					input = value
-				} else {
-					return nil, fmt.Errorf("invalid 'include'; config '%s' not found", str)
+				value, err := readCachedValidatedYamlFile(inputFile, moduleConfigSchema())
+				if errs, ok := err.(ValidationErrors); ok {
+					return nil, errs
+				} else if err != nil {
+					return nil, fmt.Errorf("failed to read '%s': %w", inputFile, err)
 				}
+				input = value
+			} else {
+				return nil, errors.New("invalid 'include' map; valid keys: 'file'")
+			}
+		} else if str, ok := i.(string); ok {
+			link = str
+			if err := checkIncludeCycle(chain, link); err != nil {
+				return nil, err
+			}
+			if value, ok := s.Configs[str].(map[string]interface{}); ok {
+				input = value
+				inputPath = "configs." + str
 			} else {
-				return nil, errors.New("invalid 'include' value; must be a string or a map")
+				return nil, fmt.Errorf("invalid 'include'; config '%s' not found", str)
 			}
-			base = mapMerge(base, input)
+		} else {
+			return nil, errors.New("invalid 'include' value; must be a string or a map")
+		}
+
+		// Copy the chain so that sibling includes don't share a backing array.
+		next := make([]string, len(chain), len(chain)+1)
+		copy(next, chain)
+		resolved, err := s.resolveIncludes(input, inputFile, inputPath, append(next, link), layers)
+		if err != nil {
+			return nil, err
 		}
-		result = mapMerge(base, result)
+		base = mergeIncludes(base, resolved)
+	}
+	*layers = append(*layers, layer)
+	return mergeIncludes(base, result), nil
+}
+
+// interpolateModuleConfig returns a copy of the config with its strings
+// interpolated (see interpolation).
+// Strings that muss uses (like "include" files) get the values of the
+// environment now; strings for docker-compose are checked but leave their
+// variables for it (so values like secrets aren't written to the file).
+// The "when" conditions are used as they are, and "secrets" are interpolated
+// when they are loaded (so they can use vars from env_files and env_commands).
+func interpolateModuleConfig(config map[string]interface{}, path string) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, len(config))
+	for _, k := range sortedKeys(config) {
+		var in *interpolation
+		switch k {
+		case "when", "secrets":
+			result[k] = config[k]
+			continue
+		case "include", "requires", "conflicts":
+			in = envInterpolation(false)
+		default:
+			in = envInterpolation(true)
+		}
+		value, err := in.interpolateValue(config[k], joinPath(path, k))
+		if err != nil {
+			return nil, err
+		}
+		result[k] = value
 	}
 	return result, nil
 }
 
+func checkIncludeCycle(chain []string, link string) error {
+	for _, c := range chain {
+		if c == link {
+			return fmt.Errorf("invalid 'include'; cycle detected: %s", strings.Join(append(chain, link), " -> "))
+		}
+	}
+	return nil
+}
+
 func (s *ModuleDef) configOptions() []string {
 	keys := make([]string, 0, len(s.Configs))
 	for k := range s.Configs {
@@ -119,3 +276,87 @@ func (s *ModuleDef) configOptions() []string {
 	}
 	return keys
 }
+
+func (s *ModuleDef) isDisabled(cfg *ProjectConfig) bool {
+	if userserv, ok := cfg.userModule(s.Name); ok {
+		return userserv.Disabled
+	}
+	return false
+}
+
+// dependencies returns the names of the modules that this module requires
+// and conflicts with (for the module and the chosen config)
+// and removes them from the config.
+func (s *ModuleDef) dependencies(config map[string]interface{}) (requires, conflicts []string, err error) {
+	requires = append(requires, s.Requires...)
+	conflicts = append(conflicts, s.Conflicts...)
+
+	for _, key := range []string{"requires", "conflicts"} {
+		value, ok := config[key]
+		if !ok {
+			continue
+		}
+		delete(config, key)
+
+		names, ok := value.([]interface{})
+		if !ok {
+			return nil, nil, fmt.Errorf("invalid '%s' for module '%s'; must be a list of module names", key, s.Name)
+		}
+		for _, n := range names {
+			name, ok := n.(string)
+			if !ok {
+				return nil, nil, fmt.Errorf("invalid '%s' for module '%s'; must be a list of module names", key, s.Name)
+			}
+			if key == "requires" {
+				requires = append(requires, name)
+			} else {
+				conflicts = append(conflicts, name)
+			}
+		}
+	}
+
+	return requires, conflicts, nil
+}
+
+// checkModuleDependencies ensures that every enabled module has the modules it
+// requires and none of the modules it conflicts with.
+// The configs are the chosen configs in the same order as the modules
+// (with nil for any module that is not enabled).
+func checkModuleDependencies(cfg *ProjectConfig, modules []*ModuleDef, configs []map[string]interface{}) error {
+	byName := make(map[string]int, len(modules))
+	for i, module := range modules {
+		byName[module.Name] = i
+	}
+
+	for i, module := range modules {
+		if configs[i] == nil {
+			continue
+		}
+
+		requires, conflicts, err := module.dependencies(configs[i])
+		if err != nil {
+			return err
+		}
+
+		for _, name := range requires {
+			j, ok := byName[name]
+			if !ok {
+				return fmt.Errorf("module '%s' requires module '%s' which is not defined", module.Name, name)
+			}
+			if configs[j] == nil {
+				if modules[j].isDisabled(cfg) {
+					return fmt.Errorf("module '%s' requires module '%s' which is disabled", module.Name, name)
+				}
+				return fmt.Errorf("module '%s' requires module '%s' but no config was chosen for it", module.Name, name)
+			}
+		}
+
+		for _, name := range conflicts {
+			if j, ok := byName[name]; ok && j != i && configs[j] != nil {
+				return fmt.Errorf("module '%s' conflicts with module '%s'; disable one of them", module.Name, name)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,215 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// expandModuleFiles returns the list of module files with any glob patterns
+// or directories replaced by the (sorted) files that they match.
+// Patterns can use "**" to match any number of directories.
+// Directories will include any ".yml" or ".yaml" files directly inside them.
+// Entries that refer to git repositories ("git::URL//PATH?ref=REF")
+// are expanded within a checkout of the commit pinned in the lock file.
+// Each file is only returned once (in the position it was first found).
+func (cfg *ProjectConfig) expandModuleFiles(entries []string) ([]string, error) {
+	files := make([]string, 0, len(entries))
+	seen := make(map[string]bool)
+	add := func(file string) {
+		clean := filepath.Clean(file)
+		if !seen[clean] {
+			seen[clean] = true
+			files = append(files, file)
+		}
+	}
+
+	repos := &moduleRepos{cfg: cfg}
+	for _, entry := range entries {
+		if isModuleRepoSource(entry) {
+			local, err := repos.localPath(entry)
+			if err != nil {
+				return nil, err
+			}
+			entry = local
+		} else {
+			entry = cfg.projectPath(entry)
+		}
+
+		if isGlobPattern(entry) {
+			matches, err := globFiles(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid module_files pattern '%s': %w", entry, err)
+			}
+			if len(matches) == 0 {
+				cfg.Warn(fmt.Sprintf("Module files pattern '%s' did not match any files.", entry))
+			}
+			for _, m := range matches {
+				add(m)
+			}
+		} else if info, err := os.Stat(entry); err == nil && info.IsDir() {
+			matches, err := yamlFilesInDir(entry)
+			if err != nil {
+				return nil, err
+			}
+			if len(matches) == 0 {
+				cfg.Warn(fmt.Sprintf("Module files directory '%s' does not contain any yaml files.", entry))
+			}
+			for _, m := range matches {
+				add(m)
+			}
+		} else {
+			// Let the file reader report any errors.
+			add(entry)
+		}
+	}
+
+	if err := repos.save(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func isGlobPattern(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+func isYamlFile(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == ".yml" || ext == ".yaml"
+}
+
+func yamlFilesInDir(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(infos))
+	for _, info := range infos {
+		if !info.IsDir() && isYamlFile(info.Name()) {
+			files = append(files, filepath.Join(dir, info.Name()))
+		}
+	}
+	// ReadDir returns them sorted by name.
+	return files, nil
+}
+
+// globFiles returns the sorted list of files that match the pattern.
+// In addition to the filepath.Match syntax a "**" path segment will match
+// zero or more directories.
+func globFiles(pattern string) ([]string, error) {
+	if !strings.Contains(pattern, "**") {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return onlyFiles(matches), nil
+	}
+
+	segments := strings.Split(filepath.ToSlash(pattern), "/")
+
+	// Start walking from the longest prefix without any patterns.
+	root := ""
+	for len(segments) > 0 && !isGlobPattern(segments[0]) {
+		root = filepath.Join(root, segments[0])
+		// Keep a leading "/" for absolute paths.
+		if segments[0] == "" {
+			root = string(filepath.Separator)
+		}
+		segments = segments[1:]
+	}
+	for _, s := range segments {
+		if s != "**" && strings.Contains(s, "**") {
+			return nil, fmt.Errorf("'**' must be a whole path segment")
+		}
+		// Check the syntax once (since walk errors would be confusing).
+		if _, err := filepath.Match(s, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	walkRoot := root
+	if walkRoot == "" {
+		walkRoot = "."
+	}
+
+	matches := make([]string, 0)
+	err := filepath.Walk(walkRoot, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && file == walkRoot {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(walkRoot, file)
+		if err != nil {
+			return err
+		}
+		if matchSegments(segments, strings.Split(filepath.ToSlash(rel), "/")) {
+			if root == "" {
+				matches = append(matches, rel)
+			} else {
+				matches = append(matches, file)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(matches)
+	return matches, nil
+}
+
+func matchSegments(pattern, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+	if pattern[0] == "**" {
+		// Match zero directories or consume one and try again.
+		if matchSegments(pattern[1:], parts) {
+			return true
+		}
+		return len(parts) > 0 && matchSegments(pattern, parts[1:])
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	if ok, _ := filepath.Match(pattern[0], parts[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], parts[1:])
+}
+
+func onlyFiles(paths []string) []string {
+	files := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if info, err := os.Stat(p); err == nil && !info.IsDir() {
+			files = append(files, p)
+		}
+	}
+	return files
+}
+
+// checkDuplicateModules returns an error if any modules share a name.
+func checkDuplicateModules(modules []*ModuleDef) error {
+	files := make(map[string]string, len(modules))
+	for _, m := range modules {
+		file := m.File
+		if file == "" {
+			file = "module_definitions"
+		}
+		if other, ok := files[m.Name]; ok {
+			return fmt.Errorf("module '%s' is defined in both '%s' and '%s'", m.Name, other, file)
+		}
+		files[m.Name] = file
+	}
+	return nil
+}
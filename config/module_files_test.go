@@ -0,0 +1,135 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/get-bridge/muss/testutil"
+)
+
+func writeModuleFile(t *testing.T, file, name string) {
+	t.Helper()
+	testutil.WriteFile(t, file, "name: "+name+"\nconfigs: {sole: {}}\n")
+}
+
+func TestModuleFiles(t *testing.T) {
+	testutil.WithTempDir(t, func(tmpdir string) {
+		writeModuleFile(t, filepath.Join("dev", "modules", "b.yml"), "b")
+		writeModuleFile(t, filepath.Join("dev", "modules", "a.yml"), "a")
+		writeModuleFile(t, filepath.Join("dev", "modules", "c.yaml"), "c")
+		testutil.WriteFile(t, filepath.Join("dev", "modules", "README.md"), "not a module")
+		writeModuleFile(t, filepath.Join("dev", "modules", "nested", "d.yml"), "d")
+		writeModuleFile(t, filepath.Join("dev", "modules", "nested", "deeper", "e.yml"), "e")
+		writeModuleFile(t, filepath.Join("dev", "other.yml"), "other")
+
+		expand := func(entries ...string) ([]string, *ProjectConfig) {
+			t.Helper()
+			cfg := newProjectConfig()
+			files, err := cfg.expandModuleFiles(entries)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return files, cfg
+		}
+
+		t.Run("literal files", func(t *testing.T) {
+			files, _ := expand("./dev/other.yml", "dev/modules/a.yml", "missing.yml")
+			assert.Equal(t, []string{"./dev/other.yml", "dev/modules/a.yml", "missing.yml"}, files)
+		})
+
+		t.Run("glob", func(t *testing.T) {
+			files, _ := expand("./dev/modules/*.yml")
+			assert.Equal(t, []string{"dev/modules/a.yml", "dev/modules/b.yml"}, files)
+
+			files, _ = expand("dev/modules/[bc].y*ml")
+			assert.Equal(t, []string{"dev/modules/b.yml", "dev/modules/c.yaml"}, files)
+		})
+
+		t.Run("double star", func(t *testing.T) {
+			files, _ := expand("dev/**/*.yml")
+			assert.Equal(t, []string{
+				"dev/modules/a.yml",
+				"dev/modules/b.yml",
+				"dev/modules/nested/d.yml",
+				"dev/modules/nested/deeper/e.yml",
+				"dev/other.yml",
+			}, files)
+
+			files, _ = expand("**/nested/*.yml")
+			assert.Equal(t, []string{"dev/modules/nested/d.yml"}, files)
+
+			abs := filepath.Join(tmpdir, "dev", "modules", "**", "e.yml")
+			files, _ = expand(abs)
+			assert.Equal(t, []string{filepath.Join(tmpdir, "dev", "modules", "nested", "deeper", "e.yml")}, files)
+		})
+
+		t.Run("directory", func(t *testing.T) {
+			files, _ := expand("dev/modules")
+			assert.Equal(t, []string{"dev/modules/a.yml", "dev/modules/b.yml", "dev/modules/c.yaml"}, files)
+		})
+
+		t.Run("deterministic and unique", func(t *testing.T) {
+			files, _ := expand("dev/modules/b.yml", "dev/modules", "./dev/modules/*.yml")
+			assert.Equal(t, []string{"dev/modules/b.yml", "dev/modules/a.yml", "dev/modules/c.yaml"}, files)
+		})
+
+		t.Run("no matches", func(t *testing.T) {
+			files, cfg := expand("dev/*.json", "dev/**/none.yml")
+			assert.Equal(t, []string{}, files)
+			assert.Equal(t, []string{
+				"Module files pattern 'dev/*.json' did not match any files.",
+				"Module files pattern 'dev/**/none.yml' did not match any files.",
+			}, cfg.Warnings)
+		})
+
+		t.Run("invalid pattern", func(t *testing.T) {
+			cfg := newProjectConfig()
+			_, err := cfg.expandModuleFiles([]string{"dev/**x/*.yml"})
+			assert.EqualError(t, err, "invalid module_files pattern 'dev/**x/*.yml': '**' must be a whole path segment")
+		})
+
+		t.Run("load from project config", func(t *testing.T) {
+			os.Unsetenv("MUSS_FILE")
+			os.Unsetenv("MUSS_USER_FILE")
+
+			testutil.WriteFile(t, "muss.yaml", `
+module_files:
+  - dev/other.yml
+  - dev/modules/**/*.yml
+`)
+			cfg, err := NewConfigFromDefaultFile()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			names := make([]string, len(cfg.ModuleDefinitions))
+			for i, m := range cfg.ModuleDefinitions {
+				names[i] = m.Name
+			}
+			assert.Equal(t, []string{"other", "a", "b", "d", "e"}, names)
+			assert.Equal(t, []string{"dev/other.yml", "dev/modules/**/*.yml"}, cfg.ModuleFiles, "config keeps patterns")
+		})
+
+		t.Run("duplicate module names", func(t *testing.T) {
+			writeModuleFile(t, filepath.Join("dev", "modules", "nested", "a.yml"), "a")
+
+			testutil.WriteFile(t, "muss.yaml", `
+module_files:
+  - dev/modules/**/*.yml
+`)
+			_, err := NewConfigFromDefaultFile()
+			assert.EqualError(t, err, "module 'a' is defined in both 'dev/modules/a.yml' and 'dev/modules/nested/a.yml'")
+
+			_, err = NewConfigFromMap(map[string]interface{}{
+				"module_definitions": []interface{}{
+					map[string]interface{}{"name": "a", "configs": map[string]interface{}{}},
+				},
+				"module_files": []string{"dev/modules/a.yml"},
+			})
+			assert.EqualError(t, err, "module 'a' is defined in both 'module_definitions' and 'dev/modules/a.yml'")
+		})
+	})
+}
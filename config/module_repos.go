@@ -0,0 +1,382 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// moduleRepoPrefix marks a module_files entry as a path in a git repository:
+// "git::URL//PATH?ref=REF" (like terraform module sources).
+const moduleRepoPrefix = "git::"
+
+// moduleLockFile is the name of the file (next to the project file)
+// that pins the commit used for each module repository.
+const moduleLockFile = "muss.lock"
+
+const moduleLockHeader = "# Generated by muss to pin module_files repositories.\n# Use `muss modules update` to change it.\n"
+
+type moduleRepoSource struct {
+	URL  string
+	Path string
+	Ref  string
+}
+
+func isModuleRepoSource(entry string) bool {
+	return strings.HasPrefix(entry, moduleRepoPrefix)
+}
+
+// parseModuleRepoSource splits a "git::URL//PATH?ref=REF" entry.
+// The path defaults to the root of the repository and the ref to "HEAD".
+func parseModuleRepoSource(entry string) (*moduleRepoSource, error) {
+	s := strings.TrimPrefix(entry, moduleRepoPrefix)
+	source := &moduleRepoSource{Ref: "HEAD", Path: "."}
+
+	if i := strings.LastIndex(s, "?ref="); i >= 0 {
+		if ref := s[i+len("?ref="):]; ref != "" {
+			source.Ref = ref
+		}
+		s = s[:i]
+	}
+
+	// Don't mistake the "//" in "https://" for the path separator.
+	start := 0
+	if i := strings.Index(s, "://"); i >= 0 {
+		start = i + len("://")
+	}
+	if i := strings.Index(s[start:], "//"); i >= 0 {
+		source.Path = filepath.Clean(s[start+i+2:])
+		s = s[:start+i]
+	}
+	source.URL = s
+
+	if source.URL == "" {
+		return nil, fmt.Errorf("invalid module_files entry '%s': missing repository url", entry)
+	}
+	if filepath.IsAbs(source.Path) || source.Path == ".." || strings.HasPrefix(source.Path, "../") {
+		return nil, fmt.Errorf("invalid module_files entry '%s': path must be inside the repository", entry)
+	}
+	return source, nil
+}
+
+type moduleLock struct {
+	Repos []*lockedModuleRepo `yaml:"repos"`
+}
+
+type lockedModuleRepo struct {
+	URL    string `yaml:"url"`
+	Ref    string `yaml:"ref"`
+	Commit string `yaml:"commit"`
+}
+
+func readModuleLock(file string) (*moduleLock, error) {
+	lock := &moduleLock{}
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return lock, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(content, lock); err != nil {
+		return nil, fmt.Errorf("failed to read '%s': %w", file, err)
+	}
+	return lock, nil
+}
+
+func (l *moduleLock) commit(url, ref string) string {
+	for _, r := range l.Repos {
+		if r.URL == url && r.Ref == ref {
+			return r.Commit
+		}
+	}
+	return ""
+}
+
+func (l *moduleLock) set(url, ref, commit string) {
+	for _, r := range l.Repos {
+		if r.URL == url && r.Ref == ref {
+			r.Commit = commit
+			return
+		}
+	}
+	l.Repos = append(l.Repos, &lockedModuleRepo{URL: url, Ref: ref, Commit: commit})
+}
+
+func (l *moduleLock) write(file string) error {
+	sort.Slice(l.Repos, func(i, j int) bool {
+		if l.Repos[i].URL == l.Repos[j].URL {
+			return l.Repos[i].Ref < l.Repos[j].Ref
+		}
+		return l.Repos[i].URL < l.Repos[j].URL
+	})
+	content, err := yaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append([]byte(moduleLockHeader), content...), 0644)
+}
+
+func (cfg *ProjectConfig) moduleLockPath() string {
+	return filepath.Join(filepath.Dir(cfg.ProjectFile), moduleLockFile)
+}
+
+// moduleRepos resolves module_files entries that refer to git repositories
+// (reading the lock file only if there are any).
+type moduleRepos struct {
+	cfg     *ProjectConfig
+	lock    *moduleLock
+	changed bool
+}
+
+// localPath returns the path of the entry within a checkout
+// of the commit pinned in the lock file
+// (pinning the current commit of the ref if it isn't locked yet).
+func (r *moduleRepos) localPath(entry string) (string, error) {
+	source, err := parseModuleRepoSource(entry)
+	if err != nil {
+		return "", err
+	}
+
+	if r.lock == nil {
+		if r.lock, err = readModuleLock(r.cfg.moduleLockPath()); err != nil {
+			return "", err
+		}
+	}
+
+	url := r.cfg.moduleRepoURL(source.URL)
+	commit := r.lock.commit(source.URL, source.Ref)
+	if commit == "" || !fileExists(moduleRepoCheckoutDir(url, commit)) && !gitHasCommit(moduleRepoGitDir(url), commit) {
+		if err := fetchModuleRepo(url); err != nil {
+			return "", err
+		}
+	}
+	if commit == "" {
+		if commit, err = resolveModuleRepoRef(url, source.Ref); err != nil {
+			return "", err
+		}
+		r.lock.set(source.URL, source.Ref, commit)
+		r.changed = true
+		r.cfg.Note(fmt.Sprintf("Pinned module repository '%s' (%s) to commit %s.", source.URL, source.Ref, commit))
+	}
+
+	dir, err := checkoutModuleRepo(url, commit)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, source.Path), nil
+}
+
+// save writes the lock file if any commits were pinned.
+func (r *moduleRepos) save() error {
+	if !r.changed {
+		return nil
+	}
+	return r.lock.write(r.cfg.moduleLockPath())
+}
+
+// ModuleRepoUpdate describes the change to the commit pinned for a
+// module repository (From is "" if it was not pinned before).
+type ModuleRepoUpdate struct {
+	URL  string
+	Ref  string
+	From string
+	To   string
+}
+
+// UpdateModuleRepos fetches the git repositories used in module_files
+// and pins the current commit of each ref in the lock file.
+// If any urls are given only those repositories are updated.
+func (cfg *ProjectConfig) UpdateModuleRepos(urls ...string) ([]ModuleRepoUpdate, error) {
+	lock, err := readModuleLock(cfg.moduleLockPath())
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make([]*moduleRepoSource, 0)
+	used := make(map[string]bool)
+	for _, entry := range cfg.ModuleFiles {
+		if !isModuleRepoSource(entry) {
+			continue
+		}
+		source, err := parseModuleRepoSource(entry)
+		if err != nil {
+			return nil, err
+		}
+		if len(urls) > 0 && !containsString(urls, source.URL) {
+			continue
+		}
+		used[source.URL] = true
+		sources = append(sources, source)
+	}
+	for _, url := range urls {
+		if !used[url] {
+			return nil, fmt.Errorf("no module_files entry uses repository '%s'", url)
+		}
+	}
+
+	updates := make([]ModuleRepoUpdate, 0, len(sources))
+	fetched := make(map[string]bool)
+	for _, source := range sources {
+		url := cfg.moduleRepoURL(source.URL)
+		if !fetched[url] {
+			if err := fetchModuleRepo(url); err != nil {
+				return nil, err
+			}
+			fetched[url] = true
+		}
+		// The same ref may be used for more than one path.
+		if containsUpdate(updates, source) {
+			continue
+		}
+		from := lock.commit(source.URL, source.Ref)
+		to, err := resolveModuleRepoRef(url, source.Ref)
+		if err != nil {
+			return nil, err
+		}
+		lock.set(source.URL, source.Ref, to)
+		updates = append(updates, ModuleRepoUpdate{URL: source.URL, Ref: source.Ref, From: from, To: to})
+	}
+
+	// Forget repositories that are no longer used.
+	if len(urls) == 0 {
+		kept := make([]*lockedModuleRepo, 0, len(lock.Repos))
+		for _, r := range lock.Repos {
+			if containsUpdate(updates, &moduleRepoSource{URL: r.URL, Ref: r.Ref}) {
+				kept = append(kept, r)
+			}
+		}
+		lock.Repos = kept
+	}
+
+	if err := lock.write(cfg.moduleLockPath()); err != nil {
+		return nil, err
+	}
+	return updates, nil
+}
+
+func containsUpdate(updates []ModuleRepoUpdate, source *moduleRepoSource) bool {
+	for _, u := range updates {
+		if u.URL == source.URL && u.Ref == source.Ref {
+			return true
+		}
+	}
+	return false
+}
+
+// moduleRepoURL returns the url to fetch the repository from.
+// Like other paths in the project file a relative local path
+// is relative to the project dir (rather than the working dir).
+func (cfg *ProjectConfig) moduleRepoURL(url string) string {
+	if !isLocalGitPath(url) || filepath.IsAbs(url) {
+		return url
+	}
+	// Use the same cache for the repository from any dir.
+	if abs, err := filepath.Abs(cfg.projectPath(url)); err == nil {
+		return abs
+	}
+	return cfg.projectPath(url)
+}
+
+// isLocalGitPath reports whether git would treat the url as a local path
+// (it isn't "scheme://..." or scp-like "host:path").
+func isLocalGitPath(url string) bool {
+	if strings.Contains(url, "://") {
+		return false
+	}
+	colon := strings.Index(url, ":")
+	return colon < 0 || strings.Contains(url[:colon], "/")
+}
+
+// moduleRepoGitDir returns the path of the (bare) mirror of the repository
+// in the cache dir.
+func moduleRepoGitDir(url string) string {
+	return filepath.Join(moduleRepoDir, genFileName(url), "repo.git")
+}
+
+func moduleRepoCheckoutDir(url, commit string) string {
+	return filepath.Join(moduleRepoDir, genFileName(url), commit)
+}
+
+func fetchModuleRepo(url string) error {
+	gitDir := moduleRepoGitDir(url)
+	if fileExists(gitDir) {
+		_, err := runGit(gitDir, "fetch", "--prune", "--quiet", "origin")
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(gitDir), 0700); err != nil {
+		return err
+	}
+	if _, err := runGit("", "clone", "--mirror", "--quiet", url, gitDir); err != nil {
+		os.RemoveAll(gitDir)
+		return err
+	}
+	return nil
+}
+
+func resolveModuleRepoRef(url, ref string) (string, error) {
+	commit, err := runGit(moduleRepoGitDir(url), "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("ref '%s' not found in module repository '%s'", ref, url)
+	}
+	return commit, nil
+}
+
+func gitHasCommit(gitDir, commit string) bool {
+	if !fileExists(gitDir) {
+		return false
+	}
+	_, err := runGit(gitDir, "cat-file", "-e", commit+"^{commit}")
+	return err == nil
+}
+
+// checkoutModuleRepo returns the path of a checkout of the commit
+// (creating it as a worktree of the mirror if necessary).
+// Checkouts are never modified so each commit only needs to be checked out once.
+func checkoutModuleRepo(url, commit string) (string, error) {
+	gitDir := moduleRepoGitDir(url)
+	dir := moduleRepoCheckoutDir(url, commit)
+	if fileExists(dir) {
+		return dir, nil
+	}
+
+	// Forget any checkouts that were removed.
+	if _, err := runGit(gitDir, "worktree", "prune"); err != nil {
+		return "", err
+	}
+	if _, err := runGit(gitDir, "worktree", "add", "--quiet", "--detach", dir, commit); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// runGit runs the git subcommand (for the repository if gitDir is not "")
+// and returns the output.
+func runGit(gitDir string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	argv := args
+	if gitDir != "" {
+		argv = append([]string{"--git-dir", gitDir}, args...)
+	}
+	cmd := exec.Command("git", argv...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Fail rather than wait for credentials that can't be entered.
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("git %s failed: %s", args[0], msg)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
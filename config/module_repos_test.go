@@ -0,0 +1,158 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/get-bridge/muss/testutil"
+)
+
+func TestParseModuleRepoSource(t *testing.T) {
+	tests := map[string]moduleRepoSource{
+		"git::https://example.com/org/modules.git":                         {URL: "https://example.com/org/modules.git", Path: ".", Ref: "HEAD"},
+		"git::https://example.com/org/modules.git//db/postgres.yml?ref=v1": {URL: "https://example.com/org/modules.git", Path: "db/postgres.yml", Ref: "v1"},
+		"git::git@example.com:org/modules.git//db/*.yml":                   {URL: "git@example.com:org/modules.git", Path: "db/*.yml", Ref: "HEAD"},
+		"git::/srv/modules.git//db/?ref=main":                              {URL: "/srv/modules.git", Path: "db", Ref: "main"},
+	}
+	for entry, exp := range tests {
+		source, err := parseModuleRepoSource(entry)
+		if assert.Nil(t, err, entry) {
+			assert.Equal(t, exp, *source, entry)
+		}
+	}
+
+	for url, exp := range map[string]bool{
+		"modules.git":                         true,
+		"../modules.git":                      true,
+		"/srv/modules.git":                    true,
+		"./a:b/modules.git":                   true,
+		"file:///srv/modules.git":             false,
+		"https://example.com/org/modules.git": false,
+		"git@example.com:org/modules.git":     false,
+	} {
+		assert.Equal(t, exp, isLocalGitPath(url), url)
+	}
+
+	_, err := parseModuleRepoSource("git:://db.yml")
+	assert.EqualError(t, err, "invalid module_files entry 'git:://db.yml': missing repository url")
+
+	_, err = parseModuleRepoSource("git::/srv/modules.git//../db.yml")
+	assert.EqualError(t, err, "invalid module_files entry 'git::/srv/modules.git//../db.yml': path must be inside the repository")
+}
+
+func TestModuleRepos(t *testing.T) {
+	testutil.WithTempDir(t, func(tmpdir string) {
+		setCacheRoot(filepath.Join(tmpdir, "cache"))
+		defer findCacheRoot()
+
+		origin := filepath.Join(tmpdir, "modules.git")
+		first := testutil.GitCommitFiles(t, origin, map[string]string{
+			"db/postgres.yml": "name: postgres\nconfigs: {sole: {include: [{file: ../shared.yml}]}}\n",
+			"db/redis.yml":    "name: redis\nconfigs: {sole: {services: {redis: {image: 'redis:6'}}}}\n",
+			"shared.yml":      "services: {postgres: {image: 'postgres:13'}}\n",
+		})
+
+		project := `
+module_files:
+- git::` + origin + `//db/*.yml?ref=main
+`
+		lock := func(commit string) string {
+			return moduleLockHeader + "repos:\n- url: " + origin + "\n  ref: main\n  commit: " + commit + "\n"
+		}
+
+		t.Run("pins the ref on first use", func(t *testing.T) {
+			cfg := assertComposed(t, project,
+				"{version: '3.7', services: {postgres: {image: 'postgres:13'}, redis: {image: 'redis:6'}}}",
+				"modules from repo with includes")
+
+			assert.Equal(t, lock(first), testutil.ReadFile(t, moduleLockFile))
+			assert.Equal(t, []string{
+				"Pinned module repository '" + origin + "' (main) to commit " + first + ".",
+			}, cfg.Notes)
+		})
+
+		second := testutil.GitCommitFiles(t, origin, map[string]string{
+			"db/redis.yml": "name: redis\nconfigs: {sole: {services: {redis: {image: 'redis:7'}}}}\n",
+		})
+
+		t.Run("uses the pinned commit", func(t *testing.T) {
+			cfg := assertComposed(t, project,
+				"{version: '3.7', services: {postgres: {image: 'postgres:13'}, redis: {image: 'redis:6'}}}",
+				"pinned commit")
+			assert.Empty(t, cfg.Notes)
+		})
+
+		t.Run("update", func(t *testing.T) {
+			parsed, err := parseYaml([]byte(project))
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := NewConfigFromMap(parsed)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			updates, err := cfg.UpdateModuleRepos()
+			assert.Nil(t, err)
+			assert.Equal(t, []ModuleRepoUpdate{{URL: origin, Ref: "main", From: first, To: second}}, updates)
+			assert.Equal(t, lock(second), testutil.ReadFile(t, moduleLockFile))
+
+			assertComposed(t, project,
+				"{version: '3.7', services: {postgres: {image: 'postgres:13'}, redis: {image: 'redis:7'}}}",
+				"updated commit")
+
+			_, err = cfg.UpdateModuleRepos("https://example.com/other.git")
+			assert.EqualError(t, err, "no module_files entry uses repository 'https://example.com/other.git'")
+		})
+
+		t.Run("refetches a pinned commit missing from the cache", func(t *testing.T) {
+			os.RemoveAll(moduleRepoDir)
+
+			assertComposed(t, project,
+				"{version: '3.7', services: {postgres: {image: 'postgres:13'}, redis: {image: 'redis:7'}}}",
+				"refetched")
+		})
+
+		t.Run("relative path from a subdir", func(t *testing.T) {
+			testutil.WriteFile(t, "muss.yaml", "module_files:\n- git::modules.git//db/redis.yml?ref=main\n")
+			defer os.Remove("muss.yaml")
+			defer os.Remove(moduleLockFile)
+			os.Mkdir("sub", 0755)
+			os.Chdir("sub")
+			defer os.Chdir(tmpdir)
+
+			cfg, err := NewConfigFromDefaultFile()
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual, err := cfg.ComposeConfig()
+			assert.Nil(t, err)
+			assert.Equal(t, map[string]interface{}{
+				"version":  "3.7",
+				"services": map[string]interface{}{"redis": map[string]interface{}{"image": "redis:7"}},
+			}, actual, "cloned from the project dir")
+			assert.Contains(t, testutil.ReadFile(t, "../"+moduleLockFile), "url: modules.git\n", "locked as written")
+		})
+
+		t.Run("errors", func(t *testing.T) {
+			os.Remove(moduleLockFile)
+
+			assertConfigError(t, `
+module_files:
+- git::`+origin+`//db?ref=nope
+`,
+				"ref 'nope' not found in module repository '"+origin+"'",
+				"unknown ref")
+
+			assertConfigError(t, `
+module_files:
+- git::`+filepath.Join(tmpdir, "missing.git")+`
+`,
+				"git clone failed: ",
+				"unknown repo")
+		})
+	})
+}
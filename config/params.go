@@ -0,0 +1,166 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ModuleParam defines a typed parameter that module configs can reference
+// (as "${params.NAME}") and that users can set in the user file.
+type ModuleParam struct {
+	Type        string      `yaml:"type"`
+	Default     interface{} `yaml:"default,omitempty"`
+	Description string      `yaml:"description,omitempty"`
+}
+
+var paramTypes = []string{"bool", "int", "string"}
+
+// checkType returns an error if the value does not match the param type.
+func (p *ModuleParam) checkType(value interface{}) error {
+	ok := false
+	switch p.Type {
+	case "bool":
+		_, ok = value.(bool)
+	case "int":
+		_, ok = value.(int)
+	case "string":
+		_, ok = value.(string)
+	}
+	if !ok {
+		return fmt.Errorf("must be of type %s, found %#v", p.Type, value)
+	}
+	return nil
+}
+
+func (p *ModuleParam) validType() bool {
+	for _, t := range paramTypes {
+		if p.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+// paramValues returns the value for each param the module defines
+// (from the user file or the default).
+// Params without a value are not included.
+func (s *ModuleDef) paramValues(cfg *ProjectConfig) (map[string]interface{}, error) {
+	values := make(map[string]interface{}, len(s.Params))
+
+	for _, name := range sortedKeys(s.Params) {
+		param := s.Params[name]
+		if !param.validType() {
+			return nil, fmt.Errorf("parameter '%s' of module '%s' has invalid type '%s' (valid types: %s)", name, s.Name, param.Type, strings.Join(paramTypes, ", "))
+		}
+		if param.Default != nil {
+			if err := param.checkType(param.Default); err != nil {
+				return nil, fmt.Errorf("default for parameter '%s' of module '%s' %s", name, s.Name, err)
+			}
+			values[name] = param.Default
+		}
+	}
+
+	userModule, ok := cfg.userModule(s.Name)
+	if !ok {
+		return values, nil
+	}
+
+	for _, name := range sortedKeys(userModule.Params) {
+		value := userModule.Params[name]
+		param, ok := s.Params[name]
+		if !ok {
+			return nil, fmt.Errorf("module '%s' does not define parameter '%s'", s.Name, name)
+		}
+		if err := param.checkType(value); err != nil {
+			return nil, fmt.Errorf("user parameter '%s' for module '%s' %s", name, s.Name, err)
+		}
+		values[name] = value
+	}
+
+	return values, nil
+}
+
+var reParamRef = regexp.MustCompile(`\$\$|\$\{params\.([^}]*)\}`)
+
+// substituteParams returns a copy of the value with any "${params.NAME}"
+// references replaced by the param values.
+// A string that is only a reference will be replaced by the typed value
+// (so that an int param can be used where compose expects a number).
+// As in compose "$$" escapes a "$" so "$${params.NAME}" is left alone.
+func (s *ModuleDef) substituteParams(value interface{}, params map[string]interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			sub, err := s.substituteParams(item, params)
+			if err != nil {
+				return nil, err
+			}
+			result[k] = sub
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			sub, err := s.substituteParams(item, params)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = sub
+		}
+		return result, nil
+	case string:
+		return s.substituteParamsInString(v, params)
+	}
+	return value, nil
+}
+
+func (s *ModuleDef) substituteParamsInString(str string, params map[string]interface{}) (interface{}, error) {
+	if !strings.Contains(str, "${params.") {
+		return str, nil
+	}
+
+	lookup := func(name string) (interface{}, error) {
+		if _, ok := s.Params[name]; !ok {
+			return nil, fmt.Errorf("module '%s' does not define parameter '%s'", s.Name, name)
+		}
+		value, ok := params[name]
+		if !ok {
+			return nil, fmt.Errorf("parameter '%s' for module '%s' has no default and is not set (use 'modules.%s.params.%s' in the user file)", name, s.Name, s.Name, name)
+		}
+		return value, nil
+	}
+
+	// Keep the type if the whole string is a reference.
+	if match := reParamRef.FindStringSubmatch(str); match != nil && match[0] == str && match[0] != "$$" {
+		return lookup(match[1])
+	}
+
+	var err error
+	result := reParamRef.ReplaceAllStringFunc(str, func(ref string) string {
+		if ref == "$$" || err != nil {
+			return ref
+		}
+		var value interface{}
+		value, err = lookup(reParamRef.FindStringSubmatch(ref)[1])
+		return fmt.Sprintf("%v", value)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// sortedKeys returns the keys of any map with string keys in sorted order
+// (so that errors are deterministic).
+func sortedKeys(m interface{}) []string {
+	keys := make([]string, 0)
+	for _, k := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestModuleParams(t *testing.T) {
+	modules := `
+module_definitions:
+- name: app
+  params:
+    replicas: {type: int, default: 1}
+    branch: {type: string, description: "git branch to build"}
+    debug: {type: bool, default: false}
+  configs:
+    _base:
+      services:
+        app:
+          environment:
+            DEBUG: ${params.debug}
+    repo:
+      include: [_base]
+      services:
+        app:
+          build:
+            context: ../app
+            args:
+              BRANCH: ${params.branch}
+              LABEL: "branch-${params.branch}-x${params.replicas}"
+              ESCAPED: "$${params.branch}"
+          scale: ${params.replicas}
+    registry:
+      include: [_base]
+      services:
+        app:
+          image: app:latest
+          scale: ${params.replicas}
+`
+
+	t.Run("defaults", func(t *testing.T) {
+		assertComposed(t, modules+`
+user: {module_order: [registry]}
+`,
+			`{version: '3.7', services: {app: {image: 'app:latest', scale: 1, environment: {DEBUG: false}}}}`,
+			"defaults applied with types")
+	})
+
+	t.Run("user params", func(t *testing.T) {
+		assertComposed(t, modules+`
+user:
+  module_order: [repo]
+  modules:
+    app:
+      params:
+        replicas: 3
+        branch: feature
+        debug: true
+`,
+			`
+version: '3.7'
+services:
+  app:
+    build:
+      context: ../app
+      args:
+        BRANCH: feature
+        LABEL: branch-feature-x3
+        ESCAPED: "$${params.branch}"
+    scale: 3
+    environment: {DEBUG: true}
+`,
+			"user params substituted")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		assertConfigError(t, modules+`
+user: {module_order: [repo]}
+`,
+			"parameter 'branch' for module 'app' has no default and is not set (use 'modules.app.params.branch' in the user file)",
+			"required param")
+
+		assertConfigError(t, modules+`
+user:
+  modules:
+    app:
+      config: registry
+      params: {replicas: "3"}
+`,
+			`user parameter 'replicas' for module 'app' must be of type int, found "3"`,
+			"wrong user type")
+
+		assertConfigError(t, modules+`
+user:
+  modules:
+    app:
+      config: registry
+      params: {replica: 3}
+`,
+			"module 'app' does not define parameter 'replica'",
+			"unknown user param")
+
+		assertConfigError(t, `
+module_definitions:
+- name: app
+  params:
+    port: {type: float}
+  configs:
+    sole: {}
+`,
+			"parameter 'port' of module 'app' has invalid type 'float' (valid types: bool, int, string)",
+			"invalid type")
+
+		assertConfigError(t, `
+module_definitions:
+- name: app
+  params:
+    port: {type: int, default: eighty}
+  configs:
+    sole: {}
+`,
+			`default for parameter 'port' of module 'app' must be of type int, found "eighty"`,
+			"invalid default")
+
+		assertConfigError(t, `
+module_definitions:
+- name: app
+  configs:
+    sole:
+      services:
+        app: {image: "app:${params.tag}"}
+`,
+			"module 'app' does not define parameter 'tag'",
+			"undefined param reference")
+	})
+}
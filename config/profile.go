@@ -0,0 +1,113 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Profile is a named set of module choices defined in the project file
+// that can be applied with `--profile` (or MUSS_PROFILE).
+type Profile struct {
+	ModuleOrder []string                    `yaml:"module_order,omitempty"`
+	Modules     map[string]UserModuleConfig `yaml:"modules,omitempty"`
+}
+
+// SetProfile makes the named profile active (or clears it if name is "").
+// The profile takes precedence over the user file
+// (but MUSS_MODULE_ORDER still takes precedence over both).
+func (cfg *ProjectConfig) SetProfile(name string) error {
+	if name != "" {
+		profile, ok := cfg.Profiles[name]
+		if !ok {
+			available := "none are defined"
+			if len(cfg.Profiles) > 0 {
+				available = "available profiles: " + strings.Join(sortedKeys(cfg.Profiles), ", ")
+			}
+			return fmt.Errorf("profile '%s' is not defined (%s)", name, available)
+		}
+		if profile != nil {
+			for _, module := range sortedKeys(profile.Modules) {
+				if !cfg.hasModule(module) {
+					return fmt.Errorf("profile '%s' configures module '%s' which is not defined", name, module)
+				}
+			}
+		}
+	}
+
+	cfg.ActiveProfile = name
+	// Anything generated with the previous profile is no longer valid.
+	cfg.composeConfig = nil
+	cfg.filesToGenerate = nil
+	return nil
+}
+
+func (cfg *ProjectConfig) profile() *Profile {
+	if cfg.ActiveProfile == "" {
+		return nil
+	}
+	return cfg.Profiles[cfg.ActiveProfile]
+}
+
+func (cfg *ProjectConfig) hasModule(name string) bool {
+	for _, module := range cfg.ModuleDefinitions {
+		if module.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// userModule returns the user's configuration for the named module.
+// An entry in the active profile replaces the user file entry for the module
+// (which replaces any global user file entry)
+// except that params from all of them are used
+// (with the profile's taking precedence).
+func (cfg *ProjectConfig) userModule(name string) (UserModuleConfig, bool) {
+	var result UserModuleConfig
+	found := false
+
+	for _, layer := range cfg.userLayers() {
+		if module, ok := layer.config.Modules[name]; ok {
+			result, found = overlayUserModule(result, module), true
+		}
+	}
+
+	if profile := cfg.profile(); profile != nil {
+		if module, ok := profile.Modules[name]; ok {
+			result, found = overlayUserModule(result, module), true
+		}
+	}
+
+	return result, found
+}
+
+// overlayUserModule returns the module config with any params
+// from the base that it doesn't set.
+func overlayUserModule(base, module UserModuleConfig) UserModuleConfig {
+	if len(base.Params) > 0 {
+		params := make(map[string]interface{}, len(base.Params)+len(module.Params))
+		for k, v := range base.Params {
+			params[k] = v
+		}
+		for k, v := range module.Params {
+			params[k] = v
+		}
+		module.Params = params
+	}
+	return module
+}
+
+// moduleOrder returns the preferred config names from the active profile,
+// the user file, the global user file, and the project defaults
+// (in that order).
+func (cfg *ProjectConfig) moduleOrder() []string {
+	order := make([]string, 0)
+	if profile := cfg.profile(); profile != nil {
+		order = append(order, profile.ModuleOrder...)
+	}
+	layers := cfg.userLayers()
+	for i := len(layers) - 1; i >= 0; i-- {
+		order = append(order, layers[i].config.ModuleOrder...)
+	}
+	return append(order, cfg.DefaultModuleOrder...)
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfiles(t *testing.T) {
+	os.Unsetenv("MUSS_MODULE_ORDER")
+
+	project := `
+default_module_order: [registry]
+module_definitions:
+- name: app
+  params:
+    tag: {type: string, default: latest}
+    debug: {type: bool, default: false}
+  configs:
+    repo:
+      services:
+        app: {build: ../app, environment: {DEBUG: "${params.debug}", TAG: "${params.tag}"}}
+    registry:
+      services:
+        app: {image: "app:${params.tag}", environment: {DEBUG: "${params.debug}"}}
+- name: worker
+  configs:
+    repo:
+      services:
+        worker: {build: ../worker}
+    registry:
+      services:
+        worker: {image: worker}
+profiles:
+  minimal:
+    modules:
+      worker: {disabled: true}
+  dev:
+    module_order: [repo]
+    modules:
+      app: {params: {debug: true}}
+`
+
+	t.Run("no profile", func(t *testing.T) {
+		assertComposed(t, project,
+			`{version: '3.7', services: {app: {image: 'app:latest', environment: {DEBUG: false}}, worker: {image: worker}}}`,
+			"project defaults")
+	})
+
+	t.Run("MUSS_PROFILE", func(t *testing.T) {
+		os.Setenv("MUSS_PROFILE", "minimal")
+		defer os.Unsetenv("MUSS_PROFILE")
+
+		cfg := assertComposed(t, project,
+			`{version: '3.7', services: {app: {image: 'app:latest', environment: {DEBUG: false}}}}`,
+			"profile disables module")
+		assert.Equal(t, "minimal", cfg.ActiveProfile)
+	})
+
+	t.Run("profile over user file", func(t *testing.T) {
+		os.Setenv("MUSS_PROFILE", "dev")
+		defer os.Unsetenv("MUSS_PROFILE")
+
+		assertComposed(t, project+`
+user:
+  module_order: [registry]
+  modules:
+    app: {config: registry, params: {tag: v1, debug: false}}
+`,
+			`{version: '3.7', services: {app: {build: ../app, environment: {DEBUG: true, TAG: v1}}, worker: {build: ../worker}}}`,
+			"profile order and module entry take precedence, params are merged")
+	})
+
+	t.Run("user entries for other modules", func(t *testing.T) {
+		os.Setenv("MUSS_PROFILE", "minimal")
+		defer os.Unsetenv("MUSS_PROFILE")
+
+		assertComposed(t, project+`
+user:
+  modules:
+    app: {config: repo, params: {tag: v1}}
+    worker: {config: repo}
+`,
+			`{version: '3.7', services: {app: {build: ../app, environment: {DEBUG: false, TAG: v1}}}}`,
+			"user entry used for modules the profile does not configure")
+	})
+
+	t.Run("MUSS_MODULE_ORDER over profile", func(t *testing.T) {
+		os.Setenv("MUSS_PROFILE", "dev")
+		defer os.Unsetenv("MUSS_PROFILE")
+		os.Setenv("MUSS_MODULE_ORDER", "registry")
+		defer os.Unsetenv("MUSS_MODULE_ORDER")
+
+		assertComposed(t, project,
+			`{version: '3.7', services: {app: {image: 'app:latest', environment: {DEBUG: true}}, worker: {image: worker}}}`,
+			"env order")
+	})
+
+	t.Run("SetProfile", func(t *testing.T) {
+		dc, cfg, err := parseAndCompose(project)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Contains(t, dc["services"], "worker")
+
+		assert.Nil(t, cfg.SetProfile("minimal"))
+		dc, err = cfg.ComposeConfig()
+		assert.Nil(t, err)
+		assert.NotContains(t, dc["services"], "worker", "compose config regenerated")
+
+		assert.Nil(t, cfg.SetProfile(""))
+		assert.Equal(t, "", cfg.ActiveProfile)
+
+		assert.EqualError(t, cfg.SetProfile("full"),
+			"profile 'full' is not defined (available profiles: dev, minimal)")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		os.Setenv("MUSS_PROFILE", "minimal")
+		defer os.Unsetenv("MUSS_PROFILE")
+
+		assertConfigError(t, `
+module_definitions:
+- name: app
+  configs:
+    sole: {}
+`,
+			"profile 'minimal' is not defined (none are defined)",
+			"no profiles")
+
+		assertConfigError(t, `
+module_definitions:
+- name: app
+  configs:
+    sole: {}
+profiles:
+  minimal:
+    modules:
+      ap: {disabled: true}
+`,
+			"profile 'minimal' configures module 'ap' which is not defined",
+			"unknown module")
+	})
+}
@@ -9,25 +9,39 @@ type ProjectConfig struct {
 	ModuleDefinitions  []*ModuleDef              `yaml:"module_definitions"`
 	UserFile           string                    `yaml:"user_file"`
 	User               *UserConfig               `yaml:"user"`
+	GlobalUser         *UserConfig               `yaml:"global_user,omitempty"`
 	ModuleFiles        []string                  `yaml:"module_files"`
 	SecretCommands     map[string]*SecretCommand `yaml:"secret_commands"`
 	SecretPassphrase   string                    `yaml:"secret_passphrase"`
+	SecretConcurrency  int                       `yaml:"secret_concurrency,omitempty"`
+	SecretKDF          string                    `yaml:"secret_kdf,omitempty"`
 	DefaultModuleOrder []string                  `yaml:"default_module_order"`
 	Status             *StatusConfig             `yaml:"status"`
 	ProjectName        string                    `yaml:"project_name"`
 	ComposeFile        string                    `yaml:"compose_file"`
+	EnvFiles           []string                  `yaml:"env_files,omitempty"`
+	Profiles           map[string]*Profile       `yaml:"profiles,omitempty"`
 
 	DeprecatedServiceDefinitions       []*ModuleDef `yaml:"service_definitions,omitempty"`
 	DeprecatedServiceFiles             []string     `yaml:"service_files,omitempty"`
 	DeprecatedDefaultServicePreference []string     `yaml:"default_service_preference,omitempty"`
 
-	Secrets     []envLoader `yaml:"-"`
-	ProjectFile string      `yaml:"-"`
-	LoadError   error       `yaml:"-"`
-	Warnings    []string    `yaml:"-"`
+	Secrets        []envLoader `yaml:"-"`
+	ProjectFile    string      `yaml:"-"`
+	GlobalUserFile string      `yaml:"-"`
+	ActiveProfile  string      `yaml:"-"`
+	LoadError      error       `yaml:"-"`
+	Warnings       []string    `yaml:"-"`
+	Notes          []string    `yaml:"-"`
+	// Verbose shows more of the progress while secrets load.
+	Verbose bool `yaml:"-"`
 
+	// projectDir is set when the project file is found in a parent dir.
+	projectDir      string
 	composeConfig   map[string]interface{}
+	mergeLayers     []mergeLayer
 	filesToGenerate FileGenMap
+	selectedConfigs map[string]string
 }
 
 func newProjectConfig() *ProjectConfig {
@@ -120,7 +120,7 @@ func (cfg *ProjectConfig) checkComposeFileVar() {
 	}
 	paths := strings.Split(cfile, sep)
 	for _, path := range paths {
-		if filepath.Base(path) == cfg.ComposeFilePath() {
+		if filepath.Base(path) == filepath.Base(cfg.ComposeFilePath()) {
 			return
 		}
 	}
@@ -54,7 +54,8 @@ func TestConfigSave(t *testing.T) {
 					"app": map[string]interface{}{
 						"image": "alpine",
 						"environment": map[string]interface{}{
-							"FOO": "bar",
+							"FOO":    "bar",
+							"SECRET": "${MUSS_SECRET_TEST}",
 						},
 						"volumes": []interface{}{
 							// Test that we ignore permission errors.
@@ -83,7 +84,8 @@ func TestConfigSave(t *testing.T) {
 									"app": map[string]interface{}{
 										"image": "alpine",
 										"environment": map[string]interface{}{
-											"FOO": "bar",
+											"FOO":    "bar",
+											"SECRET": "${MUSS_SECRET_TEST}",
 										},
 										"volumes": []interface{}{
 											"/muss-test-dir:/muss-test-dir",
@@ -123,6 +125,10 @@ func TestConfigSave(t *testing.T) {
 			testutil.NoFileExists(t, "./pre-existing.file")
 			touch("./pre-existing.file")
 
+			// as if exported by `eval "$(muss env)"`
+			os.Setenv("MUSS_SECRET_TEST", "exported")
+			defer os.Unsetenv("MUSS_SECRET_TEST")
+
 			cfg, _ := NewConfigFromDefaultFile()
 			err := cfg.Save()
 
@@ -145,6 +151,9 @@ func TestConfigSave(t *testing.T) {
 					"contains user file comments",
 				)
 
+				assert.NotContains(t, string(written), "exported", "secret value is not written")
+				assert.NotContains(t, string(written), "goodbye", "loaded secret value is not written")
+
 				parsed, err := parseYaml(written)
 				if err != nil {
 					t.Fatalf("failed to parse yaml: %s\n", err)
@@ -156,7 +165,7 @@ func TestConfigSave(t *testing.T) {
 			assert.FileExists(t, "./test-home/vol/file", "plain file")
 			assert.FileExists(t, "./pre-existing.file", "still a file")
 
-			assert.Equal(t, "hello", os.Getenv("MUSS_SECRET_TEST"), "loaded secret")
+			assert.Equal(t, "exported", os.Getenv("MUSS_SECRET_TEST"), "secret already set")
 			assert.Equal(t, "goodbye", os.Getenv("MUSS_SECRET_TEST_TWO"), "loaded second secret")
 
 			assert.Equal(t, 0, len(cfg.Warnings), "no warnings")
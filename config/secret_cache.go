@@ -0,0 +1,171 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// SecretInfo describes a secret of the project and its cache.
+type SecretInfo struct {
+	// VarName is empty for secrets that set vars with "parse: true".
+	VarName string
+	Module  string
+	// Provider is the secret_commands alias or provider that gets the value.
+	Provider string
+	// Cacheable is false if the provider isn't cached or cache is "none".
+	Cacheable bool
+	Cached    bool
+	CachedAt  time.Time
+	// Expires is only set if the cache is a duration
+	// (otherwise it expires when the passphrase changes).
+	Expires time.Time
+	// Value is only set if the values were requested.
+	Value string
+}
+
+// Expired returns true if the cache is older than its duration.
+func (info SecretInfo) Expired() bool {
+	return info.Cached && !info.Expires.IsZero() && time.Now().After(info.Expires)
+}
+
+// SecretsInfo returns the secrets of the chosen module configs and whether
+// they are cached.
+// The values are only included (which gets any that aren't cached)
+// if reveal is true.
+func (cfg *ProjectConfig) SecretsInfo(reveal bool) ([]SecretInfo, error) {
+	secrets, err := cfg.findSecrets(nil)
+	if err != nil {
+		return nil, err
+	}
+	if reveal {
+		if _, err := cfg.loadEnvFiles(); err != nil {
+			return nil, err
+		}
+	}
+	return secretsInfo(secrets, reveal)
+}
+
+// RefreshSecrets removes the cached values of the secrets that set the
+// varnames (or all secrets if there are none) and gets them again.
+// The values are only included in the result if reveal is true.
+func (cfg *ProjectConfig) RefreshSecrets(varnames []string, reveal bool) ([]SecretInfo, error) {
+	secrets, err := cfg.findSecrets(varnames)
+	if err != nil {
+		return nil, err
+	}
+	// Secret commands may need the env files (like when loading the env).
+	if _, err := cfg.loadEnvFiles(); err != nil {
+		return nil, err
+	}
+
+	for _, s := range secrets {
+		if err := os.Remove(s.cacheFile()); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if _, err := s.Value(); err != nil {
+			return nil, fmt.Errorf("failed to refresh secret %s: %w", s.description(), err)
+		}
+	}
+	return secretsInfo(secrets, reveal)
+}
+
+// ClearSecretCache removes the cached secrets of the project
+// (or of all projects) and returns the number of files removed.
+func (cfg *ProjectConfig) ClearSecretCache(allProjects bool) (int, error) {
+	dirs := []string{secretDir}
+	if allProjects {
+		var err error
+		dirs, err = filepath.Glob(path.Join(cacheRoot, ".muss", "*", "secrets"))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	removed := 0
+	for _, dir := range dirs {
+		files, err := filepath.Glob(path.Join(dir, "*"))
+		if err != nil {
+			return removed, err
+		}
+		for _, file := range files {
+			if err := os.Remove(file); err != nil {
+				return removed, err
+			}
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// findSecrets returns the secrets that set the varnames
+// (or all of them if there are no varnames).
+func (cfg *ProjectConfig) findSecrets(varnames []string) ([]*secretCmd, error) {
+	// The secrets are found when the compose config is generated.
+	if err := cfg.loadComposeConfig(); err != nil {
+		return nil, err
+	}
+
+	secrets := make([]*secretCmd, 0, len(cfg.Secrets))
+	for _, e := range cfg.Secrets {
+		if s, ok := e.(*secretCmd); ok {
+			if len(varnames) == 0 || containsString(varnames, s.VarName()) {
+				secrets = append(secrets, s)
+			}
+		}
+	}
+
+	for _, name := range varnames {
+		found := false
+		for _, s := range secrets {
+			if s.VarName() == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no secret sets '%s'", name)
+		}
+	}
+	return secrets, nil
+}
+
+func secretsInfo(secrets []*secretCmd, reveal bool) ([]SecretInfo, error) {
+	infos := make([]SecretInfo, len(secrets))
+	for i, s := range secrets {
+		info := SecretInfo{
+			VarName:   s.VarName(),
+			Module:    s.module,
+			Provider:  s.name,
+			Cacheable: s.cache != "none" && s.provider.Cacheable(),
+		}
+		if info.Cacheable {
+			if stat, err := os.Stat(s.cacheFile()); err == nil {
+				info.Cached = true
+				info.CachedAt = stat.ModTime()
+				if s.cacheDuration > 0 {
+					info.Expires = info.CachedAt.Add(s.cacheDuration)
+				}
+			}
+		}
+		if reveal {
+			value, err := s.Value()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get secret %s: %w", s.description(), err)
+			}
+			info.Value = string(value)
+		}
+		infos[i] = info
+	}
+	return infos, nil
+}
+
+// description returns the varname (or provider) of the secret for errors.
+func (s *secretCmd) description() string {
+	if s.VarName() != "" {
+		return s.VarName()
+	}
+	return fmt.Sprintf("from '%s' in module '%s'", s.name, s.module)
+}
@@ -0,0 +1,165 @@
+package config
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/get-bridge/muss/testutil"
+)
+
+func TestSecretCache(t *testing.T) {
+	testutil.WithTempDir(t, func(tmpdir string) {
+		findCacheRoot()
+		os.Setenv("MUSS_TEST_PASSPHRASE", "howdy")
+		defer os.Unsetenv("MUSS_TEST_PASSPHRASE")
+		os.Setenv("MUSS_TEST_SOURCE", "renamed")
+		defer os.Unsetenv("MUSS_TEST_SOURCE")
+
+		parsed, err := parseYaml([]byte(`
+secret_passphrase: $MUSS_TEST_PASSPHRASE
+secret_commands:
+  timed:
+    exec: [echo]
+    cache: 1h
+module_definitions:
+- name: app
+  configs:
+    sole:
+      secrets:
+        MUSS_TEST_CACHED: {exec: [echo, one]}
+        MUSS_TEST_TIMED: {timed: [two]}
+        MUSS_TEST_RENAMED: {env: [MUSS_TEST_SOURCE]}
+- name: other
+  configs:
+    sole:
+      secrets:
+        - exec: [echo, "MUSS_TEST_PARSED=three"]
+          parse: true
+`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg := newTestConfig(t, parsed)
+
+		info := func(name string, module string, provider string, cacheable bool) SecretInfo {
+			return SecretInfo{VarName: name, Module: module, Provider: provider, Cacheable: cacheable}
+		}
+		withoutTimes := func(secrets []SecretInfo) []SecretInfo {
+			for i := range secrets {
+				secrets[i].CachedAt = time.Time{}
+				secrets[i].Expires = time.Time{}
+			}
+			return secrets
+		}
+
+		secrets, err := cfg.SecretsInfo(false)
+		assert.Nil(t, err)
+		assert.Equal(t, []SecretInfo{
+			info("MUSS_TEST_CACHED", "app", "exec", true),
+			info("MUSS_TEST_RENAMED", "app", "env", false),
+			info("MUSS_TEST_TIMED", "app", "timed", true),
+			info("", "other", "exec", true),
+		}, secrets, "nothing cached")
+
+		secrets, err = cfg.RefreshSecrets(nil, false)
+		assert.Nil(t, err)
+		assert.True(t, secrets[2].CachedAt.Add(time.Hour).Equal(secrets[2].Expires), "expires after the duration")
+		assert.False(t, secrets[2].Expired())
+		assert.True(t, secrets[0].Expires.IsZero(), "expires with the passphrase")
+
+		cached := func(secret SecretInfo, value string) SecretInfo {
+			secret.Cached = true
+			secret.Value = value
+			return secret
+		}
+		assert.Equal(t, []SecretInfo{
+			cached(info("MUSS_TEST_CACHED", "app", "exec", true), ""),
+			info("MUSS_TEST_RENAMED", "app", "env", false),
+			cached(info("MUSS_TEST_TIMED", "app", "timed", true), ""),
+			cached(info("", "other", "exec", true), ""),
+		}, withoutTimes(secrets), "all refreshed without values")
+
+		secrets, err = cfg.SecretsInfo(true)
+		assert.Nil(t, err)
+		assert.Equal(t, []SecretInfo{
+			cached(info("MUSS_TEST_CACHED", "app", "exec", true), "one"),
+			{VarName: "MUSS_TEST_RENAMED", Module: "app", Provider: "env", Value: "renamed"},
+			cached(info("MUSS_TEST_TIMED", "app", "timed", true), "two"),
+			cached(info("", "other", "exec", true), "MUSS_TEST_PARSED=three"),
+		}, withoutTimes(secrets), "reveal")
+
+		t.Run("expired", func(t *testing.T) {
+			secret := cfg.Secrets[2].(*secretCmd)
+			old := time.Now().Add(-2 * time.Hour)
+			if err := os.Chtimes(secret.cacheFile(), old, old); err != nil {
+				t.Fatal(err)
+			}
+			secrets, err := cfg.SecretsInfo(false)
+			assert.Nil(t, err)
+			assert.True(t, secrets[2].Expired())
+
+			secrets, err = cfg.RefreshSecrets([]string{"MUSS_TEST_TIMED"}, true)
+			assert.Nil(t, err)
+			assert.Equal(t, []SecretInfo{
+				cached(info("MUSS_TEST_TIMED", "app", "timed", true), "two"),
+			}, withoutTimes(secrets), "only the named secret")
+
+			secrets, err = cfg.SecretsInfo(false)
+			assert.Nil(t, err)
+			assert.False(t, secrets[2].Expired(), "refreshed")
+		})
+
+		t.Run("unknown varname", func(t *testing.T) {
+			_, err := cfg.RefreshSecrets([]string{"MUSS_TEST_CACHED", "MUSS_TEST_NOPE"}, false)
+			assert.EqualError(t, err, "no secret sets 'MUSS_TEST_NOPE'")
+		})
+
+		t.Run("clear", func(t *testing.T) {
+			otherProject := path.Join(cacheRoot, ".muss", "other", "secrets", "file")
+			if err := writePrivateFile(otherProject, []byte("x")); err != nil {
+				t.Fatal(err)
+			}
+
+			removed, err := cfg.ClearSecretCache(false)
+			assert.Nil(t, err)
+			assert.Equal(t, 3, removed)
+			assert.FileExists(t, otherProject)
+
+			secrets, err := cfg.SecretsInfo(false)
+			assert.Nil(t, err)
+			for _, s := range secrets {
+				assert.False(t, s.Cached, s.VarName)
+			}
+
+			removed, err = cfg.ClearSecretCache(false)
+			assert.Nil(t, err)
+			assert.Equal(t, 0, removed)
+
+			removed, err = cfg.ClearSecretCache(true)
+			assert.Nil(t, err)
+			assert.Equal(t, 1, removed)
+			testutil.NoFileExists(t, otherProject)
+		})
+
+		t.Run("remove secret files", func(t *testing.T) {
+			projectFile := path.Join(secretFileDir, "DB_PASS")
+			otherFile := path.Join(cacheRoot, ".muss", "other", "secret_files", "DB_PASS")
+			for _, file := range []string{projectFile, otherFile} {
+				if err := writePrivateFile(file, []byte("x")); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			assert.Nil(t, cfg.RemoveSecretFiles(false))
+			testutil.NoFileExists(t, projectFile)
+			assert.FileExists(t, otherFile, "other projects are kept")
+
+			assert.Nil(t, cfg.RemoveSecretFiles(true))
+			testutil.NoFileExists(t, otherFile)
+		})
+	})
+}
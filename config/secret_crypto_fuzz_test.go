@@ -0,0 +1,36 @@
+//go:build go1.18
+// +build go1.18
+
+package config
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// Run with: go test ./config -run '^$' -fuzz FuzzSecretDecrypt
+func FuzzSecretDecrypt(f *testing.F) {
+	passphrase := []byte("howdy")
+	s := &secretCmd{}
+	encrypted := s.encrypt(passphrase, []byte("shh"))
+
+	f.Add(encrypted)
+	// Cheap parameters so that the fuzzer can explore the rest of the file.
+	f.Add(withKDF(encrypted, secretKDF{id: secretKDFArgon2id, time: 1, memory: 8, threads: 1}))
+	f.Add(withKDF(encrypted, secretKDF{id: secretKDFPBKDF2, time: 1}))
+	f.Add(encrypted[:secretHeaderLen])
+	f.Add(withKDF(encrypted, secretKDF{id: secretKDFArgon2id, time: 1, memory: 1 << 30, threads: 0}))
+	f.Add([]byte(secretMagic))
+	f.Add([]byte{})
+	f.Add(make([]byte, secretLegacyPrefixLen+secretbox.Overhead))
+	f.Add(append([]byte{0x00, 0x40, 0x00}, make([]byte, secretLegacyPrefixLen)...))
+
+	f.Fuzz(func(t *testing.T, content []byte) {
+		plain := s.decrypt(passphrase, content)
+		// Only the original content can be authenticated.
+		if plain != nil && string(plain) != "shh" {
+			t.Fatalf("decrypted unexpected content %q", plain)
+		}
+	})
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/nacl/secretbox"
+
+	"github.com/get-bridge/muss/testutil"
+)
+
+// encryptLegacySecret writes the v0 format (with the derived key).
+func encryptLegacySecret(t *testing.T, passphrase, content []byte, iterations uint32) []byte {
+	t.Helper()
+	nonce := [secretNonceLen]byte{}
+	salt := make([]byte, secretSaltLen)
+	if _, err := rand.Read(nonce[:]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rand.Read(salt); err != nil {
+		t.Fatal(err)
+	}
+	key := secretKDF{id: secretKDFPBKDF2, time: iterations}.key(passphrase, salt)
+
+	result := []byte{byte(iterations >> 16), byte(iterations >> 8), byte(iterations)}
+	result = append(result, nonce[:]...)
+	result = append(result, salt...)
+	result = append(result, key[:]...)
+	return secretbox.Seal(result, content, &nonce, key)
+}
+
+// withKDF returns a copy of a v1 cache file with different kdf parameters.
+func withKDF(content []byte, kdf secretKDF) []byte {
+	result := append([]byte(nil), content...)
+	header := result[len(secretMagic)+1:]
+	header[0] = kdf.id
+	binary.BigEndian.PutUint32(header[1:5], kdf.time)
+	binary.BigEndian.PutUint32(header[5:9], kdf.memory)
+	header[9] = kdf.threads
+	return result
+}
+
+func TestSecretCacheFormat(t *testing.T) {
+	passphrase := []byte("howdy")
+	plain := []byte("shh, it's a secret")
+
+	t.Run("argon2id", func(t *testing.T) {
+		s := &secretCmd{}
+		encrypted := s.encrypt(passphrase, plain)
+
+		assert.True(t, bytes.HasPrefix(encrypted, []byte("MUSS\x01\x02")), "magic, version, and kdf")
+		assert.Equal(t, secretKDF{id: secretKDFArgon2id, time: 2, memory: 19 * 1024, threads: 1},
+			secretKDF{
+				id:      encrypted[5],
+				time:    binary.BigEndian.Uint32(encrypted[6:10]),
+				memory:  binary.BigEndian.Uint32(encrypted[10:14]),
+				threads: encrypted[14],
+			}, "parameters")
+		assert.Equal(t, secretHeaderLen+secretbox.Overhead+len(plain), len(encrypted), "no key stored")
+
+		assert.Equal(t, plain, s.decrypt(passphrase, encrypted))
+		assert.Nil(t, s.decrypt([]byte("howdY"), encrypted), "wrong passphrase")
+	})
+
+	t.Run("pbkdf2", func(t *testing.T) {
+		s := &secretCmd{kdf: "pbkdf2"}
+		encrypted := s.encrypt(passphrase, plain)
+
+		assert.True(t, bytes.HasPrefix(encrypted, []byte("MUSS\x01\x01")), "magic, version, and kdf")
+		iterations := binary.BigEndian.Uint32(encrypted[6:10])
+		assert.True(t, iterations >= 1<<14 && iterations < 1<<14+1<<15, "iterations")
+
+		assert.Equal(t, plain, s.decrypt(passphrase, encrypted))
+		assert.Equal(t, plain, (&secretCmd{}).decrypt(passphrase, encrypted), "read with any kdf setting")
+	})
+
+	t.Run("legacy", func(t *testing.T) {
+		s := &secretCmd{}
+		legacy := encryptLegacySecret(t, passphrase, plain, 1<<14+123)
+		assert.Equal(t, plain, s.decrypt(passphrase, legacy))
+		assert.Nil(t, s.decrypt([]byte("howdY"), legacy), "wrong passphrase")
+		assert.Nil(t, s.decrypt(passphrase, legacy[:secretLegacyPrefixLen]), "truncated")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		s := &secretCmd{}
+		encrypted := s.encrypt(passphrase, plain)
+
+		version := append([]byte(nil), encrypted...)
+		version[4] = 2
+		assert.Nil(t, s.decrypt(passphrase, version), "unknown version")
+		assert.Nil(t, s.decrypt(passphrase, encrypted[:secretHeaderLen]), "no box")
+		assert.Nil(t, s.decrypt(passphrase, []byte("MUSS")), "no header")
+
+		for msg, kdf := range map[string]secretKDF{
+			"unknown kdf":    {id: 3, time: 2, memory: 1024, threads: 1},
+			"no passes":      {id: secretKDFArgon2id, time: 0, memory: 1024, threads: 1},
+			"no threads":     {id: secretKDFArgon2id, time: 1, memory: 1024, threads: 0},
+			"too little mem": {id: secretKDFArgon2id, time: 1, memory: 7, threads: 1},
+			"too much mem":   {id: secretKDFArgon2id, time: 1, memory: 1 << 30, threads: 1},
+			"no iterations":  {id: secretKDFPBKDF2, time: 0},
+			"too many":       {id: secretKDFPBKDF2, time: 1 << 30},
+		} {
+			assert.Nil(t, s.decrypt(passphrase, withKDF(encrypted, kdf)), msg)
+		}
+	})
+
+	t.Run("migration", func(t *testing.T) {
+		testutil.WithTempDir(t, func(tmpdir string) {
+			findCacheRoot()
+			os.Setenv("MUSS_TEST_PASSPHRASE", string(passphrase))
+			defer os.Unsetenv("MUSS_TEST_PASSPHRASE")
+
+			calls := 0
+			s := &secretCmd{
+				EnvCommand: &EnvCommand{},
+				provider: &testSecretProvider{value: func() ([]byte, error) {
+					calls++
+					return []byte("fresh"), nil
+				}},
+				providerName: "test",
+				passphrase:   "$MUSS_TEST_PASSPHRASE",
+			}
+			if err := writePrivateFile(s.cacheFile(), encryptLegacySecret(t, passphrase, plain, 1<<14)); err != nil {
+				t.Fatal(err)
+			}
+
+			value, cached, err := s.value()
+			assert.Nil(t, err)
+			assert.True(t, cached)
+			assert.Equal(t, plain, value, "reads the legacy file")
+			assert.Equal(t, 0, calls)
+
+			// The next time the secret is cached it uses the new format.
+			os.Remove(s.cacheFile())
+			value, cached, err = s.value()
+			assert.Nil(t, err)
+			assert.False(t, cached)
+			assert.Equal(t, []byte("fresh"), value)
+
+			content, err := ioutil.ReadFile(s.cacheFile())
+			assert.Nil(t, err)
+			assert.True(t, bytes.HasPrefix(content, []byte(secretMagic)), "new format")
+		})
+	})
+}
+
+type testSecretProvider struct {
+	value func() ([]byte, error)
+}
+
+func (p *testSecretProvider) Value(args []string) ([]byte, error) {
+	return p.value()
+}
+
+func (p *testSecretProvider) Cacheable() bool {
+	return true
+}
@@ -0,0 +1,232 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/get-bridge/muss/term"
+)
+
+// defaultSecretConcurrency is the number of secrets that are loaded at once
+// if the project doesn't set secret_concurrency.
+const defaultSecretConcurrency = 4
+
+// secretState is the state of a secret while the secrets are loaded.
+type secretState int
+
+const (
+	secretPending secretState = iota
+	secretRunning
+	secretCached
+	// secretSet means the var was already set (so nothing was run).
+	secretSet
+	secretDone
+	secretFailed
+)
+
+var secretStateNames = []string{"pending", "running", "cached", "set", "done", "failed"}
+
+func (s secretState) String() string {
+	return secretStateNames[s]
+}
+
+// secretProgress shows the state of each secret while they are loaded.
+// On a terminal the states are kept below the output of the commands
+// and updated in place (and removed when done).
+// While a command has written part of a line (like a password prompt)
+// the states are removed so that the cursor stays at the end of it.
+// Otherwise a line is printed when a secret fails
+// (or, if verbose, when each secret is done).
+type secretProgress struct {
+	mu      sync.Mutex
+	out     io.Writer
+	live    bool
+	verbose bool
+	labels  []string
+	states  []secretState
+	// paused is true while the output ends with part of a line.
+	paused bool
+
+	outputCh chan []byte
+	statusCh chan string
+	done     chan bool
+	finished chan bool
+}
+
+func newSecretProgress(out io.Writer, live, verbose bool, loaders []envLoader) *secretProgress {
+	p := &secretProgress{
+		out:     out,
+		live:    live,
+		verbose: verbose,
+		labels:  make([]string, len(loaders)),
+		states:  make([]secretState, len(loaders)),
+	}
+	for i, e := range loaders {
+		p.labels[i] = secretLabel(e)
+	}
+
+	if live {
+		p.outputCh = make(chan []byte)
+		p.start()
+	}
+	return p
+}
+
+// start shows the states below the output (until stopStatus).
+func (p *secretProgress) start() {
+	p.statusCh = make(chan string)
+	p.done = make(chan bool)
+	p.finished = make(chan bool)
+	go func(statusCh chan string, done, finished chan bool) {
+		term.WriteWithFixedStatusLine(p.out, p.outputCh, statusCh, done)
+		close(finished)
+	}(p.statusCh, p.done, p.finished)
+	p.statusCh <- p.status()
+}
+
+// stopStatus removes the states (leaving the cursor where they started).
+func (p *secretProgress) stopStatus() {
+	p.done <- true
+	<-p.finished
+}
+
+// resume ends the partial line and shows the states again.
+func (p *secretProgress) resume() {
+	p.paused = false
+	fmt.Fprint(p.out, "\n")
+	p.start()
+}
+
+// secretLabel returns the varname (and module) of a secret.
+func secretLabel(e envLoader) string {
+	label := e.VarName()
+	if label == "" {
+		label = "(parse)"
+	}
+	if s, ok := e.(*secretCmd); ok && s.module != "" {
+		label += " (" + s.module + ")"
+	}
+	return label
+}
+
+func (p *secretProgress) update(i int, state secretState) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.states[i] = state
+	if p.live {
+		if !p.paused {
+			p.statusCh <- p.status()
+		} else if !p.running() {
+			// Nothing is left to finish the line.
+			p.resume()
+		}
+		return
+	}
+	if state == secretFailed || state == secretDone && p.verbose {
+		fmt.Fprintf(p.out, "secret %s: %s\n", p.labels[i], state)
+	}
+}
+
+// status returns the number of secrets in each state
+// followed by a line for each secret that is running or has failed.
+func (p *secretProgress) status() string {
+	counts := make([]int, len(secretStateNames))
+	for _, s := range p.states {
+		counts[s]++
+	}
+	summary := make([]string, 0, len(counts))
+	for s, n := range counts {
+		if n > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", n, secretState(s)))
+		}
+	}
+
+	lines := []string{"# secrets: " + strings.Join(summary, ", ")}
+	for i, s := range p.states {
+		if s == secretRunning || s == secretFailed {
+			lines = append(lines, fmt.Sprintf("#   %-7s %s", s, p.labels[i]))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (p *secretProgress) running() bool {
+	for _, s := range p.states {
+		if s == secretRunning {
+			return true
+		}
+	}
+	return false
+}
+
+// writer returns the writer for the stderr of the commands
+// (which is written above the states on a terminal).
+func (p *secretProgress) writer() io.Writer {
+	if p.live {
+		return progressOutput{p}
+	}
+	return p.out
+}
+
+// stop removes the states from the terminal.
+func (p *secretProgress) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.live {
+		return
+	}
+	if p.paused {
+		p.paused = false
+		fmt.Fprint(p.out, "\n")
+		return
+	}
+	p.stopStatus()
+}
+
+// progressOutput writes whole lines above the states
+// and pauses them to write part of a line as it is.
+type progressOutput struct {
+	p *secretProgress
+}
+
+func (o progressOutput) Write(b []byte) (int, error) {
+	p := o.p
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.paused {
+		p.out.Write(b)
+		if bytes.HasSuffix(b, []byte("\n")) {
+			p.paused = false
+			p.start()
+		}
+		return len(b), nil
+	}
+
+	lines, partial := b, []byte(nil)
+	if i := bytes.LastIndexByte(b, '\n'); i < len(b)-1 {
+		lines, partial = b[:i+1], b[i+1:]
+	}
+	if len(lines) > 0 {
+		// The status line writer adds the newline.
+		p.outputCh <- append([]byte(nil), bytes.TrimRight(lines, "\n")...)
+	}
+	if len(partial) > 0 {
+		p.paused = true
+		p.stopStatus()
+		p.out.Write(partial)
+	}
+	return len(b), nil
+}
+
+// isTerminal returns true if the file is a terminal (a character device).
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,174 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/get-bridge/muss/term"
+	"github.com/get-bridge/muss/testutil"
+)
+
+type testEnvLoader struct {
+	varname string
+	value   func() ([]byte, error)
+}
+
+func (e *testEnvLoader) ShouldParse() bool {
+	return false
+}
+
+func (e *testEnvLoader) Value() ([]byte, error) {
+	return e.value()
+}
+
+func (e *testEnvLoader) VarName() string {
+	return e.varname
+}
+
+func TestSecretConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	running, most := 0, 0
+	value := func() ([]byte, error) {
+		mu.Lock()
+		running++
+		if running > most {
+			most = running
+		}
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return []byte("x"), nil
+	}
+
+	loaders := make([]envLoader, 10)
+	for i := range loaders {
+		name := "MUSS_TEST_CONCURRENT_" + string(rune('A'+i))
+		os.Unsetenv(name)
+		defer os.Unsetenv(name)
+		loaders[i] = &testEnvLoader{varname: name, value: value}
+	}
+
+	cfg := &ProjectConfig{Secrets: loaders, SecretConcurrency: 3}
+	testutil.CaptureStderr(t, func() {
+		assert.Nil(t, cfg.loadSecrets())
+	})
+	assert.Equal(t, 3, most, "limited to secret_concurrency")
+
+	for _, e := range loaders {
+		os.Unsetenv(e.VarName())
+	}
+	most = 0
+	cfg.SecretConcurrency = 0
+	testutil.CaptureStderr(t, func() {
+		assert.Nil(t, cfg.loadSecrets())
+	})
+	assert.Equal(t, defaultSecretConcurrency, most, "default limit")
+}
+
+func TestSecretProgress(t *testing.T) {
+	for _, name := range []string{"MUSS_TEST_DONE", "MUSS_TEST_FAILED", "MUSS_TEST_SET"} {
+		os.Unsetenv(name)
+		defer os.Unsetenv(name)
+	}
+	os.Setenv("MUSS_TEST_SET", "already")
+
+	t.Run("plain lines", func(t *testing.T) {
+		cfg := &ProjectConfig{Secrets: []envLoader{
+			&EnvCommand{Varname: "MUSS_TEST_DONE", Exec: []string{"sh", "-c", "echo to stderr >&2; echo ok"}},
+			&EnvCommand{Varname: "MUSS_TEST_FAILED", Exec: []string{"false"}},
+			&EnvCommand{Varname: "MUSS_TEST_SET", Exec: []string{"echo", "not run"}},
+			&secretCmd{
+				module:     "app",
+				EnvCommand: &EnvCommand{Parse: true},
+				provider:   envSecretProvider{},
+				args:       []string{"MUSS_TEST_SET"},
+				cache:      "none",
+			},
+		}}
+
+		var err error
+		stderr := testutil.CaptureStderr(t, func() {
+			err = cfg.loadSecrets()
+		})
+		if assert.NotNil(t, err) {
+			assert.Contains(t, err.Error(), "command failed: exit status 1")
+			assert.Contains(t, err.Error(), "failed to parse name=value line: already")
+		}
+
+		lines := strings.Split(strings.TrimRight(stderr, "\n"), "\n")
+		assert.ElementsMatch(t, []string{
+			"to stderr",
+			"secret MUSS_TEST_FAILED: failed",
+			"secret (parse) (app): failed",
+		}, lines, "only failures")
+		assert.Equal(t, "ok", os.Getenv("MUSS_TEST_DONE"))
+
+		os.Unsetenv("MUSS_TEST_DONE")
+		cfg.Verbose = true
+		stderr = testutil.CaptureStderr(t, func() {
+			cfg.loadSecrets()
+		})
+		lines = strings.Split(strings.TrimRight(stderr, "\n"), "\n")
+		assert.ElementsMatch(t, []string{
+			"to stderr",
+			"secret MUSS_TEST_DONE: done",
+			"secret MUSS_TEST_FAILED: failed",
+			"secret (parse) (app): failed",
+		}, lines, "verbose")
+	})
+
+	t.Run("live", func(t *testing.T) {
+		var out strings.Builder
+		loaders := []envLoader{
+			&testEnvLoader{varname: "MUSS_TEST_ONE"},
+			&secretCmd{module: "app", EnvCommand: &EnvCommand{Varname: "MUSS_TEST_TWO"}},
+			&testEnvLoader{varname: "MUSS_TEST_THREE"},
+		}
+		progress := newSecretProgress(&out, true, false, loaders)
+		progress.update(0, secretRunning)
+		progress.update(1, secretRunning)
+		progress.writer().Write([]byte("line one\nPassword: "))
+		progress.update(1, secretFailed)
+		progress.writer().Write([]byte("\n"))
+		progress.writer().Write([]byte("Again: "))
+		progress.update(0, secretCached)
+		progress.stop()
+
+		statuses := []string{
+			"# secrets: 3 pending",
+			"# secrets: 2 pending, 1 running\n#   running MUSS_TEST_ONE",
+			"# secrets: 1 pending, 2 running\n#   running MUSS_TEST_ONE\n#   running MUSS_TEST_TWO (app)",
+			"# secrets: 1 pending, 1 running, 1 failed\n#   running MUSS_TEST_ONE\n#   failed  MUSS_TEST_TWO (app)",
+			"# secrets: 1 pending, 1 cached, 1 failed\n#   failed  MUSS_TEST_TWO (app)",
+		}
+		output := out.String()
+		for _, status := range statuses {
+			assert.Contains(t, output, term.AnsiReset+status+term.AnsiReset, "status shown")
+		}
+		assert.Contains(t, output, term.AnsiEraseToEnd+"line one\n", "output above the status")
+		removed := term.AnsiEraseToEnd + term.AnsiReset + term.AnsiReset + term.AnsiStart
+		assert.Contains(t, output, removed+"Password: "+"\n"+term.AnsiEraseToEnd+term.AnsiReset+statuses[3],
+			"status paused after part of a line (until it is ended)")
+		assert.Contains(t, output, removed+"Again: "+"\n"+term.AnsiEraseToEnd+term.AnsiReset+statuses[4],
+			"status paused until nothing is running")
+		assert.True(t, strings.HasSuffix(output, removed), "status removed")
+	})
+
+	t.Run("loader errors", func(t *testing.T) {
+		state, err := loadEnv(&testEnvLoader{varname: "MUSS_TEST_FAILED", value: func() ([]byte, error) {
+			return nil, errors.New("nope")
+		}})
+		assert.Equal(t, secretFailed, state)
+		assert.EqualError(t, err, "nope")
+	})
+}
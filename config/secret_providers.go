@@ -0,0 +1,248 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SecretProvider gets the values of secrets.
+// A secret spec in a module config chooses a provider by name
+// (the same way it chooses a secret_commands alias)
+// and gives it a list of args.
+type SecretProvider interface {
+	// Value returns the value of the secret for the args
+	// (or NAME=VALUE lines if the secret spec has "parse: true").
+	Value(args []string) ([]byte, error)
+	// Cacheable returns true if values are slow to get
+	// and should be cached (encrypted with the passphrase).
+	Cacheable() bool
+}
+
+// SecretProviderContext is a SecretProvider that stops getting a value
+// when the context is done (for the "timeout" of a secret).
+// The value of other providers is abandoned when the secret times out.
+type SecretProviderContext interface {
+	ValueContext(ctx context.Context, args []string) ([]byte, error)
+}
+
+// providerValue returns the value from the provider
+// (or the error of the context if it is done first).
+func providerValue(ctx context.Context, p SecretProvider, args []string) ([]byte, error) {
+	if p, ok := p.(SecretProviderContext); ok {
+		return p.ValueContext(ctx, args)
+	}
+	if ctx.Done() == nil {
+		return p.Value(args)
+	}
+
+	type result struct {
+		value []byte
+		err   error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		value, err := p.Value(args)
+		ch <- result{value, err}
+	}()
+	select {
+	case r := <-ch:
+		return r.value, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// SecretProviderFactory returns the provider to use for a project.
+type SecretProviderFactory func(*ProjectConfig) SecretProvider
+
+var secretProviders = map[string]SecretProviderFactory{
+	"exec": func(*ProjectConfig) SecretProvider { return execSecretProvider{} },
+	"env":  func(*ProjectConfig) SecretProvider { return envSecretProvider{} },
+	"file": func(cfg *ProjectConfig) SecretProvider { return &fileSecretProvider{cfg: cfg} },
+	"http": func(*ProjectConfig) SecretProvider {
+		return &httpSecretProvider{client: &http.Client{Timeout: 30 * time.Second}}
+	},
+}
+
+// RegisterSecretProvider adds a provider that secret specs can use by name
+// (a secret_commands alias with the same name takes precedence).
+func RegisterSecretProvider(name string, factory SecretProviderFactory) {
+	secretProviders[name] = factory
+}
+
+// execSecretProvider runs the args as a command and returns its output.
+type execSecretProvider struct{}
+
+func (execSecretProvider) Value(args []string) ([]byte, error) {
+	return runCommand(context.Background(), args)
+}
+
+func (execSecretProvider) ValueContext(ctx context.Context, args []string) ([]byte, error) {
+	return runCommand(ctx, args)
+}
+
+func (execSecretProvider) Cacheable() bool {
+	return true
+}
+
+// envSecretProvider returns the value of another env var
+// (so that a secret can be renamed).
+type envSecretProvider struct{}
+
+func (envSecretProvider) Value(args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("env secret args must be the name of an env var")
+	}
+	value, ok := os.LookupEnv(args[0])
+	if !ok {
+		return nil, fmt.Errorf("env var '%s' is not set", args[0])
+	}
+	return []byte(value), nil
+}
+
+func (envSecretProvider) Cacheable() bool {
+	return false
+}
+
+// fileSecretProvider reads a value from a json, yaml, or dotenv file
+// (relative to the project dir).
+// The args are the file and an optional key (with dots for nested keys).
+// A map (like the whole file) is returned as NAME=VALUE lines.
+type fileSecretProvider struct {
+	cfg *ProjectConfig
+}
+
+func (p *fileSecretProvider) Value(args []string) ([]byte, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, errors.New("file secret args must be a file and an optional key")
+	}
+
+	file := p.cfg.projectPath(args[0])
+	values, err := readSecretFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	key := ""
+	var value interface{} = values
+	if len(args) == 2 {
+		key = args[1]
+		var ok bool
+		value, _, ok = lookupPath(value, strings.Split(key, "."))
+		if !ok {
+			return nil, fmt.Errorf("key '%s' not found in '%s'", key, file)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		var lines strings.Builder
+		for _, name := range sortedKeys(v) {
+			if !isScalarValue(v[name]) {
+				return nil, fmt.Errorf("value of '%s' in '%s' is not a string", joinPath(key, name), file)
+			}
+			lines.WriteString(FormatDotenv(name, fmt.Sprintf("%v", v[name])))
+		}
+		return []byte(lines.String()), nil
+	default:
+		if !isScalarValue(v) {
+			return nil, fmt.Errorf("value of '%s' in '%s' is not a string", key, file)
+		}
+		return []byte(fmt.Sprintf("%v", v)), nil
+	}
+}
+
+func (p *fileSecretProvider) Cacheable() bool {
+	return false
+}
+
+// readSecretFile reads a json (".json"), yaml (".yml" or ".yaml")
+// or dotenv (anything else) file.
+func readSecretFile(file string) (map[string]interface{}, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret file: %w", err)
+	}
+
+	values := make(map[string]interface{})
+	switch filepath.Ext(file) {
+	case ".json":
+		err = json.Unmarshal(content, &values)
+	case ".yml", ".yaml":
+		values, err = parseYaml(content)
+	default:
+		var env map[string]string
+		_, env, err = parseDotenv(content, nil, nil)
+		for k, v := range env {
+			values[k] = v
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse secret file '%s': %w", file, err)
+	}
+	return values, nil
+}
+
+func isScalarValue(value interface{}) bool {
+	switch value.(type) {
+	case string, bool, int, float64:
+		return true
+	}
+	return false
+}
+
+// httpSecretProvider returns the body of a GET request.
+// The args are the url and any number of "Name: value" headers
+// (interpolated like other secret args when the secret is loaded).
+type httpSecretProvider struct {
+	client *http.Client
+}
+
+func (p *httpSecretProvider) Value(args []string) ([]byte, error) {
+	return p.ValueContext(context.Background(), args)
+}
+
+func (p *httpSecretProvider) ValueContext(ctx context.Context, args []string) ([]byte, error) {
+	if len(args) < 1 {
+		return nil, errors.New("http secret args must be a url and any headers")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, args[0], nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, header := range args[1:] {
+		parts := strings.SplitN(header, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid header '%s' (expected 'Name: value')", header)
+		}
+		req.Header.Set(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("GET %s: %s", req.URL.Redacted(), resp.Status)
+	}
+	return []byte(strings.TrimRight(string(body), "\n")), nil
+}
+
+func (p *httpSecretProvider) Cacheable() bool {
+	return true
+}
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/get-bridge/muss/testutil"
+)
+
+func assertProviderValue(t *testing.T, provider SecretProvider, args []string, exp string, msg string) {
+	t.Helper()
+	value, err := provider.Value(args)
+	assert.Nil(t, err, msg)
+	assert.Equal(t, exp, string(value), msg)
+}
+
+func assertProviderError(t *testing.T, provider SecretProvider, args []string, expErr string, msg string) {
+	t.Helper()
+	_, err := provider.Value(args)
+	if assert.NotNil(t, err, msg) {
+		assert.Contains(t, err.Error(), expErr, msg)
+	}
+}
+
+func TestSecretProviders(t *testing.T) {
+	t.Run("exec", func(t *testing.T) {
+		provider := secretProviders["exec"](&ProjectConfig{})
+		assert.True(t, provider.Cacheable())
+		assertProviderValue(t, provider, []string{"echo", "a b"}, "a b", "command output")
+		assertProviderError(t, provider, []string{"false"}, "command failed: exit status 1", "command error")
+	})
+
+	t.Run("env", func(t *testing.T) {
+		os.Setenv("MUSS_TEST_SOURCE", "shh")
+		defer os.Unsetenv("MUSS_TEST_SOURCE")
+		os.Unsetenv("MUSS_TEST_UNSET")
+
+		provider := secretProviders["env"](&ProjectConfig{})
+		assert.False(t, provider.Cacheable())
+		assertProviderValue(t, provider, []string{"MUSS_TEST_SOURCE"}, "shh", "copies the var")
+		assertProviderError(t, provider, []string{"MUSS_TEST_UNSET"}, "env var 'MUSS_TEST_UNSET' is not set", "unset")
+		assertProviderError(t, provider, []string{"A", "B"}, "env secret args must be the name of an env var", "args")
+	})
+
+	t.Run("file", func(t *testing.T) {
+		testutil.WithTempDir(t, func(tmpdir string) {
+			testutil.WriteFile(t, "project/secrets.json", `{"db": {"password": "pa$$", "port": 5432}, "token": "t"}`)
+			testutil.WriteFile(t, "project/secrets.yml", "db:\n  password: \"yaml pass\"\n  hosts: [a, b]\napi:\n  KEY: k\n  URL: \"http://x\"\n")
+			testutil.WriteFile(t, "project/.env.secrets", "export TOKEN='dotenv token'\nOTHER=\"two\nlines\"\n")
+
+			provider := secretProviders["file"](&ProjectConfig{projectDir: "project"})
+			assert.False(t, provider.Cacheable())
+
+			assertProviderValue(t, provider, []string{"secrets.json", "db.password"}, "pa$$", "json key")
+			assertProviderValue(t, provider, []string{"secrets.json", "db.port"}, "5432", "json number")
+			assertProviderValue(t, provider, []string{"secrets.yml", "db.password"}, "yaml pass", "yaml key")
+			assertProviderValue(t, provider, []string{".env.secrets", "TOKEN"}, "dotenv token", "dotenv key")
+
+			assertProviderValue(t, provider, []string{"secrets.yml", "api"}, "KEY=\"k\"\nURL=\"http://x\"\n", "map as dotenv lines")
+			assertProviderValue(t, provider, []string{".env.secrets"}, "OTHER=\"two\\nlines\"\nTOKEN=\"dotenv token\"\n", "whole file")
+
+			assertProviderError(t, provider, []string{"secrets.json", "db.user"}, "key 'db.user' not found in 'project/secrets.json'", "missing key")
+			assertProviderError(t, provider, []string{"secrets.yml", "db.hosts"}, "value of 'db.hosts' in 'project/secrets.yml' is not a string", "list")
+			assertProviderError(t, provider, []string{"secrets.yml", "db"}, "value of 'db.hosts' in 'project/secrets.yml' is not a string", "nested list")
+			assertProviderError(t, provider, []string{"secrets.yml"}, "value of 'api' in 'project/secrets.yml' is not a string", "nested map")
+			assertProviderError(t, provider, []string{"missing.json"}, "failed to read secret file: open project/missing.json: ", "missing file")
+			assertProviderError(t, provider, []string{}, "file secret args must be a file and an optional key", "args")
+
+			testutil.WriteFile(t, "project/bad.json", `{"a":`)
+			assertProviderError(t, provider, []string{"bad.json", "a"}, "failed to parse secret file 'project/bad.json': ", "invalid file")
+		})
+	})
+
+	t.Run("http", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer t0k$3n" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			switch r.URL.Path {
+			case "/secret":
+				w.Write([]byte("the secret\n"))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer server.Close()
+
+		provider := secretProviders["http"](&ProjectConfig{})
+		assert.True(t, provider.Cacheable())
+
+		auth := "Authorization: Bearer t0k$3n"
+		assertProviderValue(t, provider, []string{server.URL + "/secret", auth}, "the secret", "gets the body")
+		assertProviderError(t, provider, []string{server.URL + "/secret"}, "GET "+server.URL+"/secret: 403 Forbidden", "no header")
+		assertProviderError(t, provider, []string{server.URL + "/other", auth}, "GET "+server.URL+"/other: 404 Not Found", "not found")
+		assertProviderError(t, provider, []string{server.URL, "Authorization"}, "invalid header 'Authorization' (expected 'Name: value')", "invalid header")
+		assertProviderError(t, provider, []string{}, "http secret args must be a url and any headers", "args")
+	})
+}
+
+func TestSecretSpecProviders(t *testing.T) {
+	testutil.WithTempDir(t, func(tmpdir string) {
+		findCacheRoot()
+		os.Setenv("MUSS_TEST_PASSPHRASE", "howdy")
+		defer os.Unsetenv("MUSS_TEST_PASSPHRASE")
+		os.Setenv("MUSS_TEST_SOURCE", "renamed")
+		defer os.Unsetenv("MUSS_TEST_SOURCE")
+		os.Unsetenv("MUSS_TEST_SECRET")
+		defer os.Unsetenv("MUSS_TEST_SECRET")
+
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Write([]byte("from http"))
+		}))
+		defer server.Close()
+
+		cfg := &ProjectConfig{
+			SecretCommands: map[string]*SecretCommand{
+				"file": {Exec: []string{"echo", "alias"}},
+			},
+		}
+
+		load := func(spec map[string]interface{}) string {
+			t.Helper()
+			os.Unsetenv("MUSS_TEST_SECRET")
+			secret, err := parseSecret(cfg, spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			testLoadSecret(t, secret)
+			return os.Getenv("MUSS_TEST_SECRET")
+		}
+
+		assert.Equal(t, "renamed", load(map[string]interface{}{
+			"env": []string{"MUSS_TEST_SOURCE"}, "varname": "MUSS_TEST_SECRET",
+		}), "env provider (without a passphrase since it isn't cached)")
+
+		httpSpec := map[string]interface{}{"http": []string{server.URL}, "varname": "MUSS_TEST_SECRET"}
+		os.Unsetenv("MUSS_TEST_SECRET")
+		assert.Equal(t, "a passphrase is required to use secrets", testSecretError(t, cfg, httpSpec))
+
+		cfg.SecretPassphrase = "$MUSS_TEST_PASSPHRASE"
+
+		assert.Equal(t, "alias secrets.json", load(map[string]interface{}{
+			"file": []string{"secrets.json"}, "varname": "MUSS_TEST_SECRET",
+		}), "alias takes precedence")
+
+		assert.Equal(t, "from http", load(httpSpec), "http provider")
+		assert.Equal(t, "from http", load(httpSpec), "http provider cached")
+		assert.Equal(t, 1, requests, "cached")
+
+		_, err := parseSecret(cfg, map[string]interface{}{"nope": []string{"x"}})
+		assert.EqualError(t, err, "failed to prepare secret command 'nope'")
+	})
+}
@@ -1,20 +1,17 @@
 package config
 
 import (
-	"crypto/rand"
+	"context"
 	"crypto/sha1"
-	"crypto/sha512"
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"math/big"
 	"os"
 	"path"
+	"path/filepath"
+	"regexp"
 	"sync"
 	"time"
-
-	"golang.org/x/crypto/nacl/secretbox"
-	"golang.org/x/crypto/pbkdf2"
 )
 
 // SecretCommand holds setup information for secrets that use it.
@@ -23,16 +20,40 @@ type SecretCommand struct {
 	Exec        []string      `yaml:"exec"`
 	EnvCommands []*EnvCommand `yaml:"env_commands"`
 	Passphrase  string        `yaml:"passphrase"`
+	// Timeout, Retries, and RetryBackoff are the defaults
+	// for the secrets that use the command (see EnvCommand).
+	Timeout      string `yaml:"timeout,omitempty"`
+	Retries      int    `yaml:"retries,omitempty"`
+	RetryBackoff string `yaml:"retry_backoff,omitempty"`
 }
 
+var cacheRoot string
 var secretDir string
+var secretFileDir string
+var moduleRepoDir string
 
 type secretCmd struct {
 	name string
+	// module is the name of the module that uses the secret.
+	module string
 	*EnvCommand
+	provider     SecretProvider
+	providerName string
+	args         []string
+	// literalArgs is the number of args (from the secret_commands exec)
+	// that are used as they are; the rest are interpolated (see expandArgs).
+	literalArgs   int
 	passphrase    string
+	kdf           string
 	cache         string
 	cacheDuration time.Duration
+	limits        commandLimits
+	// asFile is true if the value is written to a file for a compose secret
+	// (named by the varname) rather than set in the env.
+	asFile bool
+	// parsedNames are the vars set from the output (for "parse: true")
+	// when the secret was loaded.
+	parsedNames []string
 }
 
 func init() {
@@ -49,12 +70,22 @@ func findCacheRoot() {
 }
 
 func setCacheRoot(dir string) {
-	wd, wdErr := os.Getwd()
-	if wdErr != nil {
-		panic(wdErr)
+	cacheRoot = dir
+	setProjectCacheDir(".")
+}
+
+// setProjectCacheDir sets the cache dirs for the project in the dir
+// (so that the same cache is used from any of its subdirectories).
+func setProjectCacheDir(dir string) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		panic(err)
 	}
 
-	secretDir = path.Join(dir, ".muss", genFileName(path.Clean(wd)), "secrets")
+	projectCache := path.Join(cacheRoot, ".muss", genFileName(path.Clean(abs)))
+	secretDir = path.Join(projectCache, "secrets")
+	secretFileDir = path.Join(projectCache, "secret_files")
+	moduleRepoDir = path.Join(projectCache, "modules")
 }
 
 type secretSetup struct {
@@ -64,11 +95,16 @@ type secretSetup struct {
 
 var secretEnvCommands = make(map[string]*secretSetup)
 
+// reVarname matches the names of env vars (which secret files are named by).
+var reVarname = regexp.MustCompile(`^[_a-zA-Z][_a-zA-Z0-9]*$`)
+
 func parseSecret(cfg *ProjectConfig, spec map[string]interface{}) (*secretCmd, error) {
 	var name string
 	var args []string
 	var varname string
 	var parse bool
+	var as string
+	limitSpec := make(map[string]interface{})
 
 	for k, v := range spec {
 		switch k {
@@ -76,6 +112,13 @@ func parseSecret(cfg *ProjectConfig, spec map[string]interface{}) (*secretCmd, e
 			varname = v.(string)
 		case "parse":
 			parse = v.(bool)
+		case "timeout", "retries", "retry_backoff":
+			limitSpec[k] = v
+		case "as":
+			as, _ = v.(string)
+			if as != "env" && as != "file" {
+				return nil, fmt.Errorf(`secret "as" must be "env" or "file", found %q`, v)
+			}
 		default:
 			if name != "" {
 				return nil, fmt.Errorf("secret cannot have multiple commands: %q and %q", name, k)
@@ -89,27 +132,41 @@ func parseSecret(cfg *ProjectConfig, spec map[string]interface{}) (*secretCmd, e
 		}
 	}
 
+	if varname != "" && !reVarname.MatchString(varname) {
+		return nil, fmt.Errorf("invalid secret varname %q: must be letters, digits, and _ (not starting with a digit)", varname)
+	}
+
 	cmdargs := make([]string, 0)
+	var providerName string
+	var literalArgs int
 
 	// Default to global.
 	passphrase := cfg.SecretPassphrase
 	var cache string
+	var timeout, backoff string
+	var retries int
 
 	// Static command that just runs its args.
 	if name == "exec" {
+		providerName = name
 		cmdargs = args
 	} else {
 		// See if the project configures an alias to simplify module defs.
 		if cfg.SecretCommands != nil {
 			if command, ok := cfg.SecretCommands[name]; ok {
 
+				providerName = "exec"
 				cmdargs = append(command.Exec, args...)
+				literalArgs = len(command.Exec)
 
 				if command.Passphrase != "" {
 					passphrase = command.Passphrase
 				}
 
 				cache = command.Cache
+				timeout = command.Timeout
+				retries = command.Retries
+				backoff = command.RetryBackoff
 
 				envCmds := make([]envLoader, len(command.EnvCommands))
 				for i, ec := range command.EnvCommands {
@@ -118,9 +175,14 @@ func parseSecret(cfg *ProjectConfig, spec map[string]interface{}) (*secretCmd, e
 				secretEnvCommands[name] = &secretSetup{envCmds: envCmds}
 			}
 		}
+		// Otherwise use the provider with that name.
+		if _, ok := secretProviders[name]; ok && providerName == "" {
+			providerName = name
+			cmdargs = args
+		}
 	}
 
-	if len(cmdargs) == 0 {
+	if providerName == "" || len(cmdargs) == 0 {
 		return nil, fmt.Errorf("failed to prepare secret command '%s'", name)
 	}
 
@@ -136,23 +198,83 @@ func parseSecret(cfg *ProjectConfig, spec map[string]interface{}) (*secretCmd, e
 		}
 	}
 
-	return &secretCmd{
+	// The secret spec can override the limits of the command.
+	if v, ok := limitSpec["timeout"]; ok {
+		timeout, _ = v.(string)
+	}
+	if v, ok := limitSpec["retries"]; ok {
+		retries, _ = v.(int)
+	}
+	if v, ok := limitSpec["retry_backoff"]; ok {
+		backoff, _ = v.(string)
+	}
+	limits, err := parseCommandLimits(timeout, retries, backoff)
+	if err != nil {
+		return nil, fmt.Errorf("secret '%s': %w", name, err)
+	}
+
+	secret := &secretCmd{
 		name: name,
 		EnvCommand: &EnvCommand{
-			Exec:    cmdargs,
 			Parse:   parse,
 			Varname: varname,
 		},
+		provider:      secretProviders[providerName](cfg),
+		providerName:  providerName,
+		args:          cmdargs,
+		literalArgs:   literalArgs,
 		passphrase:    passphrase,
+		kdf:           cfg.SecretKDF,
 		cache:         cache,
 		cacheDuration: cacheDuration,
-	}, nil
+		limits:        limits,
+		asFile:        as == "file",
+	}
+	if secret.asFile && (parse || varname == "") {
+		return nil, fmt.Errorf("secret '%s' as a file needs a varname (and can't parse)", name)
+	}
+	if providerName == "exec" {
+		secret.Exec = cmdargs
+	}
+	return secret, nil
+}
+
+// expandArgs returns the args with "${...}" env vars interpolated
+// (any other "$" is left for the command, like a "sh -c" script).
+// This is done when the secret is loaded (rather than with the rest of the
+// module config) so that they can use the vars from env_files and env_commands.
+// If warn is true any variable that is replaced with "" is reported.
+func (s *secretCmd) expandArgs(warn bool) ([]string, error) {
+	in := envInterpolation(false)
+	in.bracedOnly = true
+	if warn {
+		in.blank = func(spec string) {
+			fmt.Fprintf(os.Stderr, "secret %s: ${%s} is blank\n", secretLabel(s), spec)
+		}
+	}
+	args := make([]string, len(s.args))
+	for i, arg := range s.args {
+		if i < s.literalArgs {
+			args[i] = arg
+			continue
+		}
+		expanded, err := in.interpolate(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret args: %w", err)
+		}
+		args[i] = expanded
+	}
+	return args, nil
 }
 
 func (s *secretCmd) Passphrase() ([]byte, error) {
 	var expandedPassphrase string
 	if s.passphrase != "" {
-		expandedPassphrase = expandWarnOnEmpty(s.passphrase)
+		var err error
+		expandedPassphrase, err = expandWarnOnEmpty(s.passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("invalid passphrase: %w", err)
+		}
 		if s.passphrase == expandedPassphrase {
 			return nil, errors.New("passphrase should contain a variable so it isn't plain text")
 		}
@@ -164,23 +286,34 @@ func (s *secretCmd) Passphrase() ([]byte, error) {
 }
 
 func (s *secretCmd) Value() ([]byte, error) {
+	content, _, err := s.value()
+	return content, err
+}
+
+// value returns the value of the secret and whether it came from the cache.
+func (s *secretCmd) value() ([]byte, bool, error) {
 	if err := runSecretSetup(s.name); err != nil {
-		return nil, err
+		return nil, false, err
+	}
+	args, err := s.expandArgs(true)
+	if err != nil {
+		return nil, false, err
 	}
 
-	if s.cache == "none" {
-		return s.EnvCommand.Value()
+	if s.cache == "none" || !s.provider.Cacheable() {
+		content, err := s.providerValue(args)
+		return content, false, err
 	}
 
 	passphrase, err := s.Passphrase()
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	var content []byte
 
 	// See if we already have the secret cached.
-	cacheFile := path.Join(secretDir, genFileName(s.Exec))
+	cacheFile := s.cacheFileFor(args)
 
 	readCache := true
 	if s.cacheDuration > 0 {
@@ -197,22 +330,73 @@ func (s *secretCmd) Value() ([]byte, error) {
 		}
 	}
 
+	if len(content) > 0 {
+		return content, true, nil
+	}
+
 	// If we don't have a cached value, run the command.
-	if len(content) == 0 {
+	content, err = s.providerValue(args)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get secret: %s", err)
+	}
+
+	// Cache it for next time.
+	encrypted := s.encrypt(passphrase, content)
+	if len(encrypted) > 0 {
+		writePrivateFile(cacheFile, encrypted)
+	}
+
+	return content, false, nil
+}
+
+// providerValue gets the value from the provider for the (expanded) args
+// (with the timeout and retries of the secret).
+func (s *secretCmd) providerValue(args []string) ([]byte, error) {
+	return s.limits.run("secret "+secretLabel(s), func(ctx context.Context) ([]byte, error) {
+		return providerValue(ctx, s.provider, args)
+	})
+}
+
+// cacheFile returns the path of the encrypted cache file for the secret
+// (with the args interpolated with the current environment).
+func (s *secretCmd) cacheFile() string {
+	args, err := s.expandArgs(false)
+	if err != nil {
+		args = s.args
+	}
+	return s.cacheFileFor(args)
+}
+
+func (s *secretCmd) cacheFileFor(args []string) string {
+	// Commands are identified by their args alone (as they always have been).
+	if s.providerName == "exec" {
+		return path.Join(secretDir, genFileName(args))
+	}
+	return path.Join(secretDir, genFileName(s.providerName, args))
+}
+
+// secretFile returns the path of the file for a compose secret.
+func (s *secretCmd) secretFile() string {
+	return path.Join(secretFileDir, s.Varname)
+}
+
+// RemoveSecretFiles removes the files written for compose secrets
+// of the project (or of all projects).
+func (cfg *ProjectConfig) RemoveSecretFiles(allProjects bool) error {
+	dirs := []string{secretFileDir}
+	if allProjects {
 		var err error
-		content, err = s.EnvCommand.Value()
+		dirs, err = filepath.Glob(path.Join(cacheRoot, ".muss", "*", "secret_files"))
 		if err != nil {
-			return nil, fmt.Errorf("failed to get secret: %s", err)
+			return err
 		}
-
-		// Cache it for next time.
-		encrypted := s.encrypt(passphrase, content)
-		if len(encrypted) > 0 {
-			writePrivateFile(cacheFile, encrypted)
+	}
+	for _, dir := range dirs {
+		if err := os.RemoveAll(dir); err != nil {
+			return err
 		}
 	}
-
-	return content, nil
+	return nil
 }
 
 var secretSetupMutex sync.Mutex
@@ -236,86 +420,6 @@ func runSecretSetup(name string) error {
 	return nil
 }
 
-const (
-	secretIterationsLen = 3
-	secretNonceLen      = 24
-	secretNonceStart    = secretIterationsLen
-	secretNonceEnd      = secretIterationsLen + secretNonceLen
-	secretSaltLen       = 32
-	secretSaltStart     = secretNonceEnd
-	secretSaltEnd       = secretSaltStart + secretSaltLen
-	secretKeyLen        = 32
-	secretKeyStart      = secretSaltEnd
-	secretKeyEnd        = secretKeyStart + secretKeyLen
-	secretPrefixLen     = secretKeyEnd
-)
-
-func (s *secretCmd) encrypt(passphrase, content []byte) []byte {
-	nonce := [secretNonceLen]byte{}
-	if _, err := rand.Read(nonce[:]); err != nil {
-		return nil
-	}
-
-	// vaulted uses 17 and 18, but we will lower it for speed:
-	// $ muss wrap env
-	// with 3 secrets (sequentially):
-	// 17,18 -> .85s
-	// 16,17 -> .53s
-	// 15,16 -> .29s
-	// 14,15 -> .15s (feels pretty snappy)
-	// 13,14 -> .10s
-	// no secrets: .02s (:sofantastic:)
-	iterations := 1 << 14
-	if r, err := rand.Int(rand.Reader, big.NewInt(1<<15)); err == nil {
-		iterations += int(r.Int64())
-	}
-
-	salt := [secretSaltLen]byte{}
-	if _, err := rand.Read(salt[:]); err != nil {
-		return nil
-	}
-
-	key := [secretKeyLen]byte{}
-	derivedKey := pbkdf2.Key(passphrase, salt[:], iterations, secretKeyLen, sha512.New)
-	copy(key[:], derivedKey[:])
-
-	sealed := secretbox.Seal(nil, content, &nonce, &key)
-
-	result := make([]byte, secretPrefixLen+len(sealed))
-	copy(result[:], []byte{byte(iterations >> 16), byte(iterations & 0xffff >> 8), byte(iterations & 0xff)})
-	copy(result[secretNonceStart:secretNonceEnd], nonce[:])
-	copy(result[secretSaltStart:secretSaltEnd], salt[:])
-	copy(result[secretKeyStart:secretKeyEnd], key[:])
-	copy(result[secretPrefixLen:], sealed[:])
-
-	return result
-}
-
-func (s *secretCmd) decrypt(passphrase, content []byte) (result []byte) {
-	// Don't error on slice indexing.
-	if len(content) <= secretPrefixLen {
-		return nil
-	}
-
-	iterations := int(content[0])<<16 + int(content[1])<<8 + int(content[2])
-
-	nonce := [secretNonceLen]byte{}
-	copy(nonce[:], content[secretNonceStart:secretNonceEnd])
-
-	salt := [secretSaltLen]byte{}
-	copy(salt[:], content[secretSaltStart:secretSaltEnd])
-
-	key := [secretKeyLen]byte{}
-	derivedKey := pbkdf2.Key(passphrase, salt[:], iterations, secretKeyLen, sha512.New)
-	copy(key[:], derivedKey[:])
-
-	plain, ok := secretbox.Open(nil, content[secretPrefixLen:], &nonce, &key)
-	if !ok {
-		return nil
-	}
-	return plain
-}
-
 func genFileName(args ...interface{}) string {
 	h := sha1.New()
 	h.Write([]byte(fmt.Sprintf("%#v", args)))
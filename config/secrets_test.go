@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path"
 	"testing"
@@ -327,6 +328,40 @@ func TestSecretCommands(t *testing.T) {
 			assert.Equal(t, "$MUSS_TEST_FOO", foo.passphrase, "secret-command-specific")
 			assert.Equal(t, "$MUSS_TEST_PASSPHRASE", bar.passphrase, "global")
 		})
+
+		t.Run("args interpolated when loaded", func(t *testing.T) {
+			for _, name := range []string{"MUSS_TEST_FROM_ENV_CMD", "MUSS_TEST_BLANK"} {
+				os.Unsetenv(name)
+				defer os.Unsetenv(name)
+			}
+
+			cfg := &ProjectConfig{
+				SecretCommands: map[string]*SecretCommand{
+					"shell": &SecretCommand{
+						Exec:  []string{"/bin/sh", "-c", `echo "$0 $1 $2"`},
+						Cache: "none",
+						EnvCommands: []*EnvCommand{
+							&EnvCommand{Exec: []string{"echo", "MUSS_TEST_FROM_ENV_CMD=from env cmd"}, Parse: true},
+						},
+					},
+				},
+			}
+			secret, err := parseSecret(cfg, map[string]interface{}{
+				"shell":   []string{"${MUSS_TEST_FROM_ENV_CMD}", "$$1 $${x} ${MUSS_TEST_BLANK}", "$MUSS_TEST_FROM_ENV_CMD $(echo x)"},
+				"varname": "MUSS_TEST_ARGS",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var value []byte
+			stderr := testutil.CaptureStderr(t, func() {
+				value, err = secret.Value()
+			})
+			assert.Nil(t, err)
+			assert.Equal(t, "from env cmd $$1 ${x}  $MUSS_TEST_FROM_ENV_CMD $(echo x)", string(value), "only braced vars are interpolated")
+			assert.Equal(t, "secret MUSS_TEST_ARGS: ${MUSS_TEST_BLANK} is blank\n", stderr, "warns")
+		})
 	})
 
 	t.Run("errors", func(t *testing.T) {
@@ -424,6 +459,72 @@ func TestSecretCommands(t *testing.T) {
 		assert.Equal(t,
 			`a passphrase is required to use secrets`,
 			testSecretError(t, cfg, secretSpec))
+
+		for _, varname := range []string{"../../x", "1ABC", "A-B", "A B"} {
+			_, err := parseSecret(cfg, map[string]interface{}{
+				"env":     []string{"MUSS_TEST_PASSPHRASE"},
+				"varname": varname,
+				"as":      "file",
+			})
+			assert.EqualError(t, err,
+				fmt.Sprintf("invalid secret varname %q: must be letters, digits, and _ (not starting with a digit)", varname),
+				"varname names the secret file")
+		}
+	})
+}
+
+func TestSecretFiles(t *testing.T) {
+	testutil.WithTempDir(t, func(tmpdir string) {
+		findCacheRoot()
+		for _, name := range []string{"MUSS_TEST_DB_PASS", "DB_PASS"} {
+			os.Unsetenv(name)
+			defer os.Unsetenv(name)
+		}
+		os.Setenv("MUSS_TEST_DB_PASS", "open sesame")
+
+		cfg := newTestConfig(t, map[string]interface{}{
+			"module_definitions": []map[string]interface{}{
+				{
+					"name": "app",
+					"configs": map[string]interface{}{
+						"sole": map[string]interface{}{
+							"services": map[string]interface{}{
+								"app": map[string]interface{}{"image": "app"},
+							},
+							"secrets": map[string]interface{}{
+								"DB_PASS": map[string]interface{}{
+									"env": []string{"MUSS_TEST_DB_PASS"},
+									"as":  "file",
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		var vars []EnvVar
+		var err error
+		testutil.CaptureStderr(t, func() {
+			vars, err = cfg.Env(true)
+		})
+		assert.Nil(t, err)
+		for _, v := range vars {
+			assert.NotEqual(t, "DB_PASS", v.Name, "not an env var")
+		}
+		assert.True(t, envIsUnset("DB_PASS"), "not set in the env")
+
+		file := path.Join(secretFileDir, "DB_PASS")
+		assert.Equal(t, "open sesame", testutil.ReadFile(t, file))
+		if info, err := os.Stat(file); assert.Nil(t, err) {
+			assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "only readable by the user")
+		}
+		assert.Equal(t, []string{"open sesame"}, SecretValues(), "redacted")
+
+		assert.Nil(t, cfg.RemoveSecretFiles(false))
+		_, err = os.Stat(secretFileDir)
+		assert.True(t, os.IsNotExist(err), "removed")
+		assert.Equal(t, []string{}, SecretValues())
 	})
 }
 
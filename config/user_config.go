@@ -6,8 +6,9 @@ import (
 
 // UserModuleConfig represents the user's configuration for a module.
 type UserModuleConfig struct {
-	Config   string `yaml:"config"`
-	Disabled bool   `yaml:"disabled"`
+	Config   string                 `yaml:"config"`
+	Disabled bool                   `yaml:"disabled"`
+	Params   map[string]interface{} `yaml:"params,omitempty"`
 }
 
 // UserConfig represents the user's customization file.
@@ -16,6 +17,10 @@ type UserConfig struct {
 	Modules     map[string]UserModuleConfig `yaml:"modules"`
 	Override    map[string]interface{}      `yaml:"override"`
 
+	// Projects holds user configs for individual projects (by project name).
+	// It is only used in the global user file.
+	Projects map[string]*UserConfig `yaml:"projects,omitempty"`
+
 	DeprecatedServicePreference []string                    `yaml:"service_preference,omitempty"`
 	DeprecatedServices          map[string]UserModuleConfig `yaml:"services,omitempty"`
 }
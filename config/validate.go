@@ -0,0 +1,597 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// ValidationError describes a problem found at a specific place in a config file.
+type ValidationError struct {
+	File    string
+	Line    int
+	Column  int
+	Path    string
+	Message string
+}
+
+// Error returns the message prefixed with the location of the problem.
+func (e *ValidationError) Error() string {
+	location := fmt.Sprintf("%s:%d:%d", e.File, e.Line, e.Column)
+	if e.Path == "" {
+		return fmt.Sprintf("%s: %s", location, e.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", location, e.Path, e.Message)
+}
+
+// ValidationErrors holds all of the problems found in the config files.
+type ValidationErrors []*ValidationError
+
+// Error returns the messages of all the errors, one per line.
+func (e ValidationErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = "  " + err.Error()
+	}
+	return "invalid configuration:\n" + strings.Join(lines, "\n")
+}
+
+// errorOrNil returns nil if there are no errors
+// (so that a nil slice isn't returned as a non-nil error interface).
+func (e ValidationErrors) errorOrNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+type validation struct {
+	file   string
+	errors ValidationErrors
+}
+
+func (v *validation) fail(node *yamlv3.Node, path, format string, args ...interface{}) {
+	v.errors = append(v.errors, &ValidationError{
+		File:    v.file,
+		Line:    node.Line,
+		Column:  node.Column,
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// nodeValidator checks a yaml node (found at path) and records any problems.
+type nodeValidator func(v *validation, node *yamlv3.Node, path string)
+
+// validateYaml checks the yaml content against the validator
+// and returns every problem found.
+func validateYaml(file string, content []byte, validator nodeValidator) ValidationErrors {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(content, &doc); err != nil {
+		return ValidationErrors{&ValidationError{File: file, Message: err.Error()}}
+	}
+
+	v := &validation{file: file}
+	// An empty document is an empty map.
+	if doc.Kind == yamlv3.DocumentNode && len(doc.Content) > 0 {
+		validator(v, doc.Content[0], "")
+	}
+
+	// Report problems in the order they appear in the file.
+	sort.SliceStable(v.errors, func(i, j int) bool {
+		a, b := v.errors[i], v.errors[j]
+		return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+	})
+	return v.errors
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func resolveAlias(node *yamlv3.Node) *yamlv3.Node {
+	for node.Kind == yamlv3.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	return node
+}
+
+func isNull(node *yamlv3.Node) bool {
+	return node.Kind == yamlv3.ScalarNode && node.Tag == "!!null"
+}
+
+// yaml11Bools are the plain scalars that yaml.v2 (which decodes the config)
+// resolves as booleans but yaml.v3 resolves as strings.
+var yaml11Bools = map[string]bool{
+	"y": true, "Y": true, "yes": true, "Yes": true, "YES": true,
+	"n": true, "N": true, "no": true, "No": true, "NO": true,
+	"on": true, "On": true, "ON": true, "off": true, "Off": true, "OFF": true,
+}
+
+// scalarTag returns the tag of the node the way yaml.v2 would resolve it.
+func scalarTag(node *yamlv3.Node) string {
+	if node.Kind == yamlv3.ScalarNode && node.Style == 0 && node.Tag == "!!str" && yaml11Bools[node.Value] {
+		return "!!bool"
+	}
+	return node.Tag
+}
+
+func describeNode(node *yamlv3.Node) string {
+	switch node.Kind {
+	case yamlv3.MappingNode:
+		return "a map"
+	case yamlv3.SequenceNode:
+		return "a list"
+	}
+	switch scalarTag(node) {
+	case "!!str":
+		return fmt.Sprintf("string %q", node.Value)
+	case "!!bool":
+		return "a boolean"
+	case "!!int", "!!float":
+		return "a number"
+	}
+	return fmt.Sprintf("%q", node.Value)
+}
+
+// validates wraps a validator to resolve aliases and allow null values
+// (which decode to the zero value).
+func validates(f nodeValidator) nodeValidator {
+	return func(v *validation, node *yamlv3.Node, path string) {
+		node = resolveAlias(node)
+		if isNull(node) {
+			return
+		}
+		f(v, node, path)
+	}
+}
+
+func anyValue() nodeValidator {
+	return func(v *validation, node *yamlv3.Node, path string) {}
+}
+
+func isString() nodeValidator {
+	return validates(func(v *validation, node *yamlv3.Node, path string) {
+		if node.Kind != yamlv3.ScalarNode || node.Tag != "!!str" {
+			v.fail(node, path, "expected a string, found %s", describeNode(node))
+		}
+	})
+}
+
+func isScalar() nodeValidator {
+	return validates(func(v *validation, node *yamlv3.Node, path string) {
+		if node.Kind != yamlv3.ScalarNode {
+			v.fail(node, path, "expected a string or number, found %s", describeNode(node))
+		}
+	})
+}
+
+func isBool() nodeValidator {
+	return validates(func(v *validation, node *yamlv3.Node, path string) {
+		if node.Kind != yamlv3.ScalarNode || scalarTag(node) != "!!bool" {
+			v.fail(node, path, "expected true or false, found %s", describeNode(node))
+		}
+	})
+}
+
+func isDuration() nodeValidator {
+	return validates(func(v *validation, node *yamlv3.Node, path string) {
+		if node.Kind != yamlv3.ScalarNode || node.Tag != "!!str" {
+			v.fail(node, path, "expected a duration (like \"5s\"), found %s", describeNode(node))
+			return
+		}
+		if _, err := time.ParseDuration(node.Value); err != nil {
+			v.fail(node, path, "expected a duration (like \"5s\"), found %s", describeNode(node))
+		}
+	})
+}
+
+func isPositiveInt() nodeValidator {
+	return validates(func(v *validation, node *yamlv3.Node, path string) {
+		if node.Kind != yamlv3.ScalarNode || node.Tag != "!!int" {
+			v.fail(node, path, "expected a positive number, found %s", describeNode(node))
+			return
+		}
+		if n, err := strconv.Atoi(node.Value); err != nil || n < 1 {
+			v.fail(node, path, "expected a positive number, found %s", node.Value)
+		}
+	})
+}
+
+func isNonNegativeInt() nodeValidator {
+	return validates(func(v *validation, node *yamlv3.Node, path string) {
+		if node.Kind != yamlv3.ScalarNode || node.Tag != "!!int" {
+			v.fail(node, path, "expected a number (0 or more), found %s", describeNode(node))
+			return
+		}
+		if n, err := strconv.Atoi(node.Value); err != nil || n < 0 {
+			v.fail(node, path, "expected a number (0 or more), found %s", node.Value)
+		}
+	})
+}
+
+func oneOf(values ...string) nodeValidator {
+	return validates(func(v *validation, node *yamlv3.Node, path string) {
+		if node.Kind != yamlv3.ScalarNode || !containsString(values, node.Value) {
+			v.fail(node, path, "expected one of %s, found %s", strings.Join(values, ", "), describeNode(node))
+		}
+	})
+}
+
+func listOf(item nodeValidator) nodeValidator {
+	return validates(func(v *validation, node *yamlv3.Node, path string) {
+		if node.Kind != yamlv3.SequenceNode {
+			v.fail(node, path, "expected a list, found %s", describeNode(node))
+			return
+		}
+		for i, child := range node.Content {
+			item(v, child, fmt.Sprintf("%s[%d]", path, i))
+		}
+	})
+}
+
+func stringList() nodeValidator {
+	return listOf(isString())
+}
+
+// eachMapPair calls the function with each key and value of a mapping node
+// (including the values from any "<<" merge keys).
+func eachMapPair(v *validation, node *yamlv3.Node, path string, f func(key, value *yamlv3.Node)) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if key.Tag == "!!merge" {
+			value = resolveAlias(value)
+			merges := []*yamlv3.Node{value}
+			if value.Kind == yamlv3.SequenceNode {
+				merges = value.Content
+			}
+			for _, m := range merges {
+				if m = resolveAlias(m); m.Kind == yamlv3.MappingNode {
+					eachMapPair(v, m, path, f)
+				}
+			}
+			continue
+		}
+		if key.Kind != yamlv3.ScalarNode || key.Tag != "!!str" {
+			v.fail(key, path, "map keys must be strings, found %s", describeNode(key))
+			continue
+		}
+		f(key, value)
+	}
+}
+
+// mapOf validates a map with arbitrary keys and values of the same type.
+func mapOf(value nodeValidator) nodeValidator {
+	return validates(func(v *validation, node *yamlv3.Node, path string) {
+		if node.Kind != yamlv3.MappingNode {
+			v.fail(node, path, "expected a map, found %s", describeNode(node))
+			return
+		}
+		eachMapPair(v, node, path, func(k, val *yamlv3.Node) {
+			value(v, val, joinPath(path, k.Value))
+		})
+	})
+}
+
+// structSchema describes a map with a known set of keys.
+type structSchema struct {
+	fields   map[string]nodeValidator
+	required []string
+	// If true keys that aren't in the fields are allowed (and not checked).
+	passthrough bool
+}
+
+func (s structSchema) validator() nodeValidator {
+	return validates(func(v *validation, node *yamlv3.Node, path string) {
+		if node.Kind != yamlv3.MappingNode {
+			v.fail(node, path, "expected a map, found %s", describeNode(node))
+			return
+		}
+
+		seen := make(map[string]bool)
+		eachMapPair(v, node, path, func(k, val *yamlv3.Node) {
+			seen[k.Value] = true
+			if f, ok := s.fields[k.Value]; ok {
+				f(v, val, joinPath(path, k.Value))
+			} else if !s.passthrough {
+				v.fail(k, path, "unknown key '%s' (valid keys: %s)", k.Value, strings.Join(s.keys(), ", "))
+			}
+		})
+
+		for _, r := range s.required {
+			if !seen[r] {
+				v.fail(node, path, "missing required key '%s'", r)
+			}
+		}
+	})
+}
+
+func (s structSchema) keys() []string {
+	keys := make([]string, 0, len(s.fields))
+	for k := range s.fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// byKind validates a value that may take different forms
+// (for example either a map or a list).
+func byKind(expected string, mapping, sequence, scalar nodeValidator) nodeValidator {
+	return validates(func(v *validation, node *yamlv3.Node, path string) {
+		var f nodeValidator
+		switch node.Kind {
+		case yamlv3.MappingNode:
+			f = mapping
+		case yamlv3.SequenceNode:
+			f = sequence
+		case yamlv3.ScalarNode:
+			f = scalar
+		}
+		if f == nil {
+			v.fail(node, path, "expected %s, found %s", expected, describeNode(node))
+			return
+		}
+		f(v, node, path)
+	})
+}
+
+func envCommandSchema() nodeValidator {
+	return structSchema{fields: map[string]nodeValidator{
+		"exec":          stringList(),
+		"parse":         isBool(),
+		"varname":       isString(),
+		"timeout":       isDuration(),
+		"retries":       isNonNegativeInt(),
+		"retry_backoff": isDuration(),
+	}}.validator()
+}
+
+func secretCommandSchema() nodeValidator {
+	return structSchema{fields: map[string]nodeValidator{
+		"cache":         isString(),
+		"exec":          stringList(),
+		"env_commands":  listOf(envCommandSchema()),
+		"passphrase":    isString(),
+		"timeout":       isDuration(),
+		"retries":       isNonNegativeInt(),
+		"retry_backoff": isDuration(),
+	}}.validator()
+}
+
+func statusSchema() nodeValidator {
+	return structSchema{fields: map[string]nodeValidator{
+		"exec":        stringList(),
+		"line_format": isString(),
+		"interval":    isDuration(),
+	}}.validator()
+}
+
+// secretSpecSchema validates a secret in a module config:
+// a "varname" and/or "parse" and a single command (with a list of args)
+// and optionally "as" (env or file) and the timeout and retries.
+func secretSpecSchema() nodeValidator {
+	return validates(func(v *validation, node *yamlv3.Node, path string) {
+		if node.Kind != yamlv3.MappingNode {
+			v.fail(node, path, "secret spec must be a map, found %s", describeNode(node))
+			return
+		}
+		command := ""
+		eachMapPair(v, node, path, func(k, val *yamlv3.Node) {
+			keyPath := joinPath(path, k.Value)
+			switch k.Value {
+			case "varname":
+				isString()(v, val, keyPath)
+			case "parse":
+				isBool()(v, val, keyPath)
+			case "as":
+				oneOf("env", "file")(v, val, keyPath)
+			case "timeout", "retry_backoff":
+				isDuration()(v, val, keyPath)
+			case "retries":
+				isNonNegativeInt()(v, val, keyPath)
+			default:
+				if command != "" {
+					v.fail(k, path, "secret cannot have multiple commands: %q and %q", command, k.Value)
+				}
+				command = k.Value
+				stringList()(v, val, keyPath)
+			}
+		})
+		if command == "" {
+			v.fail(node, path, "secret spec must have a command")
+		}
+	})
+}
+
+func serviceSchema() nodeValidator {
+	stringOrList := byKind("a string or a list", nil, stringList(), isString())
+	return structSchema{
+		passthrough: true,
+		fields: map[string]nodeValidator{
+			"command":     stringOrList,
+			"entrypoint":  stringOrList,
+			"environment": byKind("a map or a list", mapOf(isScalar()), stringList(), nil),
+			"ports":       listOf(anyValue()),
+			"volumes":     listOf(anyValue()),
+
+			mergeDirectiveKey: mergeDirectiveSchema(),
+		},
+	}.validator()
+}
+
+// mergeDirectiveSchema validates the value of mergeDirectiveKey.
+func mergeDirectiveSchema() nodeValidator {
+	directive := validates(func(v *validation, node *yamlv3.Node, path string) {
+		if node.Kind != yamlv3.ScalarNode || !containsString(mergeDirectives, node.Value) {
+			v.fail(node, path, "expected one of %s, found %s", strings.Join(mergeDirectives, ", "), describeNode(node))
+		}
+	})
+	replace := validates(func(v *validation, node *yamlv3.Node, path string) {
+		if node.Value != "replace" {
+			v.fail(node, path, "expected 'replace' or a map, found %s", describeNode(node))
+		}
+	})
+	return byKind("'replace' or a map", mapOf(directive), nil, replace)
+}
+
+// mergeableMapOf is like mapOf but allows a mergeDirectiveKey.
+func mergeableMapOf(value nodeValidator) nodeValidator {
+	directive := mergeDirectiveSchema()
+	return validates(func(v *validation, node *yamlv3.Node, path string) {
+		if node.Kind != yamlv3.MappingNode {
+			v.fail(node, path, "expected a map, found %s", describeNode(node))
+			return
+		}
+		eachMapPair(v, node, path, func(k, val *yamlv3.Node) {
+			if k.Value == mergeDirectiveKey {
+				directive(v, val, joinPath(path, k.Value))
+			} else {
+				value(v, val, joinPath(path, k.Value))
+			}
+		})
+	})
+}
+
+// composeSchema validates the parts of a compose map that muss relies on.
+func composeSchema(extra map[string]nodeValidator) nodeValidator {
+	fields := map[string]nodeValidator{
+		"networks":        mergeableMapOf(anyValue()),
+		"services":        mergeableMapOf(serviceSchema()),
+		"volumes":         mergeableMapOf(anyValue()),
+		mergeDirectiveKey: mergeDirectiveSchema(),
+	}
+	for k, f := range extra {
+		fields[k] = f
+	}
+	return structSchema{passthrough: true, fields: fields}.validator()
+}
+
+func whenSchema() nodeValidator {
+	stringOrList := byKind("a string or a list", nil, stringList(), isString())
+	return structSchema{fields: map[string]nodeValidator{
+		"arch":    stringOrList,
+		"command": stringOrList,
+		"env":     stringOrList,
+		"os":      stringOrList,
+		"path":    stringOrList,
+	}}.validator()
+}
+
+func moduleConfigSchema() nodeValidator {
+	include := byKind("a config name or a map",
+		structSchema{
+			fields:   map[string]nodeValidator{"file": isString()},
+			required: []string{"file"},
+		}.validator(),
+		nil,
+		isString(),
+	)
+	return composeSchema(map[string]nodeValidator{
+		"conflicts": stringList(),
+		"include":   listOf(include),
+		"requires":  stringList(),
+		"secrets":   byKind("a map or a list", mapOf(secretSpecSchema()), listOf(secretSpecSchema()), nil),
+		"when":      whenSchema(),
+	})
+}
+
+func moduleParamSchema() nodeValidator {
+	return structSchema{
+		fields: map[string]nodeValidator{
+			"default":     isScalar(),
+			"description": isString(),
+			"type":        isString(),
+		},
+		required: []string{"type"},
+	}.validator()
+}
+
+func moduleDefSchema() nodeValidator {
+	return structSchema{
+		fields: map[string]nodeValidator{
+			"configs":   mapOf(moduleConfigSchema()),
+			"conflicts": stringList(),
+			"file":      isString(),
+			"name":      isString(),
+			"params":    mapOf(moduleParamSchema()),
+			"requires":  stringList(),
+		},
+		required: []string{"name"},
+	}.validator()
+}
+
+func userModuleSchema() nodeValidator {
+	return structSchema{fields: map[string]nodeValidator{
+		"config":   isString(),
+		"disabled": isBool(),
+		"params":   mapOf(isScalar()),
+	}}.validator()
+}
+
+func userConfigSchema() nodeValidator {
+	userModule := userModuleSchema()
+
+	return structSchema{fields: map[string]nodeValidator{
+		"module_order": stringList(),
+		"modules":      mapOf(userModule),
+		"override":     composeSchema(nil),
+
+		"service_preference": stringList(),
+		"services":           mapOf(userModule),
+	}}.validator()
+}
+
+func globalUserConfigSchema() nodeValidator {
+	fields := map[string]nodeValidator{
+		"module_order": stringList(),
+		"modules":      mapOf(userModuleSchema()),
+		"override":     composeSchema(nil),
+	}
+	project := structSchema{fields: fields}.validator()
+
+	global := make(map[string]nodeValidator, len(fields)+1)
+	for k, v := range fields {
+		global[k] = v
+	}
+	global["projects"] = mapOf(project)
+	return structSchema{fields: global}.validator()
+}
+
+func profileSchema() nodeValidator {
+	return structSchema{fields: map[string]nodeValidator{
+		"module_order": stringList(),
+		"modules":      mapOf(userModuleSchema()),
+	}}.validator()
+}
+
+func projectConfigSchema() nodeValidator {
+	return structSchema{fields: map[string]nodeValidator{
+		"compose_file":         isString(),
+		"default_module_order": stringList(),
+		"env_files":            stringList(),
+		"extends":              byKind("a string or a list", nil, stringList(), isString()),
+		"module_definitions":   listOf(moduleDefSchema()),
+		"module_files":         stringList(),
+		"profiles":             mapOf(profileSchema()),
+		"project_name":         isString(),
+		"secret_commands":      mapOf(secretCommandSchema()),
+		"secret_concurrency":   isPositiveInt(),
+		"secret_kdf":           oneOf(secretKDFNames...),
+		"secret_passphrase":    isString(),
+		"status":               statusSchema(),
+		"user":                 userConfigSchema(),
+		"user_file":            isString(),
+
+		"default_service_preference": stringList(),
+		"service_definitions":        listOf(moduleDefSchema()),
+		"service_files":              stringList(),
+	}}.validator()
+}
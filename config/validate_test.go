@@ -0,0 +1,270 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/get-bridge/muss/testutil"
+)
+
+func assertValidationErrors(t *testing.T, validator nodeValidator, content string, exp []string, msgAndArgs ...interface{}) {
+	t.Helper()
+
+	errs := validateYaml("test.yml", []byte(content), validator)
+	actual := make([]string, len(errs))
+	for i, err := range errs {
+		actual[i] = err.Error()
+	}
+
+	assert.Equal(t, exp, actual, msgAndArgs...)
+}
+
+func TestValidateYaml(t *testing.T) {
+	t.Run("valid module files", func(t *testing.T) {
+		for _, file := range []string{
+			"../testdata/app.yml",
+			"../testdata/microservice.yml",
+			"../testdata/store.yml",
+			"../testdata/thing.yml",
+		} {
+			content := testutil.ReadFile(t, file)
+			assert.Empty(t, validateYaml(file, []byte(content), moduleDefSchema()), file)
+		}
+	})
+
+	t.Run("module definition", func(t *testing.T) {
+		assertValidationErrors(t, moduleDefSchema(), `
+name: app
+config:
+  repo: {}
+`,
+			[]string{
+				"test.yml:3:1: unknown key 'config' (valid keys: configs, conflicts, file, name, params, requires)",
+			},
+			"unknown key")
+
+		assertValidationErrors(t, moduleDefSchema(), `
+configs:
+  repo:
+    include:
+      - _base
+      - files: base.yml
+      - [nope]
+    requires: store
+    secrets:
+      FOO: {vault: [foo], other: [bar]}
+      BAR: {vault: foo, parse: "yes"}
+      BAZ: {vault: [baz], as: volume}
+      QUX: {vault: [qux], timeout: 1s, retries: 2, retry_backoff: 0}
+    services:
+      web:
+        environment: nope
+        command: {not: valid}
+      work: [nope]
+`,
+			[]string{
+				"test.yml:2:1: missing required key 'name'",
+				"test.yml:6:9: configs.repo.include[1]: unknown key 'files' (valid keys: file)",
+				"test.yml:6:9: configs.repo.include[1]: missing required key 'file'",
+				"test.yml:7:9: configs.repo.include[2]: expected a config name or a map, found a list",
+				"test.yml:8:15: configs.repo.requires: expected a list, found string \"store\"",
+				"test.yml:10:27: configs.repo.secrets.FOO: secret cannot have multiple commands: \"vault\" and \"other\"",
+				"test.yml:11:20: configs.repo.secrets.BAR.vault: expected a list, found string \"foo\"",
+				"test.yml:11:32: configs.repo.secrets.BAR.parse: expected true or false, found string \"yes\"",
+				"test.yml:12:31: configs.repo.secrets.BAZ.as: expected one of env, file, found string \"volume\"",
+				"test.yml:13:67: configs.repo.secrets.QUX.retry_backoff: expected a duration (like \"5s\"), found a number",
+				"test.yml:16:22: configs.repo.services.web.environment: expected a map or a list, found string \"nope\"",
+				"test.yml:17:18: configs.repo.services.web.command: expected a string or a list, found a map",
+				"test.yml:18:13: configs.repo.services.work: expected a map, found a list",
+			},
+			"all problems reported")
+	})
+
+	t.Run("aliases and merge keys", func(t *testing.T) {
+		assertValidationErrors(t, moduleDefSchema(), `
+name: app
+configs:
+  _base: &base
+    services:
+      web: &web
+        image: alpine
+  repo:
+    <<: *base
+    services:
+      web: *web
+      work:
+        <<: *web
+        tty: true
+`,
+			[]string{},
+			"anchors resolved")
+	})
+
+	t.Run("merge directives", func(t *testing.T) {
+		assertValidationErrors(t, userConfigSchema(), `
+override:
+  x-muss-merge: {volumes: remove}
+  services:
+    x-muss-merge: {db: remove}
+    app:
+      x-muss-merge: {ports: replace, healthcheck: drop}
+      environment: {x-muss-merge: replace}
+    web:
+      x-muss-merge: merge
+`,
+			[]string{
+				"test.yml:7:51: override.services.app.x-muss-merge.healthcheck: expected one of merge, remove, replace, found string \"drop\"",
+				"test.yml:10:21: override.services.web.x-muss-merge: expected 'replace' or a map, found string \"merge\"",
+			},
+			"directives checked")
+	})
+
+	t.Run("project and user config", func(t *testing.T) {
+		assertValidationErrors(t, projectConfigSchema(), `
+project_name: [list]
+module_files: ./dev/app.yml
+status:
+  interval: often
+user:
+  modules:
+    app: {disabled: 1}
+extends: {file: base.yaml}
+secret_concurrency: 0
+secret_kdf: scrypt
+secret_commands:
+  vault:
+    exec: [vault]
+    timeout: 10
+    retries: -1
+    env_commands:
+      - {exec: [login], retry_backoff: soon}
+`,
+			[]string{
+				"test.yml:2:15: project_name: expected a string, found a list",
+				"test.yml:3:15: module_files: expected a list, found string \"./dev/app.yml\"",
+				"test.yml:5:13: status.interval: expected a duration (like \"5s\"), found string \"often\"",
+				"test.yml:8:21: user.modules.app.disabled: expected true or false, found a number",
+				"test.yml:9:10: extends: expected a string or a list, found a map",
+				"test.yml:10:21: secret_concurrency: expected a positive number, found 0",
+				"test.yml:11:13: secret_kdf: expected one of argon2id, pbkdf2, found string \"scrypt\"",
+				"test.yml:15:14: secret_commands.vault.timeout: expected a duration (like \"5s\"), found a number",
+				"test.yml:16:14: secret_commands.vault.retries: expected a number (0 or more), found -1",
+				"test.yml:18:40: secret_commands.vault.env_commands[0].retry_backoff: expected a duration (like \"5s\"), found string \"soon\"",
+			},
+			"project problems")
+
+		assertValidationErrors(t, userConfigSchema(), `
+module_order: [repo]
+modules:
+  app:
+    config: repo
+override:
+  services:
+    app:
+      environment: [FOO=bar]
+`,
+			[]string{},
+			"valid user config")
+
+		assertValidationErrors(t, userConfigSchema(), `
+modules:
+  app: {disabled: yes}
+  db: {disabled: Off}
+  web: {disabled: "no"}
+`,
+			[]string{
+				"test.yml:5:19: modules.web.disabled: expected true or false, found string \"no\"",
+			},
+			"YAML 1.1 booleans (as decoded by yaml.v2)")
+	})
+}
+
+func TestValidateConfigFiles(t *testing.T) {
+	testutil.WithTempDir(t, func(tmpdir string) {
+		os.Unsetenv("MUSS_FILE")
+		os.Unsetenv("MUSS_USER_FILE")
+
+		t.Run("problems from all files", func(t *testing.T) {
+			testutil.WriteFile(t, "muss.yaml", `
+module_files: [one.yml, two.yml]
+`)
+			testutil.WriteFile(t, "one.yml", `
+name: one
+configs:
+  sole:
+    services: [oops]
+`)
+			testutil.WriteFile(t, "two.yml", `
+name: two
+configs:
+  sole:
+    include: _base
+`)
+			testutil.WriteFile(t, "muss.user.yaml", `
+modules:
+  one: {disable: true}
+`)
+
+			_, err := NewConfigFromDefaultFile()
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			assert.Equal(t, `invalid configuration:
+  one.yml:5:15: configs.sole.services: expected a map, found a list
+  two.yml:5:14: configs.sole.include: expected a list, found string "_base"
+  muss.user.yaml:3:9: modules.one: unknown key 'disable' (valid keys: config, disabled, params)`,
+				err.Error())
+		})
+
+		t.Run("project file", func(t *testing.T) {
+			testutil.WriteFile(t, "muss.yaml", `
+module_file: [one.yml]
+`)
+
+			_, err := NewConfigFromDefaultFile()
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			assert.Contains(t, err.Error(), "muss.yaml:2:1: unknown key 'module_file'")
+		})
+
+		t.Run("included files", func(t *testing.T) {
+			testutil.WriteFile(t, "muss.yaml", `
+module_files: [one.yml, two.yml]
+`)
+			testutil.WriteFile(t, "one.yml", `
+name: one
+configs:
+  sole:
+    include:
+      - file: inc/one.yml
+`)
+			testutil.WriteFile(t, "two.yml", `
+name: two
+configs:
+  sole:
+    include:
+      - file: inc/two.yml
+`)
+			testutil.WriteFile(t, "inc/one.yml", `
+services:
+  app: [oops]
+`)
+			testutil.WriteFile(t, "inc/two.yml", `
+requires: one
+`)
+			os.Remove("muss.user.yaml")
+
+			cfg, err := NewConfigFromDefaultFile()
+			if err == nil {
+				_, err = cfg.ComposeConfig()
+			}
+			assert.Equal(t, `invalid configuration:
+  inc/one.yml:3:8: services.app: expected a map, found a list
+  inc/two.yml:2:11: requires: expected a list, found string "one"`,
+				err.Error())
+		})
+	})
+}
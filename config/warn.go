@@ -10,3 +10,14 @@ func (cfg *ProjectConfig) Warn(msg string) {
 	}
 	cfg.Warnings = append(cfg.Warnings, msg)
 }
+
+// Note adds an informational message to the config
+// (which the commands will print in verbose mode).
+func (cfg *ProjectConfig) Note(msg string) {
+	for _, n := range cfg.Notes {
+		if msg == n {
+			return
+		}
+	}
+	cfg.Notes = append(cfg.Notes, msg)
+}
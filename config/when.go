@@ -0,0 +1,113 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// configConditions are the keys that can be used in a module config's "when"
+// map (in addition to "os" and "arch"), each with a function that returns
+// the reason a value is not satisfied (or "" if it is).
+var configConditions = map[string]func(*ProjectConfig, string) string{
+	"command": func(_ *ProjectConfig, command string) string {
+		if _, err := exec.LookPath(command); err != nil {
+			return fmt.Sprintf("command '%s' not found", command)
+		}
+		return ""
+	},
+	"env": func(_ *ProjectConfig, varname string) string {
+		if _, ok := os.LookupEnv(varname); !ok {
+			return fmt.Sprintf("env var '%s' is not set", varname)
+		}
+		return ""
+	},
+	// Like other paths in the config a relative path is relative to the project dir.
+	"path": func(cfg *ProjectConfig, path string) string {
+		if !fileExists(cfg.projectPath(path)) {
+			return fmt.Sprintf("path '%s' does not exist", path)
+		}
+		return ""
+	},
+}
+
+// unavailableReason checks the "when" conditions of the named config
+// and returns the reason the config can not be used (or "" if it can).
+// For "os" and "arch" any of the listed values will match;
+// for the others every listed value must be satisfied.
+func (s *ModuleDef) unavailableReason(cfg *ProjectConfig, name string) (string, error) {
+	config, _ := s.Configs[name].(map[string]interface{})
+	when, ok := config["when"]
+	if !ok || when == nil {
+		return "", nil
+	}
+	conditions, ok := when.(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("invalid 'when' for config '%s' of module '%s'; must be a map", name, s.Name)
+	}
+
+	keys := make([]string, 0, len(conditions))
+	for k := range conditions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		values, ok := stringOrList(conditions[key])
+		if !ok {
+			return "", fmt.Errorf("invalid 'when' for config '%s' of module '%s'; '%s' must be a string or a list of strings", name, s.Name, key)
+		}
+
+		switch key {
+		case "os", "arch":
+			actual := runtime.GOOS
+			if key == "arch" {
+				actual = runtime.GOARCH
+			}
+			if !containsString(values, actual) {
+				return fmt.Sprintf("%s is '%s' not '%s'", key, actual, strings.Join(values, "' or '")), nil
+			}
+		default:
+			check, ok := configConditions[key]
+			if !ok {
+				return "", fmt.Errorf("invalid 'when' for config '%s' of module '%s'; unknown condition '%s'", name, s.Name, key)
+			}
+			for _, v := range values {
+				if reason := check(cfg, v); reason != "" {
+					return reason, nil
+				}
+			}
+		}
+	}
+
+	return "", nil
+}
+
+func containsString(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func stringOrList(v interface{}) ([]string, bool) {
+	if str, ok := v.(string); ok {
+		return []string{str}, true
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	strs := make([]string, len(list))
+	for i, item := range list {
+		if strs[i], ok = item.(string); !ok {
+			return nil, false
+		}
+	}
+	return strs, true
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/get-bridge/muss/testutil"
+)
+
+func TestConfigConditions(t *testing.T) {
+	testutil.WithTempDir(t, func(tmpdir string) {
+		os.Unsetenv("MUSS_MODULE_ORDER")
+		os.Unsetenv("MUSS_TEST_WHEN")
+		testutil.WriteFile(t, "sibling/readme", "here")
+
+		modules := `
+module_definitions:
+- name: ms
+  configs:
+    repo:
+      when:
+        path: ../microservice
+      services:
+        ms: {build: ../microservice}
+    local:
+      when:
+        path: [sibling, sibling/readme]
+        env: MUSS_TEST_WHEN
+      services:
+        ms: {build: sibling}
+    registry:
+      when:
+        os: [` + runtime.GOOS + `, plan9]
+        arch: ` + runtime.GOARCH + `
+        command: sh
+      services:
+        ms: {image: ms}
+`
+		order := `
+default_module_order: [repo, local, registry]
+`
+
+		t.Run("skips configs with unmet conditions", func(t *testing.T) {
+			cfg := assertComposed(t, modules+order,
+				"{version: '3.7', services: {ms: {image: ms}}}",
+				"first available config chosen")
+
+			assert.Equal(t, []string{
+				"Module 'ms' skipped config 'repo': path '../microservice' does not exist.",
+				"Module 'ms' skipped config 'local': env var 'MUSS_TEST_WHEN' is not set.",
+			}, cfg.Notes)
+			assert.Empty(t, cfg.Warnings)
+		})
+
+		t.Run("conditions met", func(t *testing.T) {
+			os.Setenv("MUSS_TEST_WHEN", "")
+			defer os.Unsetenv("MUSS_TEST_WHEN")
+
+			assertComposed(t, modules+order,
+				"{version: '3.7', services: {ms: {build: sibling}}}",
+				"env var set and paths exist")
+		})
+
+		t.Run("paths from a subdir", func(t *testing.T) {
+			os.Setenv("MUSS_TEST_WHEN", "")
+			defer os.Unsetenv("MUSS_TEST_WHEN")
+			testutil.WriteFile(t, "muss.yaml", modules+order)
+			defer os.Remove("muss.yaml")
+			os.Chdir("sibling")
+			defer os.Chdir(tmpdir)
+
+			cfg, err := NewConfigFromDefaultFile()
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual, err := cfg.ComposeConfig()
+			assert.Nil(t, err)
+			assert.Equal(t, map[string]interface{}{
+				"version":  "3.7",
+				"services": map[string]interface{}{"ms": map[string]interface{}{"build": "sibling"}},
+			}, actual, "paths are relative to the project dir")
+		})
+
+		t.Run("env module order", func(t *testing.T) {
+			os.Setenv("MUSS_MODULE_ORDER", "repo,registry")
+			defer os.Unsetenv("MUSS_MODULE_ORDER")
+
+			assertComposed(t, modules,
+				"{version: '3.7', services: {ms: {image: ms}}}",
+				"conditions apply to MUSS_MODULE_ORDER")
+		})
+
+		t.Run("user choice is kept with a warning", func(t *testing.T) {
+			cfg := assertComposed(t, modules+order+`
+user:
+  modules:
+    ms: {config: repo}
+`,
+				"{version: '3.7', services: {ms: {build: ../microservice}}}",
+				"user choice")
+
+			assert.Equal(t, []string{
+				"Config 'repo' for module 'ms' was chosen but may not work: path '../microservice' does not exist.",
+			}, cfg.Warnings)
+		})
+
+		t.Run("os and arch", func(t *testing.T) {
+			cfg := assertComposed(t, `
+module_definitions:
+- name: ms
+  configs:
+    other:
+      when: {os: [plan9, aix]}
+      services:
+        ms: {image: ms}
+`,
+				"{version: '3.7'}",
+				"only option skipped")
+
+			assert.Equal(t, []string{
+				"Module 'ms' skipped config 'other': os is '" + runtime.GOOS + "' not 'plan9' or 'aix'.",
+			}, cfg.Notes)
+
+			cfg = assertComposed(t, `
+default_module_order: [other, mine]
+module_definitions:
+- name: ms
+  configs:
+    other:
+      when: {arch: nope}
+    mine:
+      when: {command: muss-test-not-a-command}
+`,
+				"{version: '3.7'}",
+				"no config chosen")
+
+			assert.Equal(t, []string{
+				"Module 'ms' skipped config 'other': arch is '" + runtime.GOARCH + "' not 'nope'.",
+				"Module 'ms' skipped config 'mine': command 'muss-test-not-a-command' not found.",
+			}, cfg.Notes)
+		})
+
+		t.Run("invalid conditions", func(t *testing.T) {
+			assertConfigError(t, `
+module_definitions:
+- name: ms
+  configs:
+    sole:
+      when: {file: foo}
+`,
+				"invalid 'when' for config 'sole' of module 'ms'; unknown condition 'file'",
+				"unknown condition")
+		})
+	})
+}
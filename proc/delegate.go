@@ -22,38 +22,50 @@ type Delegator struct {
 	DoneCh   chan bool
 	SignalCh chan os.Signal
 
-	stdoutFilter StreamFilter
-	stderrFilter StreamFilter
+	filters []*filterPipe
+}
+
+// filterPipe is a filter and the writer for the pipe that it reads from.
+type filterPipe struct {
+	filter StreamFilter
+	writer io.WriteCloser
 }
 
 // FilterStdout applies a StreamFilter to stdout.
+// Filters can be chained: the output of the command goes through
+// the last filter applied first.
 func (d *Delegator) FilterStdout(f StreamFilter) error {
-	pr, pw, err := os.Pipe()
+	pw, err := d.filter(f, d.Stdout)
 	if err != nil {
 		return err
 	}
-
-	f.SetReader(pr)
-	f.SetWriter(d.Stdout)
 	d.Stdout = pw
-	d.stdoutFilter = f
-
 	return nil
 }
 
 // FilterStderr applies a StreamFilter to stderr.
+// Filters can be chained: the output of the command goes through
+// the last filter applied first.
 func (d *Delegator) FilterStderr(f StreamFilter) error {
-	pr, pw, err := os.Pipe()
+	pw, err := d.filter(f, d.Stderr)
 	if err != nil {
 		return err
 	}
+	d.Stderr = pw
+	return nil
+}
+
+func (d *Delegator) filter(f StreamFilter, w io.Writer) (io.Writer, error) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
 
 	f.SetReader(pr)
-	f.SetWriter(d.Stderr)
-	d.Stderr = pw
-	d.stderrFilter = f
+	f.SetWriter(w)
+	d.filters = append(d.filters, &filterPipe{filter: f, writer: pw})
 
-	return nil
+	return pw, nil
 }
 
 // Delegate runs with a Delegator made from `os.Std*`.
@@ -76,24 +88,14 @@ func (d *Delegator) Delegate(commands ...*exec.Cmd) (err error) {
 
 	d.DoneCh = make(chan bool, 1)
 
-	if d.stdoutFilter != nil {
-		d.stdoutFilter.Start(d.DoneCh)
-		defer func() {
-			if f, ok := d.Stdout.(io.WriteCloser); ok {
-				f.Close()
-			}
-			d.stdoutFilter.Stop()
-		}()
-	}
-
-	if d.stderrFilter != nil {
-		d.stderrFilter.Start(d.DoneCh)
-		defer func() {
-			if f, ok := d.Stderr.(io.WriteCloser); ok {
-				f.Close()
-			}
-			d.stderrFilter.Stop()
-		}()
+	// Stop the filters in reverse order so that each one
+	// has finished writing before the next one is stopped.
+	for _, f := range d.filters {
+		f.filter.Start(d.DoneCh)
+		defer func(f *filterPipe) {
+			f.writer.Close()
+			f.filter.Stop()
+		}(f)
 	}
 
 	cmdch := make(chan error, len(commands))
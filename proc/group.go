@@ -0,0 +1,38 @@
+package proc
+
+import (
+	"context"
+	"os/exec"
+)
+
+// RunContext runs the command in its own process group
+// and kills the whole group if the context is done before it exits
+// (so that nothing it started is left running or holding its output open).
+// If the stdin of the command is the terminal the group is in the foreground
+// of it while the command runs (so it can read from it)
+// and other commands that use the terminal wait for it to finish.
+func RunContext(ctx context.Context, cmd *exec.Cmd) error {
+	restore, err := setProcessGroup(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		restore()
+		return err
+	}
+	defer restore()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		killProcessGroup(cmd)
+		<-done
+		return ctx.Err()
+	}
+}
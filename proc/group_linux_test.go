@@ -0,0 +1,187 @@
+package proc
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+// TestRunContextPromptHelper is run by TestRunContextPrompt
+// in a session with a pty as its terminal.
+// It runs the number of prompting commands in MUSS_TEST_PTY_HELPER at once.
+func TestRunContextPromptHelper(t *testing.T) {
+	n, _ := strconv.Atoi(os.Getenv("MUSS_TEST_PTY_HELPER"))
+	if n == 0 {
+		t.Skip("only run by TestRunContextPrompt")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cmd := exec.Command("/bin/sh", "-c", fmt.Sprintf(`printf 'Password %d: '; read pass; echo "got $pass"`, i))
+			cmd.Stdin = os.Stdin
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = os.Stderr
+			errs[i] = RunContext(ctx, cmd)
+		}(i)
+	}
+	wg.Wait()
+
+	// This process would be stopped by its next read if the terminal
+	// wasn't given back.
+	foreground, _ := unix.IoctlGetInt(0, unix.TIOCGPGRP)
+	pgrp, _ := unix.Getpgid(0)
+	fmt.Printf("foreground: %t\nerrs: %v\n", foreground == pgrp, errs)
+	os.Exit(0)
+}
+
+func TestRunContextPrompt(t *testing.T) {
+	t.Run("one command", func(t *testing.T) {
+		runPromptHelper(t, 1, func(waitFor func(string) string, answer func(string)) string {
+			assert.Contains(t, waitFor("Password 0: "), "Password 0: ")
+			answer("s3cret")
+			out := waitFor("errs: ")
+			assert.Contains(t, out, "got s3cret", "the command read from the terminal")
+			return out
+		})
+	})
+
+	t.Run("concurrent commands take turns", func(t *testing.T) {
+		runPromptHelper(t, 3, func(waitFor func(string) string, answer func(string)) string {
+			out := ""
+			for i := 0; i < 3; i++ {
+				if i == 0 {
+					waitFor("Password ")
+				} else {
+					// The next prompt comes after the previous answer was read.
+					waitFor(fmt.Sprintf("got %d\r\nPassword ", i-1))
+				}
+				// Give any other command time to prompt too.
+				time.Sleep(100 * time.Millisecond)
+				out = waitFor("") // whatever is ready
+				assert.Equal(t, i+1, strings.Count(out, "Password "), "only one command prompts at a time")
+				answer(strconv.Itoa(i))
+			}
+			out = waitFor("errs: ")
+			for i := 0; i < 3; i++ {
+				assert.Contains(t, out, fmt.Sprintf("got %d", i), "each command read from the terminal")
+			}
+			return out
+		})
+	})
+}
+
+// runPromptHelper runs the helper with n commands in a new session with a pty
+// and checks the output returned by the interaction
+// (given functions to wait for output and answer a prompt).
+func runPromptHelper(t *testing.T, n int, interact func(func(string) string, func(string)) string) {
+	master, slave, err := openPty()
+	if err != nil {
+		t.Skipf("no pty: %s", err)
+	}
+	defer master.Close()
+
+	helper := exec.Command(os.Args[0], "-test.run=^TestRunContextPromptHelper$")
+	helper.Env = append(os.Environ(), "MUSS_TEST_PTY_HELPER="+strconv.Itoa(n))
+	helper.Stdin = slave
+	helper.Stdout = slave
+	helper.Stderr = slave
+	helper.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+	if err := helper.Start(); err != nil {
+		t.Fatal(err)
+	}
+	slave.Close()
+	defer helper.Process.Kill()
+
+	output := make(chan string)
+	go func() {
+		var out strings.Builder
+		buf := make([]byte, 1024)
+		for {
+			n, err := master.Read(buf)
+			out.Write(buf[:n])
+			output <- out.String()
+			if err != nil {
+				close(output)
+				return
+			}
+		}
+	}()
+	var last string
+	waitFor := func(s string) string {
+		t.Helper()
+		timeout := time.After(10 * time.Second)
+		for {
+			// Take any output that is ready.
+			for ready := true; ready; {
+				select {
+				case out, ok := <-output:
+					if ok {
+						last = out
+					}
+					ready = ok
+				default:
+					ready = false
+				}
+			}
+			if strings.Contains(last, s) {
+				return last
+			}
+			select {
+			case out, ok := <-output:
+				if !ok {
+					return last
+				}
+				last = out
+			case <-timeout:
+				return "(timed out)"
+			}
+		}
+	}
+	answer := func(s string) {
+		master.Write([]byte(s + "\n"))
+	}
+
+	out := interact(waitFor, answer)
+	assert.Contains(t, out, "foreground: true", "the terminal was given back")
+	assert.Contains(t, out, "errs: ["+strings.TrimSpace(strings.Repeat("<nil> ", n))+"]")
+}
+
+// openPty returns the master and slave of a new pty.
+func openPty() (*os.File, *os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	fd := int(master.Fd())
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	n, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	return master, slave, nil
+}
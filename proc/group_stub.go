@@ -0,0 +1,18 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package proc
+
+import (
+	"context"
+	"os/exec"
+)
+
+func setProcessGroup(ctx context.Context, cmd *exec.Cmd) (func(), error) {
+	return func() {}, nil
+}
+
+// killProcessGroup only kills the command on systems without process groups.
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
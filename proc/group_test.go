@@ -0,0 +1,38 @@
+package proc
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunContext(t *testing.T) {
+	t.Run("finishes", func(t *testing.T) {
+		var stdout bytes.Buffer
+		cmd := exec.Command("/bin/sh", "-c", "echo hi")
+		cmd.Stdout = &stdout
+
+		assert.Nil(t, RunContext(context.Background(), cmd))
+		assert.Equal(t, "hi\n", stdout.String())
+	})
+
+	t.Run("kills the process group", func(t *testing.T) {
+		var stdout bytes.Buffer
+		// The background sleep would hold stdout open if only sh was killed.
+		cmd := exec.Command("/bin/sh", "-c", "sleep 10 & echo started; wait")
+		cmd.Stdout = &stdout
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		err := RunContext(ctx, cmd)
+		assert.Equal(t, context.DeadlineExceeded, err)
+		assert.True(t, time.Since(start) < 5*time.Second, "did not wait for the background command")
+		assert.Equal(t, "started\n", stdout.String())
+	})
+}
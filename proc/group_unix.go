@@ -0,0 +1,96 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package proc
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// terminal is held by the command that is in the foreground of the terminal
+// so that concurrent commands take turns with it (a command in the background
+// would be stopped if it read from the terminal).
+var terminal = make(chan struct{}, 1)
+
+// setProcessGroup puts the command in its own process group.
+// If its stdin is the terminal that this process is in the foreground of
+// the group is put in the foreground instead (so that the command can still
+// prompt for a password) and the returned function gives the terminal back.
+// Only one command has the terminal at a time so this waits (until the
+// context is done) for any other command to give it back first.
+func setProcessGroup(ctx context.Context, cmd *exec.Cmd) (func(), error) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+
+	fd, ok := terminalFd(cmd.Stdin)
+	if !ok {
+		return func() {}, nil
+	}
+	select {
+	case terminal <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if !inForeground(fd) {
+		<-terminal
+		return func() {}, nil
+	}
+	cmd.SysProcAttr.Foreground = true
+	cmd.SysProcAttr.Ctty = fd
+	return func() {
+		setForeground(fd)
+		<-terminal
+	}, nil
+}
+
+// terminalFd returns the fd of the stdin if it is a terminal.
+func terminalFd(stdin io.Reader) (int, bool) {
+	f, ok := stdin.(*os.File)
+	if !ok {
+		return 0, false
+	}
+	fd := int(f.Fd())
+	_, err := unix.IoctlGetInt(fd, unix.TIOCGPGRP)
+	return fd, err == nil
+}
+
+// inForeground returns true if this process is in the foreground group
+// of the terminal.
+func inForeground(fd int) bool {
+	foreground, err := unix.IoctlGetInt(fd, unix.TIOCGPGRP)
+	if err != nil {
+		return false
+	}
+	pgrp, err := unix.Getpgid(0)
+	return err == nil && foreground == pgrp
+}
+
+// setForeground puts the process group of this process
+// in the foreground of the terminal.
+func setForeground(fd int) {
+	// Changing the foreground group from the background stops the process
+	// (with SIGTTOU) unless the signal is ignored.
+	if !signal.Ignored(syscall.SIGTTOU) {
+		signal.Ignore(syscall.SIGTTOU)
+		defer signal.Reset(syscall.SIGTTOU)
+	}
+	if pgrp, err := unix.Getpgid(0); err == nil {
+		unix.IoctlSetPointerInt(fd, unix.TIOCSPGRP, pgrp)
+	}
+}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	// The group id is the pid of the leader (a negative pid is the group).
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+		cmd.Process.Kill()
+	}
+}
@@ -0,0 +1,167 @@
+package proc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RedactMask replaces secret values in filtered output.
+const RedactMask = "********"
+
+// RedactMinLength is the shortest value that will be redacted
+// (shorter values would mask too much unrelated output).
+const RedactMinLength = 8
+
+// redactFlushDelay is how long to wait for more output
+// when the output ends with what may be the start of a secret.
+var redactFlushDelay = 100 * time.Millisecond
+
+type redactFilter struct {
+	*Pipe
+	patterns     [][]byte
+	readerDoneCh chan bool
+}
+
+// NewRedactFilter returns a StreamFilter that replaces the values
+// (and their base64 and URL encoded forms) with RedactMask.
+func NewRedactFilter(values []string) StreamFilter {
+	return &redactFilter{
+		Pipe:         &Pipe{},
+		patterns:     redactPatterns(values),
+		readerDoneCh: make(chan bool, 1),
+	}
+}
+
+// redactPatterns returns the unique forms of the values
+// with the longest first so that it is masked entirely.
+func redactPatterns(values []string) [][]byte {
+	forms := make(map[string]bool)
+	add := func(s string) {
+		if len(s) >= RedactMinLength {
+			forms[s] = true
+		}
+	}
+	for _, v := range values {
+		// Output is filtered by chunk so also look for each line
+		// of a value with multiple lines.
+		for _, s := range append([]string{v}, strings.Split(v, "\n")...) {
+			s = strings.TrimSpace(s)
+			if len(s) < RedactMinLength {
+				continue
+			}
+			add(s)
+			add(base64.StdEncoding.EncodeToString([]byte(s)))
+			add(base64.RawStdEncoding.EncodeToString([]byte(s)))
+			add(base64.URLEncoding.EncodeToString([]byte(s)))
+			add(base64.RawURLEncoding.EncodeToString([]byte(s)))
+			add(url.QueryEscape(s))
+			add(url.PathEscape(s))
+		}
+	}
+
+	patterns := make([][]byte, 0, len(forms))
+	for s := range forms {
+		patterns = append(patterns, []byte(s))
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) > len(patterns[j])
+		}
+		return bytes.Compare(patterns[i], patterns[j]) < 0
+	})
+	return patterns
+}
+
+// redact returns the content with the patterns masked.
+// Unless final is true the end of the content that may be the start
+// of a pattern is returned separately (to be checked with the next chunk).
+func (f *redactFilter) redact(content []byte, final bool) ([]byte, []byte) {
+	var out bytes.Buffer
+	i := 0
+scan:
+	for i < len(content) {
+		rest := content[i:]
+		for _, p := range f.patterns {
+			if bytes.HasPrefix(rest, p) {
+				out.WriteString(RedactMask)
+				i += len(p)
+				continue scan
+			}
+		}
+		if !final {
+			for _, p := range f.patterns {
+				if len(rest) < len(p) && bytes.HasPrefix(p, rest) {
+					return out.Bytes(), rest
+				}
+			}
+		}
+		out.WriteByte(content[i])
+		i++
+	}
+	return out.Bytes(), nil
+}
+
+func (f *redactFilter) Start(doneCh chan bool) {
+	reader := f.Reader()
+	writer := f.Writer()
+
+	// Write what is read right away (rather than waiting for a line)
+	// so that prompts and progress are shown.
+	chunks := make(chan []byte)
+	go func() {
+		if f, ok := reader.(io.ReadCloser); ok {
+			defer f.Close()
+		}
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := reader.Read(buf)
+			if n > 0 {
+				chunks <- append([]byte(nil), buf[:n]...)
+			}
+			if err != nil {
+				close(chunks)
+				return
+			}
+		}
+	}()
+
+	go func() {
+		var pending, out []byte
+		write := func(content []byte, final bool) {
+			out, pending = f.redact(content, final)
+			if len(out) > 0 {
+				writer.Write(out)
+			}
+		}
+		for {
+			// Don't hold on to the end of the output forever
+			// if it only looks like the start of a secret.
+			var flush <-chan time.Time
+			if len(pending) > 0 {
+				flush = time.After(redactFlushDelay)
+			}
+
+			select {
+			case chunk, ok := <-chunks:
+				if !ok {
+					write(pending, true)
+					f.readerDoneCh <- true
+					return
+				}
+				write(append(pending, chunk...), false)
+			case <-flush:
+				write(pending, true)
+			}
+		}
+	}()
+}
+
+func (f *redactFilter) Stop() {
+	// Wait until the filter is complete.
+	<-f.readerDoneCh
+}
@@ -0,0 +1,109 @@
+package proc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/url"
+	"os/exec"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactFilter(t *testing.T) {
+	secret := "s3cret/value+ok"
+	redact := func(values []string, content string) string {
+		out, held := NewRedactFilter(values).(*redactFilter).redact([]byte(content), true)
+		assert.Nil(t, held)
+		return string(out)
+	}
+
+	t.Run("forms", func(t *testing.T) {
+		for _, form := range []string{
+			secret,
+			base64.StdEncoding.EncodeToString([]byte(secret)),
+			base64.RawURLEncoding.EncodeToString([]byte(secret)),
+			url.QueryEscape(secret),
+			url.PathEscape(secret),
+		} {
+			assert.Equal(t, "a ******** b\n", redact([]string{secret}, "a "+form+" b\n"), form)
+		}
+	})
+
+	t.Run("values", func(t *testing.T) {
+		assert.Equal(t, "********, ********!", redact([]string{"password", "password reset"}, "password reset, password!"), "longest first")
+		assert.Equal(t, "a=1 b=2 true", redact([]string{"1", "b=2\n", "", "true"}, "a=1 b=2 true"), "too short")
+		assert.Equal(t, "x ******** ********\n", redact([]string{"line one\nline two"}, "x line one line two\n"), "each line")
+		assert.Equal(t, "nothing here", redact(nil, "nothing here"))
+	})
+
+	t.Run("held between chunks", func(t *testing.T) {
+		f := NewRedactFilter([]string{secret}).(*redactFilter)
+		out, held := f.redact([]byte("token: s3c"), false)
+		assert.Equal(t, "token: ", string(out))
+		assert.Equal(t, "s3c", string(held))
+
+		out, held = f.redact(append(held, []byte("ret/value+ok\n")...), false)
+		assert.Equal(t, "********\n", string(out))
+		assert.Nil(t, held)
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		pr, pw := io.Pipe()
+		out := &lockedBuffer{}
+		f := NewRedactFilter([]string{secret})
+		f.SetReader(pr)
+		f.SetWriter(out)
+		f.Start(nil)
+
+		pw.Write([]byte("x s3cret/"))
+		pw.Write([]byte("value+ok y s3c"))
+		time.Sleep(2 * redactFlushDelay)
+		assert.Equal(t, "x ******** y s3c", out.String(), "flushed when no more output")
+
+		pw.Write([]byte("ret!"))
+		pw.Close()
+		f.Stop()
+		assert.Equal(t, "x ******** y s3cret!", out.String())
+	})
+
+	t.Run("chained", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		d := &Delegator{
+			Stdout: &stdout,
+			Stderr: &stderr,
+		}
+		d.FilterStdout(NewRedactFilter([]string{secret}))
+		d.FilterStderr(NewRedactFilter([]string{secret}))
+		fout := newTestFilter()
+		d.FilterStdout(fout)
+
+		d.Delegate(
+			exec.Command("/bin/sh", "-c", "echo "+secret+" >&2; echo A; echo "+secret),
+		)
+
+		assert.Equal(t, "********\n", stderr.String())
+		assert.Equal(t, "1 A\n2 ********\ndone\n", stdout.String(), "output of the last filter is redacted")
+		assert.Equal(t, []string{"A", secret}, fout.(*testFilter).messages)
+	})
+}
+
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,47 @@
+package testutil
+
+import (
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+)
+
+// GitCommitFiles commits the files to the main branch of the bare git repo
+// (creating the repo if necessary) and returns the commit id.
+func GitCommitFiles(t *testing.T, bareRepo string, files map[string]string) string {
+	t.Helper()
+
+	git := func(dir string, args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=muss", "-c", "user.email=muss@example.com"}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s failed: %s\n%s", args[0], err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	work := Tempdir(t)
+	defer os.RemoveAll(work)
+
+	if _, err := os.Stat(bareRepo); os.IsNotExist(err) {
+		git(".", "init", "--quiet", "--bare", bareRepo)
+		git(work, "init", "--quiet")
+		git(work, "checkout", "--quiet", "-b", "main")
+		git(work, "remote", "add", "origin", bareRepo)
+		git(bareRepo, "symbolic-ref", "HEAD", "refs/heads/main")
+	} else {
+		git(".", "clone", "--quiet", bareRepo, work)
+	}
+
+	for file, content := range files {
+		WriteFile(t, path.Join(work, file), content)
+	}
+	git(work, "add", "--all")
+	git(work, "commit", "--quiet", "-m", "test")
+	git(work, "push", "--quiet", "origin", "main")
+	return git(work, "rev-parse", "HEAD")
+}
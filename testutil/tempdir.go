@@ -27,16 +27,19 @@ func WithTempDir(t *testing.T, f func(string)) {
 	}
 
 	xdgcache := os.Getenv("XDG_CACHE_HOME")
+	xdgconfig := os.Getenv("XDG_CONFIG_HOME")
 	home := os.Getenv("HOME")
 	dir := Tempdir(t)
 
 	os.Setenv("HOME", path.Join(dir, "test-home"))
 	os.Setenv("XDG_CACHE_HOME", path.Join(dir, "test-cache"))
+	os.Setenv("XDG_CONFIG_HOME", path.Join(dir, "test-config"))
 	os.Chdir(dir)
 
 	defer func() {
 		os.Setenv("HOME", home)
 		os.Setenv("XDG_CACHE_HOME", xdgcache)
+		os.Setenv("XDG_CONFIG_HOME", xdgconfig)
 		os.Chdir(cwd)
 		os.RemoveAll(dir)
 	}()